@@ -0,0 +1,173 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+// Package main is the command which generate the JSON Schema and sample yaml
+// file of conma tagged struct.
+//
+// Because the struct cannot been loaded at runtime, it will generate a temporary
+// program which import the package and invoke conma.NewSchema, so it must been
+// run in the module which can import both the package and conma, such as:
+//
+//	go run github.com/lsytj0413/ena/cmd/conma-schema -pkg example.com/app/config -type Config -out ./docs
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var programTemplate = template.Must(template.New("program").Parse(`// Code generated by conma-schema. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lsytj0413/ena/conma"
+
+	target "{{ .Pkg }}"
+)
+
+func main() {
+	s, err := conma.NewSchema(&target.{{ .Type }}{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	data, err := s.JSON()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{
+		{name: {{ printf "%q" .SchemaFile }}, content: append(data, '\n')},
+		{name: {{ printf "%q" .SampleFile }}, content: s.SampleYAML()},
+	} {
+		if err := os.WriteFile(f.name, f.content, 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("generated", filepath.Clean(f.name))
+	}
+}
+`))
+
+type program struct {
+	Pkg        string
+	Type       string
+	SchemaFile string
+	SampleFile string
+}
+
+func main() {
+	var (
+		pkg  = flag.String("pkg", "", "the import path of package which contains the struct")
+		typ  = flag.String("type", "", "the name of struct type")
+		out  = flag.String("out", ".", "the output directory")
+		name = flag.String("name", "config", "the base name of output files")
+	)
+	flag.Parse()
+
+	if *pkg == "" || *typ == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// The interrupt will cancel the program, so the temporary directory
+	// is removed before exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, *pkg, *typ, *out, *name)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// moduleRoot return the root directory of current module.
+var moduleRoot = func(ctx context.Context) (string, error) {
+	data, err := exec.CommandContext(ctx, "go", "env", "GOMOD").Output()
+	if err != nil {
+		return "", fmt.Errorf("find the current module: %w", err)
+	}
+
+	gomod := strings.TrimSpace(string(data))
+	if gomod == "" || gomod == os.DevNull {
+		return "", fmt.Errorf("conma-schema must been run in a module")
+	}
+	return filepath.Dir(gomod), nil
+}
+
+func run(ctx context.Context, pkg string, typ string, out string, name string) error {
+	out, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return err
+	}
+
+	// The temporary program must be in current module to resolve the imports
+	root, err := moduleRoot(ctx)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp(root, ".conma-schema-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "main.go"))
+	if err != nil {
+		return err
+	}
+	err = programTemplate.Execute(f, &program{
+		Pkg:        pkg,
+		Type:       typ,
+		SchemaFile: filepath.Join(out, name+".schema.json"),
+		SampleFile: filepath.Join(out, name+".sample.yaml"),
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "run", ".")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const testPkg = "github.com/lsytj0413/ena/cmd/conma-schema/testdata/config"
+
+func TestRun(t *testing.T) {
+	root, err := moduleRoot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testcase struct {
+		desp string
+		typ  string
+		root func(ctx context.Context) (string, error)
+		err  bool
+	}
+	testcases := []testcase{
+		{
+			desp: "normal test",
+			typ:  "Config",
+		},
+		{
+			desp: "type not found",
+			typ:  "Missing",
+			err:  true,
+		},
+		{
+			desp: "not in module",
+			typ:  "Config",
+			root: func(ctx context.Context) (string, error) {
+				return "", errors.New("not in module")
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			if tc.root != nil {
+				origin := moduleRoot
+				defer func() {
+					moduleRoot = origin
+				}()
+				moduleRoot = tc.root
+			}
+
+			out := t.TempDir()
+			err := run(context.Background(), testPkg, tc.typ, out, "app")
+
+			// The temporary program is removed whether it succeed or not
+			dirs, gerr := filepath.Glob(filepath.Join(root, ".conma-schema-*"))
+			g.Expect(gerr).ToNot(HaveOccurred())
+			g.Expect(dirs).To(BeEmpty())
+			dirs, gerr = filepath.Glob(".conma-schema-*")
+			g.Expect(gerr).ToNot(HaveOccurred())
+			g.Expect(dirs).To(BeEmpty())
+
+			if tc.err {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			data, err := os.ReadFile(filepath.Join(out, "app.schema.json"))
+			g.Expect(err).ToNot(HaveOccurred())
+			var doc map[string]interface{}
+			g.Expect(json.Unmarshal(data, &doc)).ToNot(HaveOccurred())
+			g.Expect(doc["required"]).To(Equal([]interface{}{"servers"}))
+			g.Expect(doc["properties"]).To(HaveKey("log"))
+
+			data, err = os.ReadFile(filepath.Join(out, "app.sample.yaml"))
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(string(data)).To(ContainSubstring("level: info"))
+		})
+	}
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// isStructType return true if the typ is a struct which should been
+// unmarshaled by fields, the struct with converter (such as time.Time)
+// is treated as scalar, see conv.HasConverter.
+func isStructType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Struct && !conv.HasConverter(typ)
+}
+
+// isStructPtrType return true if the typ is a pointer to struct which should
+// been unmarshaled by fields.
+func isStructPtrType(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Ptr && isStructType(typ.Elem())
+}
+
+// isCompositeType return true if the value of typ should been built from
+// multiple flattened items, such as map, pointer to struct and slice of struct.
+func isCompositeType(typ reflect.Type) bool {
+	if conv.HasConverter(typ) {
+		return false
+	}
+
+	switch typ.Kind() { //nolint
+	case reflect.Map:
+		return true
+	case reflect.Ptr:
+		return isStructType(typ.Elem())
+	case reflect.Slice, reflect.Array:
+		e := typ.Elem()
+		return isStructType(e) || (e.Kind() == reflect.Slice && !conv.HasConverter(e)) || isCompositeType(e)
+	}
+
+	return false
+}
+
+func (m *configMgr) applierForCompositeField(v reflect.Value, prefix string, fd *FieldDescriptor) (Applier, error) {
+	vo, err := m.valueForCompositeField(prefix, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return fieldApplier(v.Field(fd.FieldIndex), vo), nil
+}
+
+func (m *configMgr) valueForCompositeField(prefix string, fd *FieldDescriptor) (reflect.Value, error) {
+	name := joinKey(prefix, fd.Name)
+
+	var vo reflect.Value
+	switch {
+	case m.store.IsSet(name):
+		var err error
+		vo, err = m.valueForKey(name, fd.Typ)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+	case fd.Typ.Kind() == reflect.Ptr || fd.Default != nil:
+		// The pointer is optional, and the map or slice with default is empty
+		vo = reflect.Zero(fd.Typ)
+	default:
+		return reflect.Value{}, &FieldError{
+			Key:   name,
+			Field: fd.FieldName,
+			Err:   xerrors.WrapNotFound("property with key='%v' not found", name),
+		}
+	}
+
+	for _, rule := range fd.Rules {
+		if err := rule.Validate(vo); err != nil {
+			return reflect.Value{}, &FieldError{
+				Key:   name,
+				Field: fd.FieldName,
+				Err:   err,
+			}
+		}
+	}
+
+	return vo, nil
+}
+
+func (m *configMgr) unmarshalEmbeddedField(v reflect.Value, prefix string, p *appliers, field reflect.StructField, idx int) error {
+	switch typ := field.Type; {
+	case isStructType(typ):
+		return m.unmarshalToStruct(v.Field(idx), prefix, p)
+	case isStructPtrType(typ):
+		vo, err := m.valueForKey(prefix, typ)
+		if err != nil {
+			return err
+		}
+
+		p.Append(fieldApplier(v.Field(idx), vo))
+	}
+
+	return nil
+}
+
+// valueForKey will build the value of typ from the items which is or under the key.
+// The map is built from the items under the key, such as 'key.a' and 'key.b', or
+// converted from the scalar item of key, such as 'a=1;b=2'. The map key cannot
+// contain '.', because it's the separator of the nested key.
+// nolint
+func (m *configMgr) valueForKey(key string, typ reflect.Type) (reflect.Value, error) {
+	switch {
+	case isStructPtrType(typ):
+		if !m.store.IsSet(key) {
+			return reflect.Zero(typ), nil
+		}
+
+		e, err := m.valueForKey(key, typ.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(e)
+		return ptr, nil
+	case isStructType(typ):
+		e := reflect.New(typ).Elem()
+		p := &appliers{
+			applies: make([]Applier, 0),
+		}
+		if err := m.unmarshalToStruct(e, key, p); err != nil {
+			return reflect.Value{}, err
+		}
+
+		// The e is a fresh value, so it's safe to apply immediately
+		p.Apply()
+		return e, nil
+	case typ.Kind() == reflect.Map:
+		children := m.store.childKeys(key)
+		if len(children) == 0 && m.store.hasItem(key) {
+			// The scalar item is converted by conv, such as 'a=1;b=2'
+			break
+		}
+
+		ret := reflect.MakeMap(typ)
+		errs := &ValidationError{}
+		for _, child := range children {
+			ckey := joinKey(key, child)
+			k, err := conv.ConvertTo(context.Background(), typ.Key(), []string{child})
+			if err != nil {
+				errs.Append(&FieldError{Key: ckey, Err: withConversionKey(err, ckey)})
+				continue
+			}
+			if !acceptNestedKey(typ.Elem()) && len(m.store.childKeys(ckey)) > 0 {
+				errs.Append(&FieldError{
+					Key: ckey,
+					Err: xerrors.Errorf("the map key '%s' is followed by nested keys, the map key contains '.' is unsupported", child),
+				})
+				continue
+			}
+
+			e, err := m.valueForKey(ckey, typ.Elem())
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			ret.SetMapIndex(reflect.ValueOf(k).Convert(typ.Key()), e)
+		}
+		return ret, errs.ErrorOrNil()
+	case isCompositeType(typ):
+		indexes, err := m.store.indexes(key)
+		if err != nil {
+			return reflect.Value{}, &FieldError{Key: key, Err: err}
+		}
+
+		var ret reflect.Value
+		if typ.Kind() == reflect.Array {
+			if len(indexes) > typ.Len() {
+				return reflect.Value{}, &FieldError{
+					Key: key,
+					Err: xerrors.Errorf("%d elements exceed the array length %d", len(indexes), typ.Len()),
+				}
+			}
+			ret = reflect.New(typ).Elem()
+		} else {
+			ret = reflect.MakeSlice(typ, len(indexes), len(indexes))
+		}
+
+		errs := &ValidationError{}
+		for i, idx := range indexes {
+			e, err := m.valueForKey(fmt.Sprintf("%s[%d]", key, idx), typ.Elem())
+			if err != nil {
+				errs.Append(err)
+				continue
+			}
+			ret.Index(i).Set(e)
+		}
+		return ret, errs.ErrorOrNil()
+	}
+
+	value, err := m.store.Get(key, WithType(reflect.PointerTo(typ)))
+	if err != nil {
+		return reflect.Value{}, &FieldError{Key: key, Err: err}
+	}
+	return reflect.ValueOf(value).Elem(), nil
+}
+
+// acceptNestedKey return true if the value of typ is built from the nested keys
+// such as 'key.a', the '.' after the map key of other types is invalid.
+func acceptNestedKey(typ reflect.Type) bool {
+	return isStructType(typ) || isStructPtrType(typ) || typ.Kind() == reflect.Map
+}
+
+// hasItem return true if the key itself is set, not only the keys under it.
+func (s *flattenStorage) hasItem(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.items[key]
+	return ok
+}
+
+// childKeys return the sorted distinct names of direct children under key,
+// such as 'a' and 'b' for 'key.a', 'key.b[0]' and 'key.b.c'.
+func (s *flattenStorage) childKeys(key string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := map[string]struct{}{}
+	for k := range s.items {
+		if !strings.HasPrefix(k, key+".") {
+			continue
+		}
+
+		name := k[len(key)+1:]
+		if i := strings.IndexAny(name, ".["); i >= 0 {
+			name = name[:i]
+		}
+		names[name] = struct{}{}
+	}
+
+	ret := make([]string, 0, len(names))
+	for name := range names {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// indexes return the sorted distinct indexes of direct elements under key,
+// such as 0 and 1 for 'key[0]', 'key[1]' and 'key[1].a'.
+func (s *flattenStorage) indexes(key string) ([]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idxs := map[int]struct{}{}
+	for k := range s.items {
+		if !strings.HasPrefix(k, key+"[") {
+			continue
+		}
+
+		rest := k[len(key)+1:]
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return nil, xerrors.Errorf("invalid index key '%s'", k)
+		}
+
+		i, err := strconv.Atoi(rest[:end])
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "invalid index key '%s'", k)
+		}
+		idxs[i] = struct{}{}
+	}
+
+	ret := make([]int, 0, len(idxs))
+	for i := range idxs {
+		ret = append(ret, i)
+	}
+	sort.Ints(ret)
+	return ret, nil
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestIsCompositeType(t *testing.T) {
+	type S struct{}
+
+	type testCase struct {
+		desp   string
+		typ    reflect.Type
+		expect bool
+	}
+	testCases := []testCase{
+		{desp: "map", typ: reflect.TypeOf(map[string]string{}), expect: true},
+		{desp: "pointer to struct", typ: reflect.TypeOf(&S{}), expect: true},
+		{desp: "slice of struct", typ: reflect.TypeOf([]S{}), expect: true},
+		{desp: "slice of pointer to struct", typ: reflect.TypeOf([]*S{}), expect: true},
+		{desp: "slice of map", typ: reflect.TypeOf([]map[string]int{}), expect: true},
+		{desp: "slice of slice", typ: reflect.TypeOf([][]string{}), expect: true},
+		{desp: "array of struct", typ: reflect.TypeOf([2]S{}), expect: true},
+		{desp: "slice of string", typ: reflect.TypeOf([]string{}), expect: false},
+		{desp: "pointer to string", typ: reflect.TypeOf(new(string)), expect: false},
+		{desp: "duration", typ: reflect.TypeOf(time.Second), expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(isCompositeType(tc.typ)).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestFlattenStorageChildKeysAndIndexes(t *testing.T) {
+	g := NewWithT(t)
+	s := &flattenStorage{
+		items: map[string]string{
+			"k":         "v",
+			"k.a":       "v",
+			"k.b[0]":    "v",
+			"k.b.c":     "v",
+			"k[1]":      "v",
+			"k[0].a":    "v",
+			"k[10][0]":  "v",
+			"kk.d":      "v",
+			"kk[abc]":   "v",
+			"kkk[1":     "v",
+			"other.k.a": "v",
+		},
+	}
+
+	g.Expect(s.childKeys("k")).To(Equal([]string{"a", "b"}))
+	g.Expect(s.childKeys("unknown")).To(BeEmpty())
+
+	indexes, err := s.indexes("k")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(indexes).To(Equal([]int{0, 1, 10}))
+
+	_, err = s.indexes("kk")
+	g.Expect(err).To(HaveOccurred())
+	_, err = s.indexes("kkk")
+	g.Expect(err).To(HaveOccurred())
+}
+
+type testUpstream struct {
+	Host   string `conma:"host"`
+	Weight int    `conma:"weight:=1"`
+}
+
+type testTLSConfig struct {
+	Cert string `conma:"cert"`
+	Key  string `conma:"key"`
+}
+
+type testBase struct {
+	Name string `conma:"name"`
+}
+
+type testBase2 struct {
+	Version string `conma:"version:=v1"`
+}
+
+func TestConfigMgrUnmarshalComposite(t *testing.T) {
+	type testObj struct {
+		testBase
+		*testBase2
+
+		Labels    map[string]string         `conma:"labels"`
+		Limits    map[string]int            `conma:"limits:="`
+		Ports     map[int]string            `conma:"ports:="`
+		Upstreams []testUpstream            `conma:"upstreams"`
+		Backups   []*testUpstream           `conma:"backups:="`
+		Pairs     [2]testUpstream           `conma:"pairs:="`
+		Groups    [][]string                `conma:"groups:="`
+		Routes    map[string][]testUpstream `conma:"routes:="`
+		TLS       *testTLSConfig            `conma:"tls"`
+		Proxy     *testTLSConfig            `conma:"proxy"`
+	}
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"name":                  "n1",
+				"labels.app":            "a1",
+				"labels.env":            "prod",
+				"ports.80":              "http",
+				"upstreams[0].host":     "h1",
+				"upstreams[1].host":     "h2",
+				"upstreams[1].weight":   "2",
+				"pairs[0].host":         "p1",
+				"groups[0][0]":          "g1",
+				"groups[0][1]":          "g2",
+				"groups[1][0]":          "g3",
+				"routes.api[0].host":    "r1",
+				"tls.cert":              "c1",
+				"tls.key":               "k1",
+				"unrelated.labels.key1": "v1",
+			},
+		}
+
+		var o testObj
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			testBase:  testBase{Name: "n1"},
+			testBase2: &testBase2{Version: "v1"},
+			Labels:    map[string]string{"app": "a1", "env": "prod"},
+			Limits:    nil,
+			Ports:     map[int]string{80: "http"},
+			Upstreams: []testUpstream{{Host: "h1", Weight: 1}, {Host: "h2", Weight: 2}},
+			Backups:   nil,
+			Pairs:     [2]testUpstream{{Host: "p1", Weight: 1}},
+			Groups:    [][]string{{"g1", "g2"}, {"g3"}},
+			Routes:    map[string][]testUpstream{"api": {{Host: "r1", Weight: 1}}},
+			TLS:       &testTLSConfig{Cert: "c1", Key: "k1"},
+			Proxy:     nil,
+		}))
+	})
+
+	t.Run("aggregated error", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"name":                "n1",
+				"ports.http":          "http",
+				"upstreams[0].host":   "h1",
+				"upstreams[1].weight": "abc",
+				"pairs[0].host":       "p1",
+				"pairs[1].host":       "p2",
+				"pairs[2].host":       "p3",
+				"tls.cert":            "c1",
+			},
+		}
+
+		var o testObj
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+
+		var ve *ValidationError
+		g.Expect(xerrors.As(err, &ve)).To(BeTrue())
+		keys := []string{}
+		for _, fe := range ve.Errors {
+			keys = append(keys, fe.Key)
+		}
+		g.Expect(keys).To(Equal([]string{
+			"labels",
+			"ports.http",
+			"upstreams[1].host",
+			"upstreams[1].weight",
+			"pairs",
+			"tls.key",
+		}))
+		g.Expect(o).To(Equal(testObj{}))
+	})
+
+	t.Run("scalar map", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"labels": "app=a1;env=prod",
+				"limits": "cpu=2",
+			},
+		}
+
+		var o struct {
+			Labels map[string]string `conma:"labels"`
+			Limits map[string]int    `conma:"limits"`
+		}
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(o.Labels).To(Equal(map[string]string{"app": "a1", "env": "prod"}))
+		g.Expect(o.Limits).To(Equal(map[string]int{"cpu": 2}))
+	})
+
+	t.Run("dotted map key", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"labels.app":            "a1",
+				"labels.k8s.io/name":    "n1",
+				"routes.api.v1[0].host": "r1",
+			},
+		}
+
+		var o struct {
+			Labels map[string]string         `conma:"labels"`
+			Routes map[string][]testUpstream `conma:"routes"`
+		}
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+
+		var ve *ValidationError
+		g.Expect(xerrors.As(err, &ve)).To(BeTrue())
+		keys := []string{}
+		for _, fe := range ve.Errors {
+			keys = append(keys, fe.Key)
+		}
+		g.Expect(keys).To(Equal([]string{"labels.k8s", "routes.api"}))
+		g.Expect(err.Error()).To(ContainSubstring("the map key contains '.' is unsupported"))
+	})
+
+	t.Run("invalid default", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"labels.app": "a1",
+			},
+		}
+
+		var o struct {
+			Labels    map[string]string `conma:"labels:=env=prod"`
+			Upstreams []testUpstream    `conma:"upstreams:=h1"`
+		}
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("invalid default of field 'Labels'"))
+		g.Expect(err.Error()).To(ContainSubstring("invalid default of field 'Upstreams'"))
+		g.Expect(o.Labels).To(BeNil())
+	})
+}
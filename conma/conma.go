@@ -20,7 +20,9 @@
 package conma
 
 import (
+	"context"
 	"reflect"
+	"sync"
 	"sync/atomic"
 	"unsafe"
 
@@ -30,16 +32,54 @@ import (
 
 // ConfigMgr is the manager for config manager
 type ConfigMgr interface {
-	// Unmarshal will load the configuration item to object base on
-	// tag.
-	Unmarshal(o interface{}) error
+	ConfigView
 
 	// AddConfigReader will add current ConfigReader to list's end.
 	AddConfigReader(r ConfigReader)
 
 	// ReadConfig will load all configuration items to current mgr, user
-	// must call this before retrieve configuration items.
+	// must call this before retrieve configuration items. The items is
+	// visible only after all ConfigReader succeed, otherwise the errors of
+	// all failed readers is returned as *ReadError. Use the
+	// NewOptionalConfigReader for the reader which is allowed to fail.
 	ReadConfig() error
+
+	// ReadConfigContext is the ReadConfig with context, the ContextConfigReader
+	// will been cancelled when ctx is done. It's the same as Reload, so the
+	// bound objects and subscribers will been updated too.
+	ReadConfigContext(ctx context.Context) error
+
+	// Reload will re-read all configuration items to a fresh storage and
+	// replace the current one, the bound objects and subscribers will been
+	// updated with the changes.
+	Reload() error
+
+	// Watch will reload the configuration when any WatchableConfigReader
+	// is changed, it will block until the ctx is done.
+	Watch(ctx context.Context, opts ...ena.Option[watchOption]) error
+
+	// Subscribe will register the handler for changes of keys with prefix.
+	Subscribe(prefix string, fn ChangeHandler) (cancel func())
+
+	// Bind will unmarshal the configuration items to object, and keep it
+	// updated after each ReadConfig and Reload.
+	Bind(o interface{}) error
+
+	// Explain return the effective configuration items which key is or
+	// under the key, with the source which last set it.
+	Explain(key string, opts ...ena.Option[explainOption]) ([]Explanation, error)
+
+	// Dump return all effective configuration items with the source.
+	Dump(opts ...ena.Option[explainOption]) []Explanation
+
+	// Export will serialize the effective configuration items to format,
+	// such as FormatYAML or FormatJSON. The secret items are written as the
+	// unresolved reference, not the secret value.
+	Export(format string) ([]byte, error)
+
+	// UnusedKeys return the keys which is or under the prefix, and haven't
+	// been retrieved by Unmarshal or Get.
+	UnusedKeys(prefix string) []string
 }
 
 var defaultConfigMgr unsafe.Pointer
@@ -54,14 +94,40 @@ func SetDefault(v ConfigMgr) {
 	atomic.StorePointer(&defaultConfigMgr, unsafe.Pointer(&v))
 }
 
+// configMgr is safe for concurrent use, the store is copy-on-write: the
+// ReadConfig and Reload will read to a new storage and replace the current
+// one, so that the Unmarshal and Get will never see a half-applied one.
 type configMgr struct {
+	opt *configMgrOption
+
+	// readMu serialize the ReadConfig and Reload, and protect the configReaders
+	readMu        sync.Mutex
 	configReaders []ConfigReader
-	store         *flattenStorage
+
+	// mu protect the store from been replaced by ReadConfig and Reload
+	mu    sync.RWMutex
+	store *flattenStorage
+
+	subscribers subscribers
+
+	bindMu   sync.Mutex
+	bindings []interface{}
 }
 
 // NewConfigMgr will return an ConfigMgr instance
 func NewConfigMgr(readers ...ConfigReader) ConfigMgr {
+	return NewConfigMgrWithOptions(readers)
+}
+
+// NewConfigMgrWithOptions will return an ConfigMgr instance with options
+func NewConfigMgrWithOptions(readers []ConfigReader, opts ...ena.Option[configMgrOption]) ConfigMgr {
+	opt := defaultConfigMgrOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
 	return &configMgr{
+		opt:           opt,
 		store:         newFlattenStorage(),
 		configReaders: readers,
 	}
@@ -70,6 +136,10 @@ func NewConfigMgr(readers ...ConfigReader) ConfigMgr {
 // Unmarshal will retrieve the configuration items to object o
 // base on `conma` struct tag.
 func (m *configMgr) Unmarshal(o interface{}) error {
+	return m.unmarshal(o, "")
+}
+
+func (m *configMgr) unmarshal(o interface{}, prefix string) error {
 	v := reflect.ValueOf(o)
 	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
 		return xerrors.Errorf("The target object must be an pointer to struct, current is %s", v.String())
@@ -78,43 +148,73 @@ func (m *configMgr) Unmarshal(o interface{}) error {
 	p := &appliers{
 		applies: make([]Applier, 0),
 	}
-	err := m.unmarshalToStruct(v.Elem(), "", p)
+
+	// Unmarshal with the snapshot, so that all fields is from the same storage
+	store := m.snapshot()
+	view := &configMgr{
+		opt:   m.opt,
+		store: store,
+	}
+	err := view.unmarshalToStruct(v.Elem(), prefix, p)
 	if err != nil {
 		return err
 	}
+	if err := m.checkStrict(store, v.Elem().Type(), prefix); err != nil {
+		return err
+	}
 
 	p.Apply()
 	return nil
 }
 
+// snapshot return the current storage, it will not been modified after
+// it's published.
+func (m *configMgr) snapshot() *flattenStorage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.store
+}
+
 func (m *configMgr) unmarshalToStruct(v reflect.Value, prefix string, p *appliers) error {
 	if v.Type().Kind() != reflect.Struct {
 		panic(xerrors.Errorf("The target value must be an struct, current is %s", v.Type().String()))
 	}
 
+	// We continue with the remaining fields when one failed, so that all
+	// invalid fields is reported at once.
+	errs := &ValidationError{}
 	for idx := 0; idx < v.Type().NumField(); idx++ {
 		err := m.unmarshalStructField(v, prefix, p, idx)
 		if err != nil {
-			return err
+			errs.Append(err)
 		}
 	}
 
-	return nil
+	return errs.ErrorOrNil()
 }
 
 func (m *configMgr) unmarshalStructField(v reflect.Value, prefix string, p *appliers, idx int) error {
 	field := v.Type().Field(idx)
 	fd, err := NewFieldDescriptor(field, idx)
 	if err != nil {
-		return err
+		return &FieldError{
+			Key:   prefix,
+			Field: field.Name,
+			Err:   err,
+		}
 	}
 	if fd == nil {
+		if field.Anonymous {
+			// The embedded struct without tag, it's fields is promoted to current prefix
+			return m.unmarshalEmbeddedField(v, prefix, p, field, idx)
+		}
 		return nil
 	}
 
-	if fd.Typ.Kind() == reflect.Struct {
-		// If this is struct, we dive into sub field
-		err := m.unmarshalToStruct(v.Field(idx), fd.Name, p)
+	if isStructType(fd.Typ) {
+		// If this is struct, we dive into sub field with the accumulated prefix
+		err := m.unmarshalToStruct(v.Field(idx), joinKey(prefix, fd.Name), p)
 		if err != nil {
 			return err
 		}
@@ -122,7 +222,12 @@ func (m *configMgr) unmarshalStructField(v reflect.Value, prefix string, p *appl
 		return nil
 	}
 
-	applier, err := m.applierForStructField(v, prefix, fd)
+	var applier Applier
+	if isCompositeType(fd.Typ) {
+		applier, err = m.applierForCompositeField(v, prefix, fd)
+	} else {
+		applier, err = m.applierForStructField(v, prefix, fd)
+	}
 	if err != nil {
 		return err
 	}
@@ -131,7 +236,25 @@ func (m *configMgr) unmarshalStructField(v reflect.Value, prefix string, p *appl
 	return nil
 }
 
+// valueForField will build the value of field fd (except the nested struct)
+// and validate it, as the Applier of unmarshalStructField.
+func (m *configMgr) valueForField(prefix string, fd *FieldDescriptor) (reflect.Value, error) {
+	if isCompositeType(fd.Typ) {
+		return m.valueForCompositeField(prefix, fd)
+	}
+	return m.valueForStructField(prefix, fd)
+}
+
 func (m *configMgr) applierForStructField(v reflect.Value, prefix string, fd *FieldDescriptor) (Applier, error) {
+	vo, err := m.valueForStructField(prefix, fd)
+	if err != nil {
+		return nil, err
+	}
+
+	return fieldApplier(v.Field(fd.FieldIndex), vo), nil
+}
+
+func (m *configMgr) valueForStructField(prefix string, fd *FieldDescriptor) (reflect.Value, error) {
 	opts := []ena.Option[getOption]{}
 	if fd.Default != nil {
 		opts = append(opts, WithDefault(*fd.Default))
@@ -142,14 +265,14 @@ func (m *configMgr) applierForStructField(v reflect.Value, prefix string, fd *Fi
 	}
 	opts = append(opts, WithType(typ))
 
-	name := fd.Name
-	if prefix != "" {
-		name = prefix + "." + name
-	}
-
+	name := joinKey(prefix, fd.Name)
 	value, err := m.store.Get(name, opts...)
 	if err != nil {
-		return nil, err
+		return reflect.Value{}, &FieldError{
+			Key:   name,
+			Field: fd.FieldName,
+			Err:   err,
+		}
 	}
 
 	vo := reflect.ValueOf(value)
@@ -157,41 +280,138 @@ func (m *configMgr) applierForStructField(v reflect.Value, prefix string, fd *Fi
 		vo = vo.Elem()
 	}
 
-	fv := v.Field(fd.FieldIndex)
-	if !fd.Unexported {
+	for _, rule := range fd.Rules {
+		if err := rule.Validate(vo); err != nil {
+			return reflect.Value{}, &FieldError{
+				Key:   name,
+				Field: fd.FieldName,
+				Err:   err,
+			}
+		}
+	}
+
+	return vo, nil
+}
+
+// fieldApplier return the Applier which set the struct field fv to vo.
+func fieldApplier(fv reflect.Value, vo reflect.Value) Applier {
+	if fv.CanSet() {
 		return &fnApplier{
 			fn: func() {
 				fv.Set(vo)
 			},
-		}, nil
+		}
 	}
 
 	return &fnApplier{
 		fn: func() {
-			// The field is unexported (private field), we cannot directly use Set
+			// The field is unexported (private field) or promoted from unexported embedded
+			// struct, we cannot directly use Set
 			// It will panic with 'reflect.Value.Set using unaddressable value'
 			reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem().Set(vo)
 		},
-	}, nil
+	}
+}
+
+// joinKey will join the prefix and key with '.', the empty part is ignored.
+func joinKey(prefix string, key string) string {
+	switch {
+	case prefix == "":
+		return key
+	case key == "":
+		return prefix
+	}
+
+	return prefix + "." + key
 }
 
 // AddConfigReader will add current ConfigReader to list's end.
 func (m *configMgr) AddConfigReader(r ConfigReader) {
+	m.readMu.Lock()
+	defer m.readMu.Unlock()
+
 	m.configReaders = append(m.configReaders, r)
 }
 
 // ReadConfig will load all configuration items to current mgr, user
 // must call this before retrieve configuration items.
 func (m *configMgr) ReadConfig() error {
+	return m.ReadConfigContext(context.Background())
+}
+
+// ReadConfigContext is the ReadConfig with context, the ContextConfigReader
+// will been cancelled when ctx is done.
+func (m *configMgr) ReadConfigContext(ctx context.Context) error {
+	// It's the same as Reload, so the bound objects and subscribers is
+	// updated by ReadConfig too
+	return m.reload(ctx)
+}
+
+func (m *configMgr) readTo(ctx context.Context, store *flattenStorage) error {
+	if m.opt != nil {
+		store.SetMergeRules(m.opt.MergeRules)
+	}
+	errs := &ReadError{}
 	for _, r := range m.configReaders {
-		if err := r.ReadTo(m.store); err != nil {
-			return err
+		cr := r
+		if _, ok := r.(*timeoutConfigReader); !ok && m.opt != nil && m.opt.ReaderTimeout > 0 {
+			cr = NewTimeoutConfigReader(r, m.opt.ReaderTimeout)
+		}
+
+		// The reader will override the source with more detail if it can, and
+		// each reader is a write session, see writeSession
+		name := readerName(r)
+		ss := store.WithSource(Source{Reader: name}).(*sourceStorage)
+		if err := readWithContext(ctx, cr, ss); err != nil {
+			errs.Errors = append(errs.Errors, &ReaderError{
+				Reader: name,
+				Key:    ss.session.failedKey,
+				Err:    err,
+			})
+
+			// The remaining readers will fail with the same error
+			if ctx.Err() != nil {
+				break
+			}
 		}
 	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return err
+	}
 
+	if m.opt != nil && m.opt.Resolve {
+		return store.resolve(defaultResolverRegistry)
+	}
 	return nil
 }
 
+// Explain return the effective configuration items which key is or
+// under the key, with the source which last set it. The values of
+// sensitive keys are redacted.
+func (m *configMgr) Explain(key string, opts ...ena.Option[explainOption]) ([]Explanation, error) {
+	opt := defaultExplainOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	explanations := m.snapshot().Explain(key)
+	if len(explanations) == 0 {
+		return nil, xerrors.WrapNotFound("property with key='%v' not found", key)
+	}
+	return opt.redact(explanations), nil
+}
+
+// Dump return all effective configuration items with the source, the
+// values of sensitive keys are redacted.
+func (m *configMgr) Dump(opts ...ena.Option[explainOption]) []Explanation {
+	opt := defaultExplainOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	return opt.redact(m.snapshot().Explain(""))
+}
+
 func init() {
 	SetDefault(NewConfigMgr())
 }
@@ -20,14 +20,23 @@
 package conma
 
 import (
+	"context"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
 	"reflect"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
 
 	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/conv"
 	"github.com/lsytj0413/ena/xerrors"
 )
 
@@ -193,7 +202,202 @@ func TestConfigMgrReadConfig(t *testing.T) {
 		)
 		err := mgr.ReadConfig()
 		g.Expect(err).To(HaveOccurred())
-		g.Expect(count).To(Equal(2))
+		g.Expect(count).To(Equal(3))
+		g.Expect(err).To(MatchError(xerrors.ErrContinue))
+	})
+}
+
+func TestConfigMgrReadError(t *testing.T) {
+	g := NewWithT(t)
+
+	type testSetObj struct{}
+	count := 0
+	mgr := NewConfigMgr(
+		&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				count++
+				return r.Set("k1", "v1")
+			},
+		},
+		&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				count++
+				if err := r.Set("k2", "v2"); err != nil {
+					return err
+				}
+				return r.Set("k3", map[string]interface{}{"a": testSetObj{}})
+			},
+		},
+		NewTimeoutConfigReader(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				count++
+				return xerrors.WrapNotFound("file 'local.yaml' not found")
+			},
+		}, 0),
+	)
+	err := mgr.ReadConfig()
+	g.Expect(count).To(Equal(3))
+	g.Expect(mgr.IsSet("k1")).To(BeFalse())
+
+	var re *ReadError
+	g.Expect(xerrors.As(err, &re)).To(BeTrue())
+	g.Expect(re.Errors).To(HaveLen(2))
+	g.Expect(re.Errors[0].Reader).To(Equal("*conma.testConfigReader"))
+	g.Expect(re.Errors[0].Key).To(Equal("k3"))
+	g.Expect(re.Errors[1].Reader).To(Equal("*conma.testConfigReader"))
+	g.Expect(re.Errors[1].Key).To(Equal(""))
+	g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(err.Error()).To(HavePrefix("2 reader(s) failed: reader *conma.testConfigReader (key k3): "))
+}
+
+func TestOptionalConfigReader(t *testing.T) {
+	t.Run("optional", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var readErr error
+		r := NewOptionalConfigReader(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				if err := r.Set("k1", "v1"); err != nil {
+					return err
+				}
+				return readErr
+			},
+		})
+		mgr := NewConfigMgr(r)
+
+		readErr = xerrors.Wrapf(ErrMissing, "read file 'local.yaml' failed")
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		g.Expect(r.Ignored()).To(MatchError(ErrMissing))
+		g.Expect(Get[string](mgr, "k1")).To(Equal("v1"))
+		g.Expect(mgr.Explain("k1")).To(Equal([]Explanation{
+			{Key: "k1", Value: "v1", Source: Source{Reader: "*conma.testConfigReader"}},
+		}))
+
+		readErr = nil
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		g.Expect(r.Ignored()).ToNot(HaveOccurred())
+
+		// The other not found errors is returned
+		readErr = xerrors.WrapNotFound("decoder for format 'jsn' not found")
+		g.Expect(xerrors.IsNotFound(mgr.ReadConfig())).To(BeTrue())
+		readErr = xerrors.Wrapf(os.ErrNotExist, "read file 'base.yaml' failed")
+		g.Expect(mgr.ReadConfig()).To(MatchError(os.ErrNotExist))
+
+		readErr = xerrors.ErrContinue
+		g.Expect(mgr.ReadConfig()).To(MatchError(xerrors.ErrContinue))
+		g.Expect(r.Changed()).To(BeFalse())
+	})
+
+	t.Run("best effort", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var readErr error
+		r := NewBestEffortConfigReader(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				return readErr
+			},
+		})
+
+		readErr = xerrors.ErrContinue
+		g.Expect(r.ReadTo(newFlattenStorage())).ToNot(HaveOccurred())
+		g.Expect(r.Ignored()).To(MatchError(xerrors.ErrContinue))
+
+		readErr = context.DeadlineExceeded
+		g.Expect(r.ReadTo(newFlattenStorage())).To(MatchError(context.DeadlineExceeded))
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files := map[string]string{}
+		statFn = func(name string) (fs.FileInfo, error) {
+			if _, ok := files[name]; ok {
+				return &testFileInfo{}, nil
+			}
+			return nil, os.ErrNotExist
+		}
+		readFileFn = func(name string) ([]byte, error) {
+			if v, ok := files[name]; ok {
+				return []byte(v), nil
+			}
+			return nil, os.ErrNotExist
+		}
+		defer func() {
+			statFn = os.Stat
+			readFileFn = os.ReadFile
+		}()
+
+		r := NewOptionalConfigReader(NewFileConfigReaderWithOptions([]string{"local.yaml"}, WithFileProfileFlag(""), WithFileProfileEnv("")))
+		g.Expect(r.ReadTo(newFlattenStorage())).ToNot(HaveOccurred())
+		g.Expect(r.Ignored()).To(HaveOccurred())
+		g.Expect(r.Changed()).To(BeFalse())
+
+		files["local.yaml"] = "k1: v1"
+		g.Expect(r.Changed()).To(BeTrue())
+		g.Expect(r.ReadTo(newFlattenStorage())).ToNot(HaveOccurred())
+		g.Expect(r.Ignored()).ToNot(HaveOccurred())
+		g.Expect(r.Changed()).To(BeFalse())
+
+		delete(files, "local.yaml")
+		g.Expect(r.Changed()).To(BeTrue())
+	})
+
+	t.Run("source errors", func(t *testing.T) {
+		files := map[string]string{
+			"app.yaml":     "k1: v1",
+			"include.yaml": "include: common.yaml",
+		}
+		statFn = func(name string) (fs.FileInfo, error) {
+			if _, ok := files[name]; ok {
+				return &testFileInfo{}, nil
+			}
+			return nil, os.ErrNotExist
+		}
+		readFileFn = func(name string) ([]byte, error) {
+			if v, ok := files[name]; ok {
+				return []byte(v), nil
+			}
+			return nil, os.ErrNotExist
+		}
+		defer func() {
+			statFn = os.Stat
+			readFileFn = os.ReadFile
+		}()
+
+		type testcase struct {
+			desp string
+			r    ConfigReader
+			err  string
+		}
+		testcases := []testcase{
+			{
+				desp: "unknown format",
+				r:    NewFileConfigReaderWithOptions([]string{"app.yaml"}, WithFileFormat("jsn")),
+				err:  "decoder for format 'jsn' not found",
+			},
+			{
+				desp: "missing include",
+				r:    NewFileConfigReader("include.yaml"),
+				err:  "stat file 'common.yaml' failed",
+			},
+			{
+				desp: "missing strict profile",
+				r:    NewFileConfigReaderWithOptions([]string{"app.yaml"}, WithFileProfile("prod"), WithFileProfileStrict(true)),
+				err:  "file 'prod.yaml' of profile 'prod' not found",
+			},
+		}
+
+		for _, tc := range testcases {
+			t.Run(tc.desp, func(t *testing.T) {
+				g := NewWithT(t)
+
+				mgr := NewConfigMgr(NewOptionalConfigReader(tc.r))
+				err := mgr.ReadConfig()
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.err))
+				g.Expect(IsMissing(err)).To(BeFalse())
+			})
+		}
 	})
 }
 
@@ -278,6 +482,114 @@ func TestConfigMgrUnmarshalToStruct(t *testing.T) {
 	})
 }
 
+func TestConfigMgrUnmarshalDeepNested(t *testing.T) {
+	type L3 struct {
+		v1 string `conma:"k1"`
+		V2 int    `conma:"k2:=2"`
+	}
+	type L2 struct {
+		v1 string `conma:"k1"`
+		l3 L3     `conma:"l3"`
+	}
+	type L1 struct {
+		v1 string `conma:"k1"`
+		l2 L2     `conma:"l2"`
+		L2 L2     `conma:"l2x"`
+	}
+	type Root struct {
+		v1 string `conma:"k1"`
+		l1 L1     `conma:"l1"`
+	}
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"k1":              "v0",
+				"l1.k1":           "v1",
+				"l1.l2.k1":        "v2",
+				"l1.l2.l3.k1":     "v3",
+				"l1.l2x.k1":       "v2x",
+				"l1.l2x.l3.k1":    "v3x",
+				"l1.l2x.l3.k2":    "30",
+				"l2.k1":           "wrong",
+				"l2.l3.k1":        "wrong",
+				"l3.k1":           "wrong",
+				"l1.l3.k1":        "wrong",
+				"l1.l2.l3.l4.k1":  "unused",
+				"l1.l2.l3.k1.k2":  "unused",
+				"other.l1.l2.k1":  "unused",
+				"l1.l2.l3.k1[0]":  "unused",
+				"l1.l2x.l3.extra": "unused",
+			},
+		}
+
+		var o Root
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(Root{
+			v1: "v0",
+			l1: L1{
+				v1: "v1",
+				l2: L2{
+					v1: "v2",
+					l3: L3{v1: "v3", V2: 2},
+				},
+				L2: L2{
+					v1: "v2x",
+					l3: L3{v1: "v3x", V2: 30},
+				},
+			},
+		}))
+	})
+
+	t.Run("with sub view", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"app.l1.k1":        "v1",
+				"app.l1.l2.k1":     "v2",
+				"app.l1.l2.l3.k1":  "v3",
+				"app.l1.l2x.k1":    "v2x",
+				"app.l1.l2x.l3.k1": "v3x",
+				"app.k1":           "v0",
+			},
+		}
+
+		var o Root
+		err := mgr.Sub("app").Unmarshal(&o)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(o.l1.l2.l3.v1).To(Equal("v3"))
+		g.Expect(o.l1.L2.l3.v1).To(Equal("v3x"))
+	})
+
+	t.Run("missing deep key", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"k1":           "v0",
+				"l1.k1":        "v1",
+				"l1.l2.k1":     "v2",
+				"l1.l2x.k1":    "v2x",
+				"l1.l2x.l3.k1": "v3x",
+				"l3.k1":        "wrong",
+			},
+		}
+
+		var o Root
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+
+		var fe *FieldError
+		g.Expect(xerrors.As(err, &fe)).To(BeTrue())
+		g.Expect(fe.Key).To(Equal("l1.l2.l3.k1"))
+		g.Expect(o).To(Equal(Root{}))
+	})
+}
+
 func TestConfigMgrUnmarshalStructField(t *testing.T) {
 	t.Run("normal test with struct field", func(t *testing.T) {
 		g := NewWithT(t)
@@ -475,3 +787,226 @@ func TestConfigMgrApplierForStructField(t *testing.T) {
 		g.Expect(applier).To(BeNil())
 	})
 }
+
+type testMode string
+
+func TestConfigMgrUnmarshalConverter(t *testing.T) {
+	g := NewWithT(t)
+
+	// Ignore the duplicate error when the test is run multiple times
+	_ = conv.RegisterConverter(reflect.TypeOf(testMode("")), conv.EnumConverter[testMode]("dev", "prod"))
+
+	type testObj struct {
+		Addr     net.IP              `conma:"addr"`
+		Peers    []net.IP            `conma:"peers"`
+		Started  time.Time           `conma:"started"`
+		Endpoint *url.URL            `conma:"endpoint"`
+		Pattern  *regexp.Regexp      `conma:"pattern"`
+		MaxSize  conv.ByteSize       `conma:"max_size:=10MiB"`
+		Mode     testMode            `conma:"mode"`
+		Modes    map[string]testMode `conma:"modes"`
+		Key      []byte              `conma:"key"`
+		Weights  [3]int              `conma:"weights"`
+		Mask     uint32              `conma:"mask:=0xFF_FF"`
+	}
+
+	mgr := NewConfigMgr(&testConfigReader{
+		fnReadTo: func(r ConfigStorage) error {
+			items := map[string]interface{}{
+				"addr":     "127.0.0.1",
+				"peers":    []string{"10.0.0.1", "10.0.0.2"},
+				"started":  "2023-01-02T03:04:05Z",
+				"endpoint": "http://localhost:8080/api",
+				"pattern":  "^a+$",
+				"mode":     "prod",
+				"modes": map[string]string{
+					"a": "dev",
+				},
+				"key":     []byte("secret"),
+				"weights": []int{1, 2},
+			}
+			for k, v := range items {
+				if err := r.Set(k, v); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	var o testObj
+	g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+	g.Expect(o.Addr).To(Equal(net.ParseIP("127.0.0.1")))
+	g.Expect(o.Peers).To(Equal([]net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}))
+	g.Expect(o.Started).To(Equal(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)))
+	g.Expect(o.Endpoint.String()).To(Equal("http://localhost:8080/api"))
+	g.Expect(o.Pattern.String()).To(Equal("^a+$"))
+	g.Expect(o.MaxSize).To(Equal(10 * conv.MiB))
+	g.Expect(o.Mode).To(Equal(testMode("prod")))
+	g.Expect(o.Modes).To(Equal(map[string]testMode{"a": "dev"}))
+	g.Expect(o.Key).To(Equal([]byte("secret")))
+	g.Expect(o.Weights).To(Equal([3]int{1, 2, 0}))
+	g.Expect(o.Mask).To(Equal(uint32(0xFFFF)))
+
+	// The Marshal will write the same items back
+	s := newFlattenStorage()
+	g.Expect(Marshal(&o, s)).ToNot(HaveOccurred())
+	g.Expect(s.items).To(Equal(map[string]string{
+		"addr":       "127.0.0.1",
+		"peers[0]":   "10.0.0.1",
+		"peers[1]":   "10.0.0.2",
+		"started":    "2023-01-02T03:04:05Z",
+		"endpoint":   "http://localhost:8080/api",
+		"pattern":    "^a+$",
+		"max_size":   "10MiB",
+		"mode":       "prod",
+		"modes.a":    "dev",
+		"key":        "c2VjcmV0",
+		"weights[0]": "1",
+		"weights[1]": "2",
+		"weights[2]": "0",
+		"mask":       "65535",
+	}))
+
+	mgr = NewConfigMgr(&testConfigReader{
+		fnReadTo: func(r ConfigStorage) error {
+			return r.Set("mode", "test")
+		},
+	})
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	var mo struct {
+		Mode testMode `conma:"mode"`
+	}
+	err := mgr.Unmarshal(&mo)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring("must be one of [dev, prod]"))
+}
+
+func TestConfigMgrConversionError(t *testing.T) {
+	g := NewWithT(t)
+
+	mgr := NewConfigMgr(&testConfigReader{
+		fnReadTo: func(r ConfigStorage) error {
+			if err := r.Set("server.port", []string{"80", "abc"}); err != nil {
+				return err
+			}
+			if err := r.Set("server.timeout", "1x"); err != nil {
+				return err
+			}
+			return r.Set("server.weights.a", "x")
+		},
+	})
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	_, err := Get[[]int](mgr, "server.port")
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(Equal(`server.port[1]: "abc" is not an int`))
+
+	var ce *conv.ConversionError
+	g.Expect(xerrors.As(err, &ce)).To(BeTrue())
+	g.Expect(ce.Key).To(Equal("server.port"))
+	g.Expect(ce.Index).To(Equal(1))
+	g.Expect(ce.Input).To(Equal("abc"))
+
+	var o struct {
+		Server struct {
+			Port    []int          `conma:"port"`
+			Timeout time.Duration  `conma:"timeout"`
+			Weights map[string]int `conma:"weights"`
+		} `conma:"server"`
+	}
+	err = mgr.Unmarshal(&o)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(ContainSubstring(`server.port[1]: "abc" is not an int (field Port)`))
+	g.Expect(err.Error()).To(ContainSubstring(`server.timeout: "1x" is not a time.Duration: time: unknown unit "x" in duration "1x" (field Timeout)`))
+	g.Expect(err.Error()).To(ContainSubstring(`server.weights.a: "x" is not an int`))
+}
+
+func TestConfigMgrConcurrent(t *testing.T) {
+	g := NewWithT(t)
+
+	// The reader will set the same version to all keys, so that the half-applied
+	// storage can been detected by unmarshal.
+	var version int64
+	reader := func() ConfigReader {
+		return &testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				v := strconv.FormatInt(atomic.AddInt64(&version, 1), 10)
+				for _, k := range []string{"k1", "k2", "p.k3"} {
+					if err := r.Set(k, v); err != nil {
+						return err
+					}
+				}
+				return r.Set("list", []string{v, v})
+			},
+		}
+	}
+
+	type testObj struct {
+		K1   string   `conma:"k1"`
+		K2   string   `conma:"k2"`
+		K3   string   `conma:"p.k3"`
+		List []string `conma:"list"`
+	}
+	check := func(o *testObj) {
+		g.Expect(o.K2).To(Equal(o.K1))
+		g.Expect(o.K3).To(Equal(o.K1))
+		g.Expect(o.List).To(Equal([]string{o.K1, o.K1}))
+	}
+
+	mgr := NewConfigMgr(reader())
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	var bound testObj
+	g.Expect(mgr.Bind(&bound)).ToNot(HaveOccurred())
+
+	var wg sync.WaitGroup
+	run := func(n int, fn func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				fn(i)
+			}
+		}()
+	}
+
+	run(50, func(i int) {
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	})
+	run(50, func(i int) {
+		g.Expect(mgr.Reload()).ToNot(HaveOccurred())
+	})
+	run(10, func(i int) {
+		mgr.AddConfigReader(reader())
+	})
+	run(100, func(i int) {
+		var o testObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		check(&o)
+	})
+	run(100, func(i int) {
+		g.Expect(mgr.Sub("p").Unmarshal(&struct {
+			K3 string `conma:"k3"`
+		}{})).ToNot(HaveOccurred())
+		_, err := Get[string](mgr, "k1")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(mgr.IsSet("p")).To(BeTrue())
+		g.Expect(mgr.Keys("p")).To(Equal([]string{"p.k3"}))
+		_ = mgr.Dump()
+		_ = mgr.UnusedKeys("")
+		_, err = mgr.Explain("k1")
+		g.Expect(err).ToNot(HaveOccurred())
+		_, err = mgr.Export(FormatJSON)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	run(20, func(i int) {
+		cancel := mgr.Subscribe("", func(changes []Change) {})
+		cancel()
+	})
+	wg.Wait()
+
+	var o testObj
+	g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+	check(&o)
+}
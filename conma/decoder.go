@@ -0,0 +1,195 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// Decoder will decode the file content to map, the values in map
+// will been flattened by ConfigStorage.Set.
+type Decoder func(data []byte) (map[string]interface{}, error)
+
+const (
+	// FormatYAML is the format name for yaml file
+	FormatYAML = "yaml"
+
+	// FormatJSON is the format name for json file
+	FormatJSON = "json"
+
+	// FormatTOML is the format name for toml file
+	FormatTOML = "toml"
+
+	// FormatDotenv is the format name for dotenv file
+	FormatDotenv = "dotenv"
+)
+
+// decoderRegistry is the registry of Decoder by format name and
+// file extension.
+type decoderRegistry struct {
+	mu       sync.RWMutex
+	decoders map[string]Decoder
+	exts     map[string]string
+}
+
+var (
+	defaultDecoderRegistry = &decoderRegistry{
+		decoders: map[string]Decoder{},
+		exts:     map[string]string{},
+	}
+)
+
+// RegisterDecoder will register the decoder for format, the file with
+// one of exts (such as '.yaml') will been decoded by it automatically.
+// It will return duplicate error if the format or ext is registered.
+func RegisterDecoder(format string, d Decoder, exts ...string) error {
+	return defaultDecoderRegistry.Register(format, d, exts...)
+}
+
+func (r *decoderRegistry) Register(format string, d Decoder, exts ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.decoders[format]; ok {
+		return xerrors.WrapDuplicate("decoder for format '%s' is already registered", format)
+	}
+	for _, ext := range exts {
+		if f, ok := r.exts[strings.ToLower(ext)]; ok {
+			return xerrors.WrapDuplicate("ext '%s' is already registered by format '%s'", ext, f)
+		}
+	}
+
+	r.decoders[format] = d
+	for _, ext := range exts {
+		r.exts[strings.ToLower(ext)] = format
+	}
+	return nil
+}
+
+// Lookup will return the decoder for format.
+func (r *decoderRegistry) Lookup(format string) (Decoder, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	d, ok := r.decoders[format]
+	if !ok {
+		return nil, xerrors.WrapNotFound("decoder for format '%s' not found", format)
+	}
+	return d, nil
+}
+
+// Detect will return the format of file by it's extension, if the
+// extension is not registered, the FormatYAML is returned.
+func (r *decoderRegistry) Detect(file string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if f, ok := r.exts[strings.ToLower(filepath.Ext(file))]; ok {
+		return f
+	}
+	return FormatYAML
+}
+
+func decodeYAML(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	err := yaml.Unmarshal(data, &m)
+	if err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func decodeJSON(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+
+	// Use json.Number to avoid the precision loss of big integer
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	return normalizeDecoded(m).(map[string]interface{}), nil
+}
+
+func decodeTOML(data []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+
+	return normalizeDecoded(m).(map[string]interface{}), nil
+}
+
+// normalizeDecoded will convert the values which cannot been handled by
+// conv.ToString (such as json.Number and time.Time) to string.
+func normalizeDecoded(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vv {
+			vv[k] = normalizeDecoded(e)
+		}
+		return vv
+	case []interface{}:
+		for i, e := range vv {
+			vv[i] = normalizeDecoded(e)
+		}
+		return vv
+	case []map[string]interface{}:
+		for _, e := range vv {
+			normalizeDecoded(e)
+		}
+		return vv
+	case json.Number:
+		return vv.String()
+	case time.Time:
+		return vv.Format(time.RFC3339Nano)
+	}
+
+	return v
+}
+
+func init() {
+	for _, v := range []struct {
+		format string
+		d      Decoder
+		exts   []string
+	}{
+		{format: FormatYAML, d: decodeYAML, exts: []string{".yaml", ".yml"}},
+		{format: FormatJSON, d: decodeJSON, exts: []string{".json"}},
+		{format: FormatTOML, d: decodeTOML, exts: []string{".toml"}},
+		{format: FormatDotenv, d: decodeDotenv, exts: []string{".env"}},
+	} {
+		if err := RegisterDecoder(v.format, v.d, v.exts...); err != nil {
+			panic(err)
+		}
+	}
+}
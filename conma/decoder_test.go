@@ -0,0 +1,150 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestDecoderRegistry(t *testing.T) {
+	t.Run("register & lookup", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := &decoderRegistry{
+			decoders: map[string]Decoder{},
+			exts:     map[string]string{},
+		}
+		err := r.Register("test", func(data []byte) (map[string]interface{}, error) {
+			return map[string]interface{}{"k1": string(data)}, nil
+		}, ".Test")
+		g.Expect(err).ToNot(HaveOccurred())
+
+		d, err := r.Lookup("test")
+		g.Expect(err).ToNot(HaveOccurred())
+		m, err := d([]byte("v1"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(m).To(Equal(map[string]interface{}{"k1": "v1"}))
+
+		g.Expect(r.Detect("/etc/app.test")).To(Equal("test"))
+		g.Expect(r.Detect("/etc/app.unknown")).To(Equal(FormatYAML))
+	})
+
+	t.Run("duplicate format", func(t *testing.T) {
+		g := NewWithT(t)
+
+		err := RegisterDecoder(FormatJSON, decodeJSON)
+		g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+	})
+
+	t.Run("duplicate ext", func(t *testing.T) {
+		g := NewWithT(t)
+
+		err := RegisterDecoder("json5", decodeJSON, ".json")
+		g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+
+		_, err = defaultDecoderRegistry.Lookup("json5")
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("builtin formats", func(t *testing.T) {
+		g := NewWithT(t)
+
+		g.Expect(defaultDecoderRegistry.Detect("a.yml")).To(Equal(FormatYAML))
+		g.Expect(defaultDecoderRegistry.Detect("a.YAML")).To(Equal(FormatYAML))
+		g.Expect(defaultDecoderRegistry.Detect("a.json")).To(Equal(FormatJSON))
+		g.Expect(defaultDecoderRegistry.Detect("a.toml")).To(Equal(FormatTOML))
+		g.Expect(defaultDecoderRegistry.Detect(".env")).To(Equal(FormatDotenv))
+		g.Expect(defaultDecoderRegistry.Detect("prod.env")).To(Equal(FormatDotenv))
+	})
+}
+
+func TestDecodeJSON(t *testing.T) {
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m, err := decodeJSON([]byte(`{
+  "k1": "v1",
+  "k2": 9007199254740993,
+  "k3": {"k4": [1.5, true]}
+}`))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(m).To(Equal(map[string]interface{}{
+			"k1": "v1",
+			"k2": "9007199254740993",
+			"k3": map[string]interface{}{
+				"k4": []interface{}{"1.5", true},
+			},
+		}))
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := decodeJSON([]byte(`{"k1": `))
+		g.Expect(err).To(HaveOccurred())
+	})
+}
+
+func TestDecodeTOML(t *testing.T) {
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+
+		m, err := decodeTOML([]byte(`
+k1 = "v1"
+k2 = 10
+t1 = 2023-01-02T03:04:05Z
+
+[k3]
+k4 = ["a", "b"]
+
+[[k5]]
+k6 = "v6"
+`))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(m).To(Equal(map[string]interface{}{
+			"k1": "v1",
+			"k2": int64(10),
+			"t1": "2023-01-02T03:04:05Z",
+			"k3": map[string]interface{}{
+				"k4": []interface{}{"a", "b"},
+			},
+			"k5": []map[string]interface{}{
+				{"k6": "v6"},
+			},
+		}))
+
+		s := newFlattenStorage()
+		for k, v := range m {
+			g.Expect(s.Set(k, v)).ToNot(HaveOccurred())
+		}
+		g.Expect(s.items).To(HaveKeyWithValue("k5[0].k6", "v6"))
+	})
+
+	t.Run("invalid toml", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := decodeTOML([]byte(`k1 = `))
+		g.Expect(err).To(HaveOccurred())
+	})
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// decodeDotenv will decode the dotenv file content, the key and value is
+// mapped as same as envConfigReader, except that the quoted value will
+// never been split by comma. The supported syntax is:
+//  1. KEY=value, the leading 'export ' is allowed
+//  2. empty line and the line starts with '#' is ignored
+//  3. KEY="value", the escape sequence '\n', '\r', '\t', '\"' and '\\' is supported
+//  4. KEY='value', the value is used literally
+//  5. KEY=value # comment, the inline comment of unquoted value is ignored
+func decodeDotenv(data []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, xerrors.Errorf("dotenv line %d: missing '=' in '%s'", lineNo, line)
+		}
+
+		key := strings.TrimSpace(kv[0])
+		if key == "" {
+			return nil, xerrors.Errorf("dotenv line %d: empty key", lineNo)
+		}
+
+		value, quoted, err := parseDotenvValue(strings.TrimSpace(kv[1]))
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "dotenv line %d", lineNo)
+		}
+
+		if quoted {
+			m[envKey(key)] = value
+		} else {
+			m[envKey(key)] = envValue(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func parseDotenvValue(raw string) (value string, quoted bool, err error) {
+	if raw == "" {
+		return "", false, nil
+	}
+
+	switch raw[0] {
+	case '\'':
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", false, xerrors.Errorf("unterminated single-quoted value")
+		}
+		if err := checkDotenvTrailing(raw[end+2:]); err != nil {
+			return "", false, err
+		}
+		return raw[1 : end+1], true, nil
+	case '"':
+		var sb strings.Builder
+		for i := 1; i < len(raw); i++ {
+			c := raw[i]
+			switch {
+			case c == '"':
+				if err := checkDotenvTrailing(raw[i+1:]); err != nil {
+					return "", false, err
+				}
+				return sb.String(), true, nil
+			case c == '\\' && i+1 < len(raw):
+				i++
+				switch raw[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 'r':
+					sb.WriteByte('\r')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(raw[i])
+				}
+			default:
+				sb.WriteByte(c)
+			}
+		}
+		return "", false, xerrors.Errorf("unterminated double-quoted value")
+	}
+
+	if idx := strings.Index(raw, " #"); idx >= 0 {
+		raw = raw[:idx]
+	}
+	return strings.TrimSpace(raw), false, nil
+}
+
+// checkDotenvTrailing will ensure there is only space or comment
+// after the quoted value.
+func checkDotenvTrailing(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "#") {
+		return nil
+	}
+
+	return xerrors.Errorf("unexpected '%s' after quoted value", s)
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestDecodeDotenv(t *testing.T) {
+	type testCase struct {
+		desp   string
+		data   string
+		err    string
+		expect map[string]interface{}
+	}
+	testCases := []testCase{
+		{
+			desp: "normal test",
+			data: `
+# comment
+K1=v1
+export K1_K2 = v2
+K3=v3,v4
+K4=
+`,
+			expect: map[string]interface{}{
+				"k1":    "v1",
+				"k1.k2": "v2",
+				"k3":    []string{"v3", "v4"},
+				"k4":    "",
+			},
+		},
+		{
+			desp: "quoted value",
+			data: `
+K1="v1,v2 # not comment"
+K2='v\n2'
+K3="line1\nline2\t\"q\"" # comment
+K4=v4 # comment
+`,
+			expect: map[string]interface{}{
+				"k1": "v1,v2 # not comment",
+				"k2": `v\n2`,
+				"k3": "line1\nline2\t\"q\"",
+				"k4": "v4",
+			},
+		},
+		{
+			desp: "missing equal",
+			data: "K1=v1\nK2",
+			err:  "dotenv line 2: missing '=' in 'K2'",
+		},
+		{
+			desp: "empty key",
+			data: "=v1",
+			err:  "dotenv line 1: empty key",
+		},
+		{
+			desp: "unterminated double quote",
+			data: `K1="v1`,
+			err:  "dotenv line 1: unterminated double-quoted value",
+		},
+		{
+			desp: "unterminated single quote",
+			data: `K1='v1`,
+			err:  "dotenv line 1: unterminated single-quoted value",
+		},
+		{
+			desp: "trailing after quote",
+			data: `K1="v1" v2`,
+			err:  "dotenv line 1: unexpected 'v2' after quoted value",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			m, err := decodeDotenv([]byte(tc.data))
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(HavePrefix(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(m).To(Equal(tc.expect))
+		})
+	}
+}
@@ -22,11 +22,53 @@ package conma
 import (
 	"os"
 	"strings"
+
+	"github.com/lsytj0413/ena"
 )
 
 // envConfigReader will read all available and
 // related envs to config storage.
 type envConfigReader struct {
+	// prefix is the required prefix of env name, the env without it
+	// is ignored, and it's stripped before map to key.
+	prefix string
+
+	// opt is the option of reader, the zero value is the default behavior
+	opt envReaderOption
+}
+
+type envReaderOption struct {
+	// KeyMapper will map the env name (with prefix stripped) to configuration key.
+	// Default: lowercase the name and replace '_' with '.'
+	KeyMapper func(name string) string
+
+	// KeepCommaValues will keep the comma-separated value as scalar,
+	// instead of split it to slice.
+	// Default: false
+	KeepCommaValues bool
+}
+
+// WithEnvKeyMapper will set the key mapper option, see NestedEnvKeyMapper
+func WithEnvKeyMapper(fn func(name string) string) ena.Option[envReaderOption] {
+	return ena.NewFnOption(func(opt *envReaderOption) {
+		opt.KeyMapper = fn
+	})
+}
+
+// WithEnvKeepCommaValues will set the keep comma values option
+func WithEnvKeepCommaValues(keep bool) ena.Option[envReaderOption] {
+	return ena.NewFnOption(func(opt *envReaderOption) {
+		opt.KeepCommaValues = keep
+	})
+}
+
+// NestedEnvKeyMapper return the key mapper which lowercase the name and
+// replace sep with '.', so the single '_' can been kept in key, such as
+// 'DB__MAX_CONNS' is mapped to 'db.max_conns' with sep '__'.
+func NestedEnvKeyMapper(sep string) func(name string) string {
+	return func(name string) string {
+		return strings.Join(strings.Split(strings.ToLower(name), sep), ".")
+	}
 }
 
 var (
@@ -34,11 +76,24 @@ var (
 	environFn = os.Environ
 )
 
-// NewEnvConfigReader return an env reader
+// NewEnvConfigReader return an env reader, it will read all envs
 func NewEnvConfigReader() ConfigReader {
 	return &envConfigReader{}
 }
 
+// NewScopedEnvConfigReader return an env reader which only read the env
+// with prefix (such as 'MYAPP_'), the prefix is stripped before map to key.
+func NewScopedEnvConfigReader(prefix string, opts ...ena.Option[envReaderOption]) ConfigReader {
+	r := &envConfigReader{
+		prefix: prefix,
+	}
+	for _, o := range opts {
+		o.Apply(&r.opt)
+	}
+
+	return r
+}
+
 // ReadTo will implement ConfigReader.ReadTo method, it will
 // 1. read all envs
 // 2. filter by user-defined machinism
@@ -51,23 +106,47 @@ func (r *envConfigReader) ReadTo(store ConfigStorage) error {
 			continue
 		}
 
-		key := func(key string) string {
-			return strings.ReplaceAll(strings.ToLower(key), "_", ".")
-		}(kvArr[0])
-
-		values := strings.Split(kvArr[1], ",")
-		if len(values) > 1 {
-			err := store.Set(key, values)
-			if err != nil {
-				return err
-			}
-		} else {
-			err := store.Set(key, kvArr[1])
-			if err != nil {
-				return err
-			}
+		name, ok := strings.CutPrefix(kvArr[0], r.prefix)
+		if !ok || (r.prefix != "" && name == "") {
+			continue
+		}
+
+		var value interface{} = kvArr[1]
+		if !r.opt.KeepCommaValues {
+			value = envValue(kvArr[1])
+		}
+
+		src := Source{Reader: SourceEnv, Detail: kvArr[0]}
+		err := withSource(store, src).Set(r.key(name), value)
+		if err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
+
+func (r *envConfigReader) key(name string) string {
+	if r.opt.KeyMapper != nil {
+		return r.opt.KeyMapper(name)
+	}
+
+	return envKey(name)
+}
+
+// envKey will convert the env name to configuration key, it will
+// lowercase the name and replace '_' with '.'
+func envKey(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "_", ".")
+}
+
+// envValue will split the comma-separated env value to slice,
+// the value without comma will return as it is.
+func envValue(value string) interface{} {
+	values := strings.Split(value, ",")
+	if len(values) > 1 {
+		return values
+	}
+
+	return value
+}
@@ -20,6 +20,7 @@
 package conma
 
 import (
+	"os"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -147,3 +148,85 @@ func TestEnvConfigReaderReadTo(t *testing.T) {
 		}))
 	})
 }
+
+func TestScopedEnvConfigReaderReadTo(t *testing.T) {
+	environFn = func() []string {
+		return []string{
+			"PATH=/usr/bin",
+			"HOME=/root",
+			"MYAPP_=v0",
+			"MYAPP_NAME=n1",
+			"MYAPP_DB__HOST=h1",
+			"MYAPP_DB__MAX_CONNS=10",
+			"MYAPP_DB__PEERS=p1,p2",
+			"myapp_lower=ignored",
+		}
+	}
+	defer func() {
+		environFn = os.Environ
+	}()
+
+	t.Run("default mapper", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s := newFlattenStorage()
+		r := NewScopedEnvConfigReader("MYAPP_")
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name":          "n1",
+			"db..host":      "h1",
+			"db..max.conns": "10",
+			"db..peers[0]":  "p1",
+			"db..peers[1]":  "p2",
+		}))
+		g.Expect(s.sources["name"]).To(Equal(Source{Reader: SourceEnv, Detail: "MYAPP_NAME"}))
+	})
+
+	t.Run("nested mapper & keep comma values", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s := newFlattenStorage()
+		r := NewScopedEnvConfigReader("MYAPP_",
+			WithEnvKeyMapper(NestedEnvKeyMapper("__")),
+			WithEnvKeepCommaValues(true),
+		)
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name":         "n1",
+			"db.host":      "h1",
+			"db.max_conns": "10",
+			"db.peers":     "p1,p2",
+		}))
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		g := NewWithT(t)
+
+		type testObj struct {
+			Name string `conma:"name"`
+			DB   struct {
+				MaxConns int      `conma:"max_conns"`
+				Peers    []string `conma:"peers"`
+			} `conma:"db"`
+		}
+
+		mgr := NewConfigMgr(NewScopedEnvConfigReader("MYAPP_", WithEnvKeyMapper(NestedEnvKeyMapper("__"))))
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		g.Expect(mgr.IsSet("path")).To(BeFalse())
+
+		var o testObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o.Name).To(Equal("n1"))
+		g.Expect(o.DB.MaxConns).To(Equal(10))
+		g.Expect(o.DB.Peers).To(Equal([]string{"p1", "p2"}))
+	})
+}
+
+func TestNestedEnvKeyMapper(t *testing.T) {
+	g := NewWithT(t)
+
+	fn := NestedEnvKeyMapper("__")
+	g.Expect(fn("DB__MAX_CONNS")).To(Equal("db.max_conns"))
+	g.Expect(fn("A__B__C")).To(Equal("a.b.c"))
+	g.Expect(fn("NAME")).To(Equal("name"))
+}
@@ -24,19 +24,27 @@ import (
 	"strings"
 
 	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
 )
 
 // FieldDescriptor is the descriptor for conma struct field
 // The struct tag must format as:
-//  1. `conma:"name:=default"` for config field
+//  1. `conma:"name:=default"` for config field, the default of struct, map
+//     and slice of struct field must be empty, which means it's optional
+//  2. `validate:"required,min=1,max=10"` for the constraints of field value, see ValidateRule
+//  3. `short:"p"` for the short command line flag name
+//  4. `desc:"the description"` for the help and document of field
 type FieldDescriptor struct {
 	FieldIndex int
 	FieldName  string
 	Typ        reflect.Type
 	Unexported bool
 
-	Name    string
-	Default *string
+	Name        string
+	Default     *string
+	Rules       []*ValidateRule
+	Short       string
+	Description string
 }
 
 // NewFieldDescriptor ...
@@ -57,6 +65,79 @@ func NewFieldDescriptor(field reflect.StructField, idx int) (*FieldDescriptor, e
 	fd.Name = vv[0]
 	if len(vv) > 1 {
 		fd.Default = ena.PointerTo(vv[1])
+		if vv[1] != "" && (isStructType(field.Type) || isCompositeType(field.Type)) {
+			// The value of these fields is built from multiple items, it
+			// cannot been parsed from single default string
+			return nil, xerrors.Errorf("invalid default of field '%s', the default of %s must be empty", field.Name, field.Type.String())
+		}
 	}
+
+	if vtag, ok := field.Tag.Lookup("validate"); ok {
+		rules, err := parseValidateRules(vtag, field.Type)
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "invalid validate tag of field '%s'", field.Name)
+		}
+		fd.Rules = rules
+	}
+
+	fd.Short = field.Tag.Get("short")
+	fd.Description = field.Tag.Get("desc")
 	return fd, nil
 }
+
+// walkStruct will visit all conma fields of struct typ with the full key,
+// it will dive into the nested struct and pointer to struct field after
+// visit it, and the fields of untagged embedded struct is promoted to prefix.
+// The field with invalid tag is skipped.
+func walkStruct(typ reflect.Type, prefix string, fn func(key string, fd *FieldDescriptor)) {
+	_ = walkStructE(typ, prefix, func(key string, fd *FieldDescriptor, err error) error {
+		if err == nil {
+			fn(key, fd)
+		}
+		return nil
+	})
+}
+
+// walkStructE is the walkStruct which will visit the field with invalid tag
+// by the err (and nil fd), the walk is stopped when fn return error.
+func walkStructE(typ reflect.Type, prefix string, fn func(key string, fd *FieldDescriptor, err error) error) error {
+	for idx := 0; idx < typ.NumField(); idx++ {
+		field := typ.Field(idx)
+		fd, err := NewFieldDescriptor(field, idx)
+		if err != nil {
+			if err := fn(prefix, nil, err); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if fd == nil {
+			ftyp := field.Type
+			if ftyp.Kind() == reflect.Ptr {
+				ftyp = ftyp.Elem()
+			}
+			if field.Anonymous && ftyp.Kind() == reflect.Struct {
+				if err := walkStructE(ftyp, prefix, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		key := joinKey(prefix, fd.Name)
+		if err := fn(key, fd, nil); err != nil {
+			return err
+		}
+		switch {
+		case isStructType(fd.Typ):
+			err = walkStructE(fd.Typ, key, fn)
+		case isStructPtrType(fd.Typ):
+			err = walkStructE(fd.Typ.Elem(), key, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
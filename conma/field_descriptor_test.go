@@ -85,6 +85,121 @@ func TestNewFieldDescriptor(t *testing.T) {
 			},
 			err: ``,
 		},
+		{
+			desp: "with validate tag",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(1),
+				Tag:  reflect.StructTag(`conma:"k" validate:"required,min=1"`),
+			},
+			idx: 0,
+			fd: &FieldDescriptor{
+				FieldIndex: 0,
+				FieldName:  "1",
+				Typ:        reflect.TypeOf(1),
+				Unexported: false,
+				Name:       "k",
+				Default:    nil,
+				Rules: []*ValidateRule{
+					{Name: RuleRequired},
+					{Name: RuleMin, Arg: "1", bound: 1},
+				},
+			},
+			err: ``,
+		},
+		{
+			desp: "with short & desc tag",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(1),
+				Tag:  reflect.StructTag(`conma:"k:=1" short:"p" desc:"the port"`),
+			},
+			idx: 0,
+			fd: &FieldDescriptor{
+				FieldIndex:  0,
+				FieldName:   "1",
+				Typ:         reflect.TypeOf(1),
+				Unexported:  false,
+				Name:        "k",
+				Default:     ena.PointerTo("1"),
+				Short:       "p",
+				Description: "the port",
+			},
+			err: ``,
+		},
+		{
+			desp: "invalid validate tag",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(1),
+				Tag:  reflect.StructTag(`conma:"k" validate:"min=a"`),
+			},
+			idx: 0,
+			fd:  nil,
+			err: `invalid validate tag of field '1'`,
+		},
+		{
+			desp: "empty default of map",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(map[string]string{}),
+				Tag:  reflect.StructTag(`conma:"k:="`),
+			},
+			idx: 0,
+			fd: &FieldDescriptor{
+				FieldIndex: 0,
+				FieldName:  "1",
+				Typ:        reflect.TypeOf(map[string]string{}),
+				Unexported: false,
+				Name:       "k",
+				Default:    ena.PointerTo(""),
+			},
+			err: ``,
+		},
+		{
+			desp: "invalid default of map",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(map[string]string{}),
+				Tag:  reflect.StructTag(`conma:"k:=a=1"`),
+			},
+			idx: 0,
+			fd:  nil,
+			err: `invalid default of field '1', the default of map\[string\]string must be empty`,
+		},
+		{
+			desp: "invalid default of slice of struct",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf([]testUpstream{}),
+				Tag:  reflect.StructTag(`conma:"k:=h1"`),
+			},
+			idx: 0,
+			fd:  nil,
+			err: `invalid default of field '1', the default of \[\]conma.testUpstream must be empty`,
+		},
+		{
+			desp: "invalid default of struct",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(testTLSConfig{}),
+				Tag:  reflect.StructTag(`conma:"k:=c1"`),
+			},
+			idx: 0,
+			fd:  nil,
+			err: `invalid default of field '1', the default of conma.testTLSConfig must be empty`,
+		},
+		{
+			desp: "validate tag of nested struct",
+			field: reflect.StructField{
+				Name: "1",
+				Type: reflect.TypeOf(testTLSConfig{}),
+				Tag:  reflect.StructTag(`conma:"k" validate:"required"`),
+			},
+			idx: 0,
+			fd:  nil,
+			err: `invalid validate tag of field '1': required rule is not supported by nested struct`,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.desp, func(t *testing.T) {
@@ -21,48 +21,407 @@ package conma
 
 import (
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
 )
 
 // fileConfigReader will read all configuration items
 // from file to config storage.
 type fileConfigReader struct {
 	files []string
+	opt   *fileReaderOption
+
+	// stats is the file stat when last ReadTo, include the included
+	// and profile files, it's used to detect the modification of file.
+	// It's protected by statsMu, because the Changed is called by Watch
+	// concurrently with ReadTo.
+	statsMu sync.RWMutex
+	stats   map[string]fileStat
+}
+
+const (
+	// includeKey is the key of file which include other files, the
+	// value is the path or list of paths relative to the file.
+	includeKey = "include"
+)
+
+type fileStat struct {
+	modTime time.Time
+	size    int64
 }
 
 var (
 	// for unittest
 	readFileFn = os.ReadFile
+	statFn     = os.Stat
 )
 
-// NewFileConfigReader will return an file reader
+type fileReaderOption struct {
+	// Format is the format name of all files, it's used to lookup the
+	// Decoder. If it's empty, the format will been detected by file
+	// extension.
+	// Default: ""
+	Format string
+
+	// Profile is the profile name, such as 'prod' or 'prod-eu'. The profile
+	// files are read after all files, each '-' separated layer is a file in
+	// the directory of first file with the same extension, for example the
+	// profile 'prod-eu' of 'conf/base.yaml' will read 'conf/prod.yaml' and
+	// 'conf/prod-eu.yaml'. The missing layer is skipped, see ProfileStrict.
+	// If it's empty, the ProfileFlag and ProfileEnv is used.
+	// Default: ""
+	Profile string
+
+	// ProfileFlag is the command line flag name to select the profile, such
+	// as 'profile' for '--profile=prod', empty means disable it.
+	// Default: ""
+	ProfileFlag string
+
+	// ProfileEnv is the env name to select the profile when the ProfileFlag
+	// is not present, such as 'APP_PROFILE', empty means disable it.
+	// Default: ""
+	ProfileEnv string
+
+	// ProfileStrict will report error if the last layer of profile is
+	// missing, and the Optional is false.
+	// Default: false
+	ProfileStrict bool
+
+	// MergeRules is the MergeRule of keys when it's declared by multiple
+	// files, the key without rule use MergeDefault.
+	// Default: empty
+	MergeRules map[string]MergeRule
+
+	// Optional will skip the missing files, include the last profile
+	// layer, the included file is still required.
+	// Default: false
+	Optional bool
+}
+
+func defaultFileReaderOption() *fileReaderOption {
+	return &fileReaderOption{
+		Format:        "",
+		Profile:       "",
+		ProfileFlag:   "",
+		ProfileEnv:    "",
+		ProfileStrict: false,
+		MergeRules:    map[string]MergeRule{},
+		Optional:      false,
+	}
+}
+
+// WithFileFormat will set the format option, such as FormatJSON
+func WithFileFormat(format string) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.Format = format
+	})
+}
+
+// WithFileProfile will set the profile option
+func WithFileProfile(profile string) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.Profile = profile
+	})
+}
+
+// WithFileProfileFlag will set the profile flag option
+func WithFileProfileFlag(name string) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.ProfileFlag = name
+	})
+}
+
+// WithFileProfileEnv will set the profile env option
+func WithFileProfileEnv(name string) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.ProfileEnv = name
+	})
+}
+
+// WithFileProfileStrict will set the profile strict option
+func WithFileProfileStrict(strict bool) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.ProfileStrict = strict
+	})
+}
+
+// WithFileMergeRule will set the MergeRule of key, such as 'servers'
+func WithFileMergeRule(key string, rule MergeRule) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		if opt.MergeRules == nil {
+			opt.MergeRules = map[string]MergeRule{}
+		}
+		opt.MergeRules[key] = rule
+	})
+}
+
+// WithFileOptional will set the optional option
+func WithFileOptional(optional bool) ena.Option[fileReaderOption] {
+	return ena.NewFnOption(func(opt *fileReaderOption) {
+		opt.Optional = optional
+	})
+}
+
+// NewFileConfigReader will return an file reader, the format of
+// file is detected by it's extension.
 func NewFileConfigReader(files ...string) ConfigReader {
+	return NewFileConfigReaderWithOptions(files)
+}
+
+// NewFileConfigReaderWithOptions will return an file reader with options
+func NewFileConfigReaderWithOptions(files []string, opts ...ena.Option[fileReaderOption]) ConfigReader {
+	opt := defaultFileReaderOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
 	return &fileConfigReader{
 		files: files,
+		opt:   opt,
+		stats: map[string]fileStat{},
 	}
 }
 
+// ReadTo will implement ConfigReader.ReadTo method, it will
+// 1. read all files and the profile files, the included files is read
+// before the file which include it
+// 2. merge the files by MergeRules, the later one override the previous
+// 3. persistent the merged configuration items to ConfigStore
 func (r *fileConfigReader) ReadTo(store ConfigStorage) error {
-	for _, file := range r.files {
-		data, err := readFileFn(file)
+	files, err := r.profileFiles()
+	if err != nil {
+		return err
+	}
+	files = append(append([]string{}, r.files...), files...)
+
+	stats := map[string]fileStat{}
+	var merged interface{} = map[string]interface{}{}
+	for _, file := range files {
+		if r.opt.Optional {
+			if _, err := statFn(file); os.IsNotExist(err) {
+				continue
+			}
+		}
+
+		v, err := r.load(file, nil, stats)
 		if err != nil {
 			return err
 		}
+		merged = mergeValue(r.opt.MergeRules, "", merged, v)
+	}
+
+	r.statsMu.Lock()
+	r.stats = stats
+	r.statsMu.Unlock()
+
+	// All files is set in one write session, so that the lists is merged
+	// by the MergeRules of reader only.
+	return setSourcedValue(withSource(store, Source{Reader: SourceFile}), "", merged)
+}
+
+// load will read the file and it's included files, the stack is the
+// including files for cycle detection.
+func (r *fileConfigReader) load(file string, stack []string, stats map[string]fileStat) (interface{}, error) {
+	file = filepath.Clean(file)
+	for i, f := range stack {
+		if f == file {
+			return nil, xerrors.Errorf("include cycle detected: %s", strings.Join(append(stack[i:], file), " -> "))
+		}
+	}
+	stack = append(stack, file)
+
+	stat, err := r.stat(file)
+	if err != nil {
+		if len(stack) == 1 && os.IsNotExist(err) {
+			// Only the file itself is missing, the included file is required
+			return nil, xerrors.Errorf("stat file '%s' failed: %w: %w", file, ErrMissing, err)
+		}
+		return nil, xerrors.Wrapf(err, "stat file '%s' failed", file)
+	}
+	data, err := readFileFn(file)
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "read file '%s' failed", file)
+	}
+	stats[file] = stat
+
+	m, err := r.decode(file, data)
+	if err != nil {
+		return nil, xerrors.Wrapf(err, "decode file '%s' failed", file)
+	}
+	includes, err := parseIncludes(file, m[includeKey])
+	if err != nil {
+		return nil, err
+	}
+	delete(m, includeKey)
+
+	var merged interface{} = map[string]interface{}{}
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(file), inc)
+		}
 
-		var m map[string]interface{}
-		err = yaml.Unmarshal(data, &m)
+		v, err := r.load(inc, stack, stats)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		merged = mergeValue(r.opt.MergeRules, "", merged, v)
+	}
+
+	v, err := withFileSource(m, file)
+	if err != nil {
+		return nil, err
+	}
+	return mergeValue(r.opt.MergeRules, "", merged, v), nil
+}
+
+func parseIncludes(file string, v interface{}) ([]string, error) {
+	switch vv := v.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []string{vv}, nil
+	case []interface{}:
+		includes := make([]string, 0, len(vv))
+		for _, e := range vv {
+			s, ok := e.(string)
+			if !ok {
+				return nil, xerrors.Errorf("invalid include '%v' in file '%s', must be string", e, file)
+			}
+			includes = append(includes, s)
 		}
+		return includes, nil
+	}
+
+	return nil, xerrors.Errorf("invalid include '%v' in file '%s', must be string or list of string", v, file)
+}
 
-		for k, v := range m {
-			err = store.Set(k, v)
-			if err != nil {
-				return err
+// profile return the selected profile by option, command line flag or env.
+func (r *fileConfigReader) profile() string {
+	if r.opt.Profile != "" {
+		return r.opt.Profile
+	}
+
+	if r.opt.ProfileFlag != "" {
+		args := argsFn()
+		for i, arg := range args {
+			if arg == "--" {
+				break
+			}
+			name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+			if !strings.HasPrefix(arg, "-") || name != r.opt.ProfileFlag {
+				continue
+			}
+			if hasValue {
+				return value
 			}
+			if i+1 < len(args) {
+				return args[i+1]
+			}
+		}
+	}
+
+	if r.opt.ProfileEnv != "" {
+		if v, ok := lookupEnvFn(r.opt.ProfileEnv); ok {
+			return v
 		}
 	}
+	return ""
+}
+
+// profileFiles return the existing layer files of the selected profile.
+func (r *fileConfigReader) profileFiles() ([]string, error) {
+	profile := r.profile()
+	if profile == "" || len(r.files) == 0 {
+		return nil, nil
+	}
+
+	dir, ext := filepath.Dir(r.files[0]), filepath.Ext(r.files[0])
+	parts := strings.Split(profile, "-")
+	files := []string{}
+	for i := range parts {
+		file := filepath.Join(dir, strings.Join(parts[:i+1], "-")+ext)
+		_, err := statFn(file)
+		switch {
+		case err == nil:
+			files = append(files, file)
+		case !os.IsNotExist(err):
+			return nil, err
+		case i == len(parts)-1 && r.opt.ProfileStrict && !r.opt.Optional:
+			return nil, xerrors.WrapNotFound("file '%s' of profile '%s' not found", file, profile)
+		}
+	}
+
+	return files, nil
+}
+
+func (r *fileConfigReader) decode(file string, data []byte) (map[string]interface{}, error) {
+	format := r.opt.Format
+	if format == "" {
+		format = defaultDecoderRegistry.Detect(file)
+	}
+
+	d, err := defaultDecoderRegistry.Lookup(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return d(data)
+}
+
+// Changed will implement WatchableConfigReader.Changed method, the file
+// (include the included and profile files) is treated as changed if it's
+// modify time or size is different from the last ReadTo.
+func (r *fileConfigReader) Changed() (bool, error) {
+	r.statsMu.RLock()
+	stats := r.stats
+	r.statsMu.RUnlock()
+
+	files := append([]string{}, r.files...)
+	for file := range stats {
+		files = append(files, file)
+	}
+	sort.Strings(files[len(r.files):])
+
+	for i, file := range files {
+		file = filepath.Clean(file)
+		stat, err := r.stat(file)
+		last, ok := stats[file]
+		switch {
+		case err == nil:
+		case r.opt.Optional && os.IsNotExist(err):
+			// The optional file is changed if it's removed after read
+			if ok {
+				return true, nil
+			}
+			continue
+		case i < len(r.files) && os.IsNotExist(err):
+			return false, xerrors.Errorf("stat file '%s' failed: %w: %w", file, ErrMissing, err)
+		default:
+			return false, err
+		}
+
+		if !ok || !last.modTime.Equal(stat.modTime) || last.size != stat.size {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (r *fileConfigReader) stat(file string) (fileStat, error) {
+	info, err := statFn(file)
+	if err != nil {
+		return fileStat{}, err
+	}
 
-	return nil
+	return fileStat{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}, nil
 }
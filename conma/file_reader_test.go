@@ -20,14 +20,41 @@
 package conma
 
 import (
+	"io/fs"
+	"os"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 
+	"github.com/lsytj0413/ena"
 	"github.com/lsytj0413/ena/xerrors"
 )
 
+type testFileInfo struct {
+	os.FileInfo
+
+	modTime time.Time
+	size    int64
+}
+
+func (i *testFileInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *testFileInfo) Size() int64 {
+	return i.size
+}
+
 func TestFileConfigReaderReadTo(t *testing.T) {
+	statFn = func(name string) (fs.FileInfo, error) {
+		return &testFileInfo{}, nil
+	}
+	defer func() {
+		statFn = os.Stat
+	}()
+
 	t.Run("normal test", func(t *testing.T) {
 		g := NewWithT(t)
 
@@ -61,17 +88,13 @@ k3:
 
 		err := r.ReadTo(s)
 		g.Expect(err).ToNot(HaveOccurred())
-		g.Expect(count).To(Equal(6))
+		g.Expect(count).To(Equal(5))
 		g.Expect(vals).To(Equal(map[string]interface{}{
-			"k1": "v1",
-			"k2": "v2.1",
-			"k3": map[string]interface{}{
-				"k4": "v4.1",
-				"k5": []interface{}{
-					"v5",
-					"v5.1",
-				},
-			},
+			"k1":       "v1",
+			"k2":       "v2.1",
+			"k3.k4":    "v4.1",
+			"k3.k5[0]": "v5",
+			"k3.k5[1]": "v5.1",
 		}))
 	})
 
@@ -139,15 +162,512 @@ k3:
   - v5.1`), nil
 		}
 
+		// The files is merged before persistent, so nothing is set
 		err := r.ReadTo(s)
 		g.Expect(err).To(HaveOccurred())
-		g.Expect(count).To(Equal(3))
-		g.Expect(vals).To(Equal(map[string]interface{}{
+		g.Expect(count).To(Equal(0))
+		g.Expect(vals).To(Equal(map[string]interface{}{}))
+	})
+}
+
+func TestFileConfigReaderFormat(t *testing.T) {
+	statFn = func(name string) (fs.FileInfo, error) {
+		return &testFileInfo{}, nil
+	}
+	defer func() {
+		statFn = os.Stat
+	}()
+	readFileFn = func(name string) ([]byte, error) {
+		switch name {
+		case "1.json", "1":
+			return []byte(`{"k1": "v1"}`), nil
+		case "2.toml":
+			return []byte(`k2 = "v2"`), nil
+		case ".env":
+			return []byte(`K3=v3`), nil
+		}
+		return []byte(`k4: v4`), nil
+	}
+
+	t.Run("detect by ext", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s := newFlattenStorage()
+		r := NewFileConfigReader("1.json", "2.toml", ".env", "4.yml")
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
 			"k1": "v1",
 			"k2": "v2",
-			"k3": map[string]interface{}{
-				"k4": "v4",
+			"k3": "v3",
+			"k4": "v4",
+		}))
+	})
+
+	t.Run("explicit format", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s := newFlattenStorage()
+		r := NewFileConfigReaderWithOptions([]string{"1"}, WithFileFormat(FormatJSON))
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"k1": "v1",
+		}))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		g := NewWithT(t)
+
+		s := newFlattenStorage()
+		r := NewFileConfigReaderWithOptions([]string{"1"}, WithFileFormat("unknown"))
+		err := r.ReadTo(s)
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	})
+}
+
+func TestFileConfigReaderChanged(t *testing.T) {
+	defer func() {
+		statFn = os.Stat
+	}()
+
+	now := time.Now()
+	stats := map[string]*testFileInfo{
+		"1": {modTime: now, size: 1},
+		"2": {modTime: now, size: 2},
+	}
+	statFn = func(name string) (fs.FileInfo, error) {
+		if v, ok := stats[name]; ok {
+			return v, nil
+		}
+		return nil, xerrors.ErrNotFound
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		return []byte(`k1: v1`), nil
+	}
+	s := &testConfigStore{
+		setFn: func(key string, val interface{}) error {
+			return nil
+		},
+	}
+
+	t.Run("never read", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("1", "2").(WatchableConfigReader)
+		changed, err := r.Changed()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(changed).To(BeTrue())
+	})
+
+	t.Run("unchanged after read", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("1", "2").(WatchableConfigReader)
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		changed, err := r.Changed()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(changed).To(BeFalse())
+	})
+
+	t.Run("modify time changed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("1", "2").(WatchableConfigReader)
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		stats["2"] = &testFileInfo{modTime: now.Add(time.Second), size: 2}
+		changed, err := r.Changed()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(changed).To(BeTrue())
+	})
+
+	t.Run("size changed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("1", "2").(WatchableConfigReader)
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		stats["1"] = &testFileInfo{modTime: now, size: 10}
+		changed, err := r.Changed()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(changed).To(BeTrue())
+	})
+
+	t.Run("stat failed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("3", "1").(WatchableConfigReader)
+		_, err := r.Changed()
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		g := NewWithT(t)
+
+		r := NewFileConfigReader("1", "2").(WatchableConfigReader)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				_, err := r.Changed()
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+		}()
+		wg.Wait()
+	})
+}
+
+func TestFileConfigReaderProfile(t *testing.T) {
+	files := map[string]string{
+		"conf/base.yaml": `
+name: base
+log:
+  level: info
+  file: app.log
+peers: [p1, p2, p3]`,
+		"conf/prod.yaml": `
+log:
+  level: warn
+peers: [p4]`,
+		"conf/prod-eu.yaml": `
+name: eu`,
+		"conf/dev-local.yaml": `
+name: local`,
+	}
+	statFn = func(name string) (fs.FileInfo, error) {
+		if _, ok := files[name]; ok {
+			return &testFileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		return []byte(files[name]), nil
+	}
+	defer func() {
+		statFn = os.Stat
+		readFileFn = os.ReadFile
+		argsFn = func() []string {
+			return os.Args[1:]
+		}
+		lookupEnvFn = os.LookupEnv
+	}()
+
+	type testcase struct {
+		desp    string
+		opts    []ena.Option[fileReaderOption]
+		args    []string
+		env     map[string]string
+		expect  map[string]string
+		sources map[string]Source
+		err     string
+	}
+	testcases := []testcase{
+		{
+			desp: "without profile",
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "info",
+				"log.file":  "app.log",
+				"peers[0]":  "p1",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
 			},
+		},
+		{
+			desp: "profile by option",
+			opts: []ena.Option[fileReaderOption]{WithFileProfile("prod-eu")},
+			args: []string{"--profile=dev"},
+			expect: map[string]string{
+				"name":      "eu",
+				"log.level": "warn",
+				"log.file":  "app.log",
+				"peers[0]":  "p4",
+			},
+			sources: map[string]Source{
+				"name":      {Reader: SourceFile, Detail: "conf/prod-eu.yaml"},
+				"log.level": {Reader: SourceFile, Detail: "conf/prod.yaml"},
+				"log.file":  {Reader: SourceFile, Detail: "conf/base.yaml"},
+			},
+		},
+		{
+			desp: "profile flag & env is disabled by default",
+			args: []string{"--profile=prod"},
+			env:  map[string]string{"APP_PROFILE": "prod"},
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "info",
+				"log.file":  "app.log",
+				"peers[0]":  "p1",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
+			},
+		},
+		{
+			desp: "profile by flag",
+			opts: []ena.Option[fileReaderOption]{WithFileProfileFlag("profile"), WithFileProfileEnv("APP_PROFILE")},
+			args: []string{"-v", "--profile", "prod"},
+			env:  map[string]string{"APP_PROFILE": "dev"},
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "warn",
+				"log.file":  "app.log",
+				"peers[0]":  "p4",
+			},
+		},
+		{
+			desp: "profile by env & missing layer is skipped",
+			env:  map[string]string{"MY_PROFILE": "dev-local"},
+			opts: []ena.Option[fileReaderOption]{WithFileProfileEnv("MY_PROFILE")},
+			expect: map[string]string{
+				"name":      "local",
+				"log.level": "info",
+				"log.file":  "app.log",
+				"peers[0]":  "p1",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
+			},
+		},
+		{
+			desp: "merge slice by index",
+			opts: []ena.Option[fileReaderOption]{WithFileProfile("prod"), WithFileMergeRule("peers", MergeIndex)},
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "warn",
+				"log.file":  "app.log",
+				"peers[0]":  "p4",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
+			},
+		},
+		{
+			desp: "replace map",
+			opts: []ena.Option[fileReaderOption]{WithFileProfile("prod"), WithFileMergeRule("log", MergeReplace), WithFileMergeRule("peers", MergeAppend)},
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "warn",
+				"peers[0]":  "p1",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
+				"peers[3]":  "p4",
+			},
+		},
+		{
+			desp: "profile not found is skipped",
+			opts: []ena.Option[fileReaderOption]{WithFileProfile("test")},
+			expect: map[string]string{
+				"name":      "base",
+				"log.level": "info",
+				"log.file":  "app.log",
+				"peers[0]":  "p1",
+				"peers[1]":  "p2",
+				"peers[2]":  "p3",
+			},
+		},
+		{
+			desp: "profile not found with strict",
+			opts: []ena.Option[fileReaderOption]{WithFileProfileEnv("APP_PROFILE"), WithFileProfileStrict(true)},
+			args: []string{"--profile=prod"},
+			env:  map[string]string{"APP_PROFILE": "test"},
+			err:  `file 'conf/test.yaml' of profile 'test' not found`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			argsFn = func() []string {
+				return tc.args
+			}
+			lookupEnvFn = func(name string) (string, bool) {
+				v, ok := tc.env[name]
+				return v, ok
+			}
+
+			s := newFlattenStorage()
+			r := NewFileConfigReaderWithOptions([]string{"conf/base.yaml"}, tc.opts...)
+			err := r.ReadTo(s)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(s.items).To(Equal(tc.expect))
+			for k, src := range tc.sources {
+				g.Expect(s.sources[k]).To(Equal(src))
+			}
+		})
+	}
+}
+
+func TestFileConfigReaderInclude(t *testing.T) {
+	files := map[string]string{}
+	statFn = func(name string) (fs.FileInfo, error) {
+		if _, ok := files[name]; ok {
+			return &testFileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		if v, ok := files[name]; ok {
+			return []byte(v), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	defer func() {
+		statFn = os.Stat
+		readFileFn = os.ReadFile
+	}()
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"conf/app.yaml": `
+include: [common/log.yaml, db.json]
+name: app
+log:
+  level: debug`,
+			"conf/common/log.yaml": `
+include: ../db.json
+log:
+  level: info
+  file: app.log`,
+			"conf/db.json": `{"db": {"host": "h1"}}`,
+		}
+
+		s := newFlattenStorage()
+		r := NewFileConfigReaderWithOptions([]string{"conf/app.yaml"}, WithFileProfileFlag(""), WithFileProfileEnv(""))
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name":      "app",
+			"log.level": "debug",
+			"log.file":  "app.log",
+			"db.host":   "h1",
+		}))
+		g.Expect(s.sources["log.file"]).To(Equal(Source{Reader: SourceFile, Detail: "conf/common/log.yaml"}))
+		g.Expect(s.sources["db.host"]).To(Equal(Source{Reader: SourceFile, Detail: "conf/db.json"}))
+
+		// The included file is watched
+		g.Expect(r.(WatchableConfigReader).Changed()).To(BeFalse())
+		delete(files, "conf/db.json")
+		_, err := r.(WatchableConfigReader).Changed()
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("include cycle", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"a.yaml": `include: b.yaml`,
+			"b.yaml": `include: [./a.yaml]`,
+		}
+
+		r := NewFileConfigReaderWithOptions([]string{"a.yaml"}, WithFileProfileFlag(""), WithFileProfileEnv(""))
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`include cycle detected: a.yaml -> b.yaml -> a.yaml`))
+	})
+
+	t.Run("invalid include", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"a.yaml": `include: [1]`,
+		}
+
+		r := NewFileConfigReaderWithOptions([]string{"a.yaml"}, WithFileProfileFlag(""), WithFileProfileEnv(""))
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(`invalid include '1' in file 'a.yaml', must be string`))
+	})
+}
+
+func TestFileConfigReaderOptional(t *testing.T) {
+	files := map[string]string{}
+	statFn = func(name string) (fs.FileInfo, error) {
+		if _, ok := files[name]; ok {
+			return &testFileInfo{}, nil
+		}
+		return nil, os.ErrNotExist
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		if v, ok := files[name]; ok {
+			return []byte(v), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	defer func() {
+		statFn = os.Stat
+		readFileFn = os.ReadFile
+	}()
+
+	t.Run("missing file", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"conf/app.yaml": `name: app`,
+		}
+
+		err := NewFileConfigReaderWithOptions([]string{"conf/app.yaml", "conf/local.yaml"}, WithFileProfileFlag(""), WithFileProfileEnv("")).ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("stat file 'conf/local.yaml' failed"))
+		g.Expect(IsMissing(err)).To(BeTrue())
+
+		s := newFlattenStorage()
+		r := NewFileConfigReaderWithOptions([]string{"conf/app.yaml", "conf/local.yaml"},
+			WithFileProfile("dev"),
+			WithFileOptional(true),
+		)
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name": "app",
 		}))
+
+		// The optional file is watched when it's created or removed
+		g.Expect(r.(WatchableConfigReader).Changed()).To(BeFalse())
+		files["conf/local.yaml"] = `name: local`
+		g.Expect(r.(WatchableConfigReader).Changed()).To(BeTrue())
+
+		s = newFlattenStorage()
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name": "local",
+		}))
+		g.Expect(r.(WatchableConfigReader).Changed()).To(BeFalse())
+		delete(files, "conf/local.yaml")
+		g.Expect(r.(WatchableConfigReader).Changed()).To(BeTrue())
+	})
+
+	t.Run("missing include", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"conf/app.yaml": `include: db.yaml`,
+		}
+
+		r := NewFileConfigReaderWithOptions([]string{"conf/app.yaml"}, WithFileOptional(true))
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("stat file 'conf/db.yaml' failed"))
+	})
+
+	t.Run("decode failed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		files = map[string]string{
+			"conf/app.json": `{`,
+		}
+
+		r := NewFileConfigReaderWithOptions([]string{"conf/app.json"}, WithFileOptional(true))
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("decode file 'conf/app.json' failed"))
 	})
 }
@@ -0,0 +1,353 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+var (
+	// ErrHelp is returned by FlagConfigReader.ReadTo if the '-h' or '--help'
+	// flag is invoked but no such flag is defined.
+	ErrHelp = xerrors.New("conma: help requested")
+)
+
+// FlagConfigReader is the ConfigReader which parse the command line flags
+// defined by the `conma` tag of struct.
+type FlagConfigReader interface {
+	ConfigReader
+
+	// Args return the positional arguments of the last ReadTo, it's the
+	// non-flag arguments and all arguments after '--'.
+	Args() []string
+
+	// PrintUsage will write the usage of all flags to w.
+	PrintUsage(w io.Writer)
+}
+
+type flagReaderOption struct {
+	// Name is the program name in the usage.
+	// Default: os.Args[0]
+	Name string
+
+	// Output is the writer which the usage is written to when
+	// '-h' or '--help' is invoked.
+	// Default: os.Stderr
+	Output io.Writer
+}
+
+func defaultFlagReaderOption() *flagReaderOption {
+	name := ""
+	if len(os.Args) > 0 {
+		name = os.Args[0]
+	}
+
+	return &flagReaderOption{
+		Name:   name,
+		Output: os.Stderr,
+	}
+}
+
+// WithFlagName will set the program name option
+func WithFlagName(name string) ena.Option[flagReaderOption] {
+	return ena.NewFnOption(func(opt *flagReaderOption) {
+		opt.Name = name
+	})
+}
+
+// WithFlagOutput will set the usage output option
+func WithFlagOutput(w io.Writer) ena.Option[flagReaderOption] {
+	return ena.NewFnOption(func(opt *flagReaderOption) {
+		opt.Output = w
+	})
+}
+
+// flagDef is the definition of one command line flag.
+type flagDef struct {
+	key string
+	fd  *FieldDescriptor
+}
+
+func (f *flagDef) isBool() bool {
+	typ := f.fd.Typ
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ.Kind() == reflect.Bool
+}
+
+func (f *flagDef) isSlice() bool {
+	return f.fd.Typ.Kind() == reflect.Slice && !conv.HasConverter(f.fd.Typ)
+}
+
+// flagConfigReader will parse the command line arguments base on the
+// flags defined by struct.
+type flagConfigReader struct {
+	opt *flagReaderOption
+
+	flags []*flagDef
+	long  map[string]*flagDef
+	short map[string]*flagDef
+
+	// groups is the map or slice of struct fields, the keys under
+	// them are accepted as string flag.
+	groups    []*flagDef
+	groupKeys []string
+
+	args []string
+}
+
+// NewFlagConfigReader will return an flag reader, the flags are defined by
+// the `conma` tag of o (the struct or pointer to struct), such as:
+//
+//	Port int `conma:"server.port:=80" short:"p" desc:"the listen port"`
+//
+// defines the flag '--server.port' and '-p'. The flag can been set by
+// '--key=value', '--key value', '-k value' or '-k=value', the bool flag
+// can omit the value. The slice flag can been repeated, and each value
+// is split by comma. The keys under map or slice of struct field is
+// accepted as '--labels.app=v1'.
+func NewFlagConfigReader(o interface{}, opts ...ena.Option[flagReaderOption]) (FlagConfigReader, error) {
+	typ := reflect.TypeOf(o)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, xerrors.Errorf("The flag object must be an struct or pointer to struct, current is %T", o)
+	}
+
+	opt := defaultFlagReaderOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	r := &flagConfigReader{
+		opt:   opt,
+		long:  map[string]*flagDef{},
+		short: map[string]*flagDef{},
+	}
+
+	var err error
+	walkStruct(typ, "", func(key string, fd *FieldDescriptor) {
+		switch {
+		case isStructType(fd.Typ), isStructPtrType(fd.Typ):
+			return
+		case isCompositeType(fd.Typ):
+			r.groups = append(r.groups, &flagDef{key: key, fd: fd})
+			r.groupKeys = append(r.groupKeys, key)
+			return
+		}
+
+		f := &flagDef{
+			key: key,
+			fd:  fd,
+		}
+		if _, ok := r.long[key]; ok && err == nil {
+			err = xerrors.WrapDuplicate("flag '--%s' is defined by multiple fields", key)
+		}
+		r.long[key] = f
+		if fd.Short != "" {
+			if _, ok := r.short[fd.Short]; ok && err == nil {
+				err = xerrors.WrapDuplicate("flag '-%s' is defined by multiple fields", fd.Short)
+			}
+			r.short[fd.Short] = f
+		}
+		r.flags = append(r.flags, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *flagConfigReader) lookup(name string) (*flagDef, bool) {
+	if f, ok := r.long[name]; ok {
+		return f, true
+	}
+	if f, ok := r.short[name]; ok {
+		return f, true
+	}
+
+	// The key under map or slice of struct field is accepted as string
+	if matchAnyPrefix(name, r.groupKeys) {
+		return &flagDef{
+			key: name,
+			fd: &FieldDescriptor{
+				Typ: reflect.TypeOf(""),
+			},
+		}, true
+	}
+
+	return nil, false
+}
+
+// ReadTo will implement ConfigReader.ReadTo method, it will
+// 1. parse all command line arguments with the defined flags
+// 2. persistent the flag values to ConfigStore
+// The positional arguments is available by Args after that.
+// nolint
+func (r *flagConfigReader) ReadTo(store ConfigStorage) error {
+	args := argsFn()
+	positional := []string{}
+	values := map[string][]string{}
+	details := map[string]string{}
+	keys := []string{}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name := strings.TrimPrefix(arg[1:], "-")
+		name, value, hasValue := strings.Cut(name, "=")
+		f, ok := r.lookup(name)
+		if !ok {
+			if name == "h" || name == "help" {
+				r.PrintUsage(r.opt.Output)
+				return ErrHelp
+			}
+			return xerrors.Errorf("flag provided but not defined: '%s'", arg)
+		}
+
+		if !hasValue {
+			if f.isBool() {
+				value = "true"
+			} else {
+				if i+1 >= len(args) {
+					return xerrors.Errorf("flag needs an argument: '%s'", arg)
+				}
+				i++
+				value = args[i]
+			}
+		}
+
+		if _, ok := values[f.key]; !ok {
+			keys = append(keys, f.key)
+		}
+		if f.isSlice() {
+			values[f.key] = append(values[f.key], strings.Split(value, ",")...)
+		} else {
+			values[f.key] = []string{value}
+		}
+		// The value is not in the detail, it may be a secret
+		details[f.key], _, _ = strings.Cut(arg, "=")
+	}
+
+	r.args = positional
+	for _, key := range keys {
+		fstore := withSource(store, Source{Reader: SourceOption, Detail: details[key]})
+
+		var err error
+		if f, _ := r.lookup(key); f.isSlice() {
+			err = fstore.Set(key, values[key])
+		} else {
+			err = fstore.Set(key, values[key][0])
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Args return the positional arguments of the last ReadTo.
+func (r *flagConfigReader) Args() []string {
+	return r.args
+}
+
+// PrintUsage will write the usage of all flags to w, such as:
+//
+//	Usage of app:
+//	  -p, --server.port int   the listen port (default 80)
+func (r *flagConfigReader) PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage of %s:\n", r.opt.Name)
+
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 4, 2, ' ', 0)
+	for _, f := range r.flags {
+		name := "    --" + f.key
+		if f.fd.Short != "" {
+			name = "-" + f.fd.Short + ", --" + f.key
+		}
+		if !f.isBool() {
+			name += " " + flagTypeName(f.fd.Typ)
+		}
+
+		usage := f.fd.Description
+		if f.fd.Default != nil && *f.fd.Default != "" {
+			def := *f.fd.Default
+			if f.fd.Typ.Kind() == reflect.String {
+				def = fmt.Sprintf("%q", def)
+			}
+			usage = strings.TrimSpace(usage + " (default " + def + ")")
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, usage)
+	}
+	for _, g := range r.groups {
+		name := "    --" + g.key + ".<key> string"
+		if g.fd.Typ.Kind() != reflect.Map {
+			name = "    --" + g.key + "[<index>] string"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", name, g.fd.Description)
+	}
+	tw.Flush()
+	if buf.Len() == 0 {
+		return
+	}
+
+	// The tabwriter will pad the empty usage column, trim it
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+func flagTypeName(typ reflect.Type) string {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch {
+	case typ.PkgPath() == "time" && typ.Name() == "Duration":
+		return "duration"
+	case conv.HasConverter(typ) && typ.Name() != "":
+		return strings.ToLower(typ.Name())
+	case typ.Kind() == reflect.Slice:
+		return flagTypeName(typ.Elem()) + "s"
+	}
+	return typ.Kind().String()
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testFlagObj struct {
+	Name    string        `conma:"name:=app" short:"n" desc:"the app name"`
+	Debug   bool          `conma:"debug:=false" short:"d" desc:"enable debug"`
+	Verbose *bool         `conma:"verbose:=false"`
+	Timeout time.Duration `conma:"timeout:=1s"`
+	Server  struct {
+		Port  int      `conma:"port:=80" short:"p" desc:"the listen port"`
+		Peers []string `conma:"peers:="`
+	} `conma:"server"`
+	Labels    map[string]string `conma:"labels:=" desc:"the labels"`
+	Upstreams []testUpstream    `conma:"upstreams:="`
+}
+
+func TestNewFlagConfigReader(t *testing.T) {
+	t.Run("non struct", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := NewFlagConfigReader("")
+		g.Expect(err).To(HaveOccurred())
+		_, err = NewFlagConfigReader(nil)
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("duplicate short", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := NewFlagConfigReader(struct {
+			V1 string `conma:"k1" short:"k"`
+			V2 string `conma:"k2" short:"k"`
+		}{})
+		g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+	})
+
+	t.Run("duplicate long", func(t *testing.T) {
+		g := NewWithT(t)
+
+		_, err := NewFlagConfigReader(&struct {
+			V1 string `conma:"k1"`
+			V2 string `conma:"k1"`
+		}{})
+		g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+	})
+}
+
+func TestFlagConfigReaderReadTo(t *testing.T) {
+	defer func() {
+		argsFn = func() []string {
+			return os.Args[1:]
+		}
+	}()
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+
+		argsFn = func() []string {
+			return []string{
+				"run",
+				"--name=n1",
+				"-d",
+				"--verbose=false",
+				"-p", "8080",
+				"--timeout", "2s",
+				"-server.peers=a,b",
+				"--server.peers", "c",
+				"--labels.app", "a1",
+				"--upstreams[0].host=h1",
+				"-",
+				"--",
+				"--name=n2",
+				"x",
+			}
+		}
+
+		r, err := NewFlagConfigReader(&testFlagObj{})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		s := newFlattenStorage()
+		g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{
+			"name":              "n1",
+			"debug":             "true",
+			"verbose":           "false",
+			"server.port":       "8080",
+			"timeout":           "2s",
+			"server.peers[0]":   "a",
+			"server.peers[1]":   "b",
+			"server.peers[2]":   "c",
+			"labels.app":        "a1",
+			"upstreams[0].host": "h1",
+		}))
+		g.Expect(s.sources["server.port"]).To(Equal(Source{Reader: SourceOption, Detail: "-p"}))
+		g.Expect(r.Args()).To(Equal([]string{"run", "-", "--name=n2", "x"}))
+
+		mgr := NewConfigMgr(r)
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		var o testFlagObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o.Name).To(Equal("n1"))
+		g.Expect(o.Debug).To(BeTrue())
+		g.Expect(*o.Verbose).To(BeFalse())
+		g.Expect(o.Timeout).To(Equal(2 * time.Second))
+		g.Expect(o.Server.Port).To(Equal(8080))
+		g.Expect(o.Server.Peers).To(Equal([]string{"a", "b", "c"}))
+		g.Expect(o.Labels).To(Equal(map[string]string{"app": "a1"}))
+		g.Expect(o.Upstreams).To(Equal([]testUpstream{{Host: "h1", Weight: 1}}))
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		g := NewWithT(t)
+
+		argsFn = func() []string {
+			return []string{"--name=n1", "--nmae=n2"}
+		}
+		r, err := NewFlagConfigReader(&testFlagObj{})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		s := newFlattenStorage()
+		err = r.ReadTo(s)
+		g.Expect(err).To(MatchError("flag provided but not defined: '--nmae=n2'"))
+		g.Expect(s.items).To(BeEmpty())
+	})
+
+	t.Run("missing argument", func(t *testing.T) {
+		g := NewWithT(t)
+
+		argsFn = func() []string {
+			return []string{"--name"}
+		}
+		r, err := NewFlagConfigReader(&testFlagObj{})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		err = r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(MatchError("flag needs an argument: '--name'"))
+	})
+
+	t.Run("help", func(t *testing.T) {
+		g := NewWithT(t)
+
+		argsFn = func() []string {
+			return []string{"--name=n1", "-h"}
+		}
+		buf := &bytes.Buffer{}
+		r, err := NewFlagConfigReader(&testFlagObj{}, WithFlagName("app"), WithFlagOutput(buf))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		err = r.ReadTo(newFlattenStorage())
+		g.Expect(xerrors.Is(err, ErrHelp)).To(BeTrue())
+		g.Expect(buf.String()).To(Equal(`Usage of app:
+  -n, --name string                the app name (default "app")
+  -d, --debug                      enable debug (default false)
+      --verbose                    (default false)
+      --timeout duration           (default 1s)
+  -p, --server.port int            the listen port (default 80)
+      --server.peers strings
+      --labels.<key> string        the labels
+      --upstreams[<index>] string
+`))
+	})
+}
@@ -26,6 +26,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/lsytj0413/ena"
 	"github.com/lsytj0413/ena/conv"
@@ -33,14 +34,48 @@ import (
 )
 
 // flattenStorage is the storage implement for
-// configuration items by kv.
+// configuration items by kv, it's safe for concurrent use.
 type flattenStorage struct {
+	// mu protect the items, sources, kinds, secrets, resolved and rules
+	mu    sync.RWMutex
 	items map[string]string
+
+	// sources is the source of items which last set it
+	sources map[string]Source
+
+	// kinds is the kind of items which is set by bool or number value, so
+	// that the type is kept by Export.
+	kinds map[string]reflect.Kind
+
+	// rules is the MergeRule of lists, see writeSession
+	rules map[string]MergeRule
+
+	// secrets is the keys which value is resolved from secret reference,
+	// and the value is the unresolved reference. They're always redacted
+	// by Explain.
+	secrets map[string]string
+	// resolved is the keys which value have been resolved, so that they
+	// will not been resolved again by the next resolve.
+	resolved map[string]struct{}
+
+	// usageMu protect the defaults and consumed, they're written by Get
+	usageMu sync.Mutex
+	// defaults is the tag default values which used by Get
+	// because the key is not found in items.
+	defaults map[string]string
+	// consumed is the keys of items which have been retrieved by Get
+	consumed map[string]struct{}
 }
 
 func newFlattenStorage() *flattenStorage {
 	return &flattenStorage{
-		items: map[string]string{},
+		items:    map[string]string{},
+		sources:  map[string]Source{},
+		kinds:    map[string]reflect.Kind{},
+		secrets:  map[string]string{},
+		resolved: map[string]struct{}{},
+		defaults: map[string]string{},
+		consumed: map[string]struct{}{},
 	}
 }
 
@@ -62,8 +97,10 @@ func (s *flattenStorage) Get(key string, opts ...ena.Option[getOption]) (ret int
 	}
 
 	var propValues []string
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	switch {
-	case targetValue.Kind() == reflect.Slice:
+	case (targetValue.Kind() == reflect.Slice || targetValue.Kind() == reflect.Array) && !conv.HasConverter(targetValue.Type()):
 		vstrs, err := s.doGetSlice(key)
 		if err != nil {
 			if !xerrors.Is(err, xerrors.ErrNotFound) || opt.Default == nil {
@@ -75,6 +112,7 @@ func (s *flattenStorage) Get(key string, opts ...ena.Option[getOption]) (ret int
 			} else {
 				vstrs = strings.Split(*opt.Default, ",")
 			}
+			s.recordDefault(key, *opt.Default)
 		}
 		propValues = vstrs
 	default:
@@ -85,21 +123,33 @@ func (s *flattenStorage) Get(key string, opts ...ena.Option[getOption]) (ret int
 			}
 
 			vstr = *opt.Default
+			s.recordDefault(key, vstr)
 		}
 		propValues = []string{vstr}
 	}
 
 	cv, err := conv.ConvertTo(context.Background(), targetValue.Type(), propValues)
 	if err != nil {
-		return nil, err
+		return nil, withConversionKey(err, key)
 	}
 	targetValue.Set(reflect.ValueOf(cv).Convert(targetValue.Type()))
 	return opt.Target.Interface(), nil
 }
 
+// withConversionKey will populate the key of *conv.ConversionError, so
+// that the error is reported such as 'server.port[1]: "abc" is not an int'.
+func withConversionKey(err error, key string) error {
+	var ce *conv.ConversionError
+	if xerrors.As(err, &ce) {
+		ce.WithKey(key)
+	}
+	return err
+}
+
 func (s *flattenStorage) doGet(key string) (string, error) {
 	val, ok := s.items[key]
 	if ok {
+		s.markConsumed(key)
 		return val, nil
 	}
 
@@ -111,33 +161,36 @@ type indexString struct {
 	v string
 }
 
+// doGetSlice return the indexed items of key sorted by index, or the
+// scalar item of key as one element slice. The indexed items is preferred
+// if both exist, but Set will never keep both of them.
 func (s *flattenStorage) doGetSlice(key string) ([]string, error) {
-	val, ok := s.items[key]
-	if ok {
-		return []string{val}, nil
-	}
-
 	ret := []indexString{}
+	keys := []string{}
 	for k, v := range s.items {
 		if !strings.HasPrefix(k, key) {
 			continue
 		}
+		origin := k
 
+		// Only the direct element such as 'key[0]' is accepted, the nested
+		// element such as 'key[0][1]' or 'key[0].x' is skipped
 		k = k[len(key):]
-		if !strings.HasPrefix(k, "[") || !strings.HasSuffix(k, "]") {
+		if !strings.HasPrefix(k, "[") || strings.IndexByte(k, ']') != len(k)-1 {
 			continue
 		}
 
 		k = k[1 : len(k)-1]
 		i, err := strconv.ParseInt(k, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, xerrors.Wrapf(err, "invalid index key '%s'", origin)
 		}
 
 		ret = append(ret, indexString{
 			i: i,
 			v: v,
 		})
+		keys = append(keys, origin)
 	}
 
 	sort.Slice(ret, func(i int, j int) bool {
@@ -145,6 +198,7 @@ func (s *flattenStorage) doGetSlice(key string) ([]string, error) {
 	})
 
 	if len(ret) > 0 {
+		s.markConsumed(keys...)
 		rr := make([]string, 0, len(ret))
 		for _, v := range ret {
 			rr = append(rr, v.v)
@@ -153,11 +207,319 @@ func (s *flattenStorage) doGetSlice(key string) ([]string, error) {
 		return rr, nil
 	}
 
+	if val, ok := s.items[key]; ok {
+		s.markConsumed(key)
+		return []string{val}, nil
+	}
+
 	return nil, xerrors.WrapNotFound("property slice with key='%v' not found", key)
 }
 
+func (s *flattenStorage) markConsumed(keys ...string) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	if s.consumed == nil {
+		s.consumed = map[string]struct{}{}
+	}
+	for _, k := range keys {
+		s.consumed[k] = struct{}{}
+	}
+}
+
+func (s *flattenStorage) recordDefault(key string, val string) {
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	if s.defaults == nil {
+		s.defaults = map[string]string{}
+	}
+	s.defaults[key] = val
+}
+
+// WithSource will implement SourceConfigStorage.WithSource method, the
+// returned storage is a new write session, see writeSession.
+func (s *flattenStorage) WithSource(src Source) ConfigStorage {
+	return &sourceStorage{
+		s:       s,
+		src:     src,
+		session: newWriteSession(),
+	}
+}
+
+// sourceStorage will record the source for all items set by it
+type sourceStorage struct {
+	s       *flattenStorage
+	src     Source
+	session *writeSession
+}
+
+func (s *sourceStorage) Set(key string, val interface{}) error {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+
+	err := s.s.set(key, val, s.src, s.session)
+	if err != nil && s.session.failedKey == "" {
+		s.session.failedKey = key
+	}
+	return err
+}
+
+// WithSource return the storage in the same write session.
+func (s *sourceStorage) WithSource(src Source) ConfigStorage {
+	return &sourceStorage{
+		s:       s.s,
+		src:     s.src.merge(src),
+		session: s.session,
+	}
+}
+
+// writeSession is the Set calls of one ConfigReader.ReadTo. When a list
+// (the key set as slice, or the key with index such as 'key[0]') is set
+// at the first time in current session, the items of it which set by the
+// previous sessions is merged by the MergeRule of key:
+//  1. MergeDefault and MergeReplace will delete the previous items
+//  2. MergeAppend will keep the previous items, and the index of current
+//     session is shifted after them
+//  3. MergeIndex will keep the previous items, and override them by index
+//
+// The scalar is treated as the list with one element when it's mixed with
+// list, so that the storage will never keep both 'key' and 'key[0]'.
+type writeSession struct {
+	// lists is the index offset of lists which is set in current session
+	lists map[string]int64
+
+	// failedKey is the first key which failed to set in current session
+	failedKey string
+}
+
+func newWriteSession() *writeSession {
+	return &writeSession{
+		lists: map[string]int64{},
+	}
+}
+
+// SetMergeRules will set the MergeRule of lists by key.
+func (s *flattenStorage) SetMergeRules(rules map[string]MergeRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = rules
+}
+
+// prepareList will merge the previous items of list key by the rule at the
+// first time it's set in session, and return the index offset of it.
+func (s *flattenStorage) prepareList(key string, session *writeSession) (int64, error) {
+	if offset, ok := session.lists[key]; ok {
+		return offset, nil
+	}
+
+	var offset int64
+	switch s.rules[key] { //nolint
+	case MergeAppend:
+		s.scalarToList(key)
+		next, err := s.nextIndex(key)
+		if err != nil {
+			return 0, err
+		}
+		offset = next
+	case MergeIndex:
+		s.scalarToList(key)
+	default:
+		s.delete(key)
+	}
+
+	session.lists[key] = offset
+	return offset, nil
+}
+
+// prepareKey will prepare all lists in the key from outer to inner, and
+// return the key with index shifted by offset.
+func (s *flattenStorage) prepareKey(key string, session *writeSession) (string, error) {
+	for pos := strings.IndexByte(key, '['); pos >= 0; {
+		end := strings.IndexByte(key[pos:], ']')
+		if end < 0 {
+			return "", xerrors.Errorf("invalid key '%s'", key)
+		}
+		end += pos
+
+		offset, err := s.prepareList(key[:pos], session)
+		if err != nil {
+			return "", err
+		}
+		if offset != 0 {
+			i, err := strconv.ParseInt(key[pos+1:end], 10, 64)
+			if err != nil {
+				return "", xerrors.Wrapf(err, "invalid index of key '%s'", key)
+			}
+			idx := strconv.FormatInt(i+offset, 10)
+			key = key[:pos+1] + idx + key[end:]
+			end = pos + 1 + len(idx)
+		}
+
+		next := strings.IndexByte(key[end:], '[')
+		if next < 0 {
+			break
+		}
+		pos = end + next
+	}
+
+	return key, nil
+}
+
+// prepareScalar will return the key to set the scalar, if the key is a
+// list already, the scalar is merged as one element list.
+func (s *flattenStorage) prepareScalar(key string, session *writeSession) (string, error) {
+	if !s.hasIndexes(key) {
+		return key, nil
+	}
+
+	switch s.rules[key] { //nolint
+	case MergeAppend:
+		next, err := s.nextIndex(key)
+		if err != nil {
+			return "", err
+		}
+		session.lists[key] = next
+		return fmt.Sprintf("%s[%d]", key, next), nil
+	case MergeIndex:
+		session.lists[key] = 0
+		return key + "[0]", nil
+	}
+
+	// The scalar replace the list, even it's set in current session
+	s.delete(key)
+	delete(session.lists, key)
+	return key, nil
+}
+
+// scalarToList will move the scalar item of key to the first element.
+func (s *flattenStorage) scalarToList(key string) {
+	val, ok := s.items[key]
+	if !ok {
+		return
+	}
+
+	ikey := key + "[0]"
+	s.items[ikey] = val
+	if s.sources != nil {
+		s.sources[ikey] = s.sources[key]
+	}
+	if kind, ok := s.kinds[key]; ok {
+		s.kinds[ikey] = kind
+	}
+	s.deleteItem(key)
+}
+
+func (s *flattenStorage) hasIndexes(key string) bool {
+	for k := range s.items {
+		if strings.HasPrefix(k, key+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// nextIndex return the max index of list key plus 1.
+func (s *flattenStorage) nextIndex(key string) (int64, error) {
+	var next int64
+	for k := range s.items {
+		if !strings.HasPrefix(k, key+"[") {
+			continue
+		}
+
+		rest := k[len(key)+1:]
+		end := strings.IndexByte(rest, ']')
+		if end < 0 {
+			return 0, xerrors.Errorf("invalid index key '%s'", k)
+		}
+		i, err := strconv.ParseInt(rest[:end], 10, 64)
+		if err != nil {
+			return 0, xerrors.Wrapf(err, "invalid index key '%s'", k)
+		}
+		if i >= next {
+			next = i + 1
+		}
+	}
+	return next, nil
+}
+
+// delete will delete the item of key and all it's children.
+func (s *flattenStorage) delete(key string) {
+	for k := range s.items {
+		if matchPrefix(k, key) {
+			s.deleteItem(k)
+		}
+	}
+}
+
+func (s *flattenStorage) deleteItem(key string) {
+	delete(s.items, key)
+	delete(s.sources, key)
+	delete(s.kinds, key)
+	delete(s.secrets, key)
+	delete(s.resolved, key)
+}
+
+// Explain return the items which key match the prefix, and the tag
+// default values which used by Get but not found in items. The value
+// of secret items is redacted.
+func (s *flattenStorage) Explain(prefix string) []Explanation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	explanations := []Explanation{}
+	for k, v := range s.items {
+		if matchPrefix(k, prefix) {
+			e := Explanation{
+				Key:    k,
+				Value:  v,
+				Source: s.sources[k],
+			}
+			if _, ok := s.secrets[k]; ok {
+				e.Value = redactedValue
+				e.Redacted = true
+			}
+			explanations = append(explanations, e)
+		}
+	}
+
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+	for k, v := range s.defaults {
+		if _, ok := s.items[k]; ok || !matchPrefix(k, prefix) {
+			continue
+		}
+
+		explanations = append(explanations, Explanation{
+			Key:   k,
+			Value: v,
+			Source: Source{
+				Reader: SourceDefault,
+			},
+		})
+	}
+
+	return sortExplanations(explanations)
+}
+
+// Set will set the val to key in a new write session, see writeSession.
 func (s *flattenStorage) Set(key string, val interface{}) error {
-	switch v := reflect.ValueOf(val); v.Kind() { //nolint
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.set(key, val, Source{}, newWriteSession())
+}
+
+func (s *flattenStorage) set(key string, val interface{}, src Source, session *writeSession) error {
+	// The type with converter is scalar, such as time.Time and net.IP
+	v := reflect.ValueOf(val)
+	kind := v.Kind()
+	if kind != reflect.Invalid && conv.HasConverter(v.Type()) {
+		kind = reflect.String
+	}
+
+	switch kind { //nolint
 	case reflect.Map:
 		// If the val is a map, we expand the val with keys and set it recursive
 		for _, k := range v.MapKeys() {
@@ -168,17 +530,21 @@ func (s *flattenStorage) Set(key string, val interface{}) error {
 
 			kstr = fmt.Sprintf("%s.%s", key, kstr)
 			kvalue := v.MapIndex(k).Interface()
-			err = s.Set(kstr, kvalue)
+			err = s.set(kstr, kvalue, src, session)
 			if err != nil {
 				return xerrors.Wrapf(err, "Cannot set val for map's key '%v'", kstr)
 			}
 		}
 	case reflect.Array, reflect.Slice:
-		// If the val is a array/slice, we expand the val with index and set it recursive
+		// If the val is a array/slice, we expand the val with index and set it recursive,
+		// the previous list is merged before that even the val is empty
+		if _, err := s.prepareKey(key+"[0]", session); err != nil {
+			return err
+		}
 		for i := 0; i < v.Len(); i++ {
 			kstr := fmt.Sprintf("%s[%d]", key, i)
 			kvalue := v.Index(i).Interface()
-			err := s.Set(kstr, kvalue)
+			err := s.set(kstr, kvalue, src, session)
 			if err != nil {
 				return xerrors.Wrapf(err, "Cannot set val for array/slice index's key '%v'", kstr)
 			}
@@ -188,7 +554,28 @@ func (s *flattenStorage) Set(key string, val interface{}) error {
 		if err != nil {
 			return xerrors.Wrapf(err, "Cannot convert value to string")
 		}
+
+		key, err = s.prepareKey(key, session)
+		if err != nil {
+			return err
+		}
+		key, err = s.prepareScalar(key, session)
+		if err != nil {
+			return err
+		}
+
+		s.deleteItem(key)
 		s.items[key] = value
+		if s.sources == nil {
+			s.sources = map[string]Source{}
+		}
+		s.sources[key] = src
+		if kind == reflect.Bool || isNumberKind(kind) {
+			if s.kinds == nil {
+				s.kinds = map[string]reflect.Kind{}
+			}
+			s.kinds[key] = kind
+		}
 	}
 
 	return nil
@@ -20,7 +20,11 @@
 package conma
 
 import (
+	"fmt"
+	"io/fs"
+	"os"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
@@ -790,6 +794,46 @@ func TestFlattenStorageDoGetSlice(t *testing.T) {
 			err:    "",
 			expect: []string{"v1", "v2"},
 		},
+		{
+			desp: "mixed scalar & indexed prefer indexed",
+			p: &flattenStorage{
+				items: map[string]string{
+					"k1":    "v0",
+					"k1[1]": "v2",
+					"k1[0]": "v1",
+				},
+			},
+			key:    "k1",
+			err:    "",
+			expect: []string{"v1", "v2"},
+		},
+		{
+			desp: "nested list skipped",
+			p: &flattenStorage{
+				items: map[string]string{
+					"k1[0][0]":   "v1",
+					"k1[0][1]":   "v2",
+					"k1[1].x[0]": "v3",
+					"k1[2]":      "v4",
+				},
+			},
+			key:    "k1",
+			err:    "",
+			expect: []string{"v4"},
+		},
+		{
+			desp: "nested list element",
+			p: &flattenStorage{
+				items: map[string]string{
+					"k1[0][0]":   "v1",
+					"k1[0][1]":   "v2",
+					"k1[1].x[0]": "v3",
+				},
+			},
+			key:    "k1[0]",
+			err:    "",
+			expect: []string{"v1", "v2"},
+		},
 		{
 			desp: "index parse failed",
 			p: &flattenStorage{
@@ -831,3 +875,272 @@ func TestFlattenStorageDoGetSlice(t *testing.T) {
 		})
 	}
 }
+
+func TestFlattenStorageMergeList(t *testing.T) {
+	type write struct {
+		key string
+		val interface{}
+	}
+	type testcase struct {
+		desp     string
+		rules    map[string]MergeRule
+		sessions [][]write
+		expect   map[string]string
+	}
+	testcases := []testcase{
+		{
+			desp: "replace shorter list",
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2", "v3"}}},
+				{{key: "k1", val: []string{"v4"}}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v4",
+			},
+		},
+		{
+			desp: "replace list by empty list",
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2"}}, {key: "k2", val: "v3"}},
+				{{key: "k1", val: []string{}}},
+			},
+			expect: map[string]string{
+				"k2": "v3",
+			},
+		},
+		{
+			desp: "indexed items in one session is accumulated",
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2", "v3"}}},
+				{{key: "k1[0].k2", val: "v4"}, {key: "k1[1].k2", val: "v5"}},
+			},
+			expect: map[string]string{
+				"k1[0].k2": "v4",
+				"k1[1].k2": "v5",
+			},
+		},
+		{
+			desp: "scalar replace list",
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2"}}},
+				{{key: "k1", val: "v3"}},
+			},
+			expect: map[string]string{
+				"k1": "v3",
+			},
+		},
+		{
+			desp: "list replace scalar",
+			sessions: [][]write{
+				{{key: "k1", val: "v1"}},
+				{{key: "k1", val: []string{"v2", "v3"}}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v2",
+				"k1[1]": "v3",
+			},
+		},
+		{
+			desp: "the last one win in one session",
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2"}}, {key: "k1", val: "v3"}, {key: "k1", val: []string{"v4"}}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v4",
+			},
+		},
+		{
+			desp:  "append list",
+			rules: map[string]MergeRule{"k1": MergeAppend},
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2"}}},
+				{{key: "k1[0]", val: "v3"}, {key: "k1[1]", val: "v4"}},
+				{{key: "k1", val: "v5"}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v1",
+				"k1[1]": "v2",
+				"k1[2]": "v3",
+				"k1[3]": "v4",
+				"k1[4]": "v5",
+			},
+		},
+		{
+			desp:  "append list to scalar",
+			rules: map[string]MergeRule{"k1": MergeAppend},
+			sessions: [][]write{
+				{{key: "k1", val: "v1"}},
+				{{key: "k1", val: []string{"v2"}}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v1",
+				"k1[1]": "v2",
+			},
+		},
+		{
+			desp:  "merge list by index",
+			rules: map[string]MergeRule{"k1": MergeIndex},
+			sessions: [][]write{
+				{{key: "k1", val: []string{"v1", "v2", "v3"}}},
+				{{key: "k1", val: []string{"v4"}}},
+				{{key: "k1", val: "v5"}},
+			},
+			expect: map[string]string{
+				"k1[0]": "v5",
+				"k1[1]": "v2",
+				"k1[2]": "v3",
+			},
+		},
+		{
+			desp:  "nested list",
+			rules: map[string]MergeRule{"k1": MergeAppend},
+			sessions: [][]write{
+				{{key: "k1", val: []interface{}{map[string]interface{}{"k2": []string{"v1", "v2"}}}}},
+				{{key: "k1[0].k2", val: []string{"v3"}}},
+			},
+			expect: map[string]string{
+				"k1[0].k2[0]": "v1",
+				"k1[0].k2[1]": "v2",
+				"k1[1].k2[0]": "v3",
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s := newFlattenStorage()
+			s.SetMergeRules(tc.rules)
+			for i, writes := range tc.sessions {
+				ss := s.WithSource(Source{Reader: fmt.Sprint(i)})
+				for _, w := range writes {
+					g.Expect(ss.Set(w.key, w.val)).ToNot(HaveOccurred())
+				}
+			}
+
+			g.Expect(s.items).To(Equal(tc.expect))
+			for k := range s.sources {
+				g.Expect(s.items).To(HaveKey(k))
+			}
+		})
+	}
+}
+
+func TestConfigMgrMergeList(t *testing.T) {
+	statFn = func(name string) (fs.FileInfo, error) {
+		return &testFileInfo{}, nil
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		return []byte(`
+peers: [p1, p2, p3]
+hosts: [h1, h2]
+tags: [t1]`), nil
+	}
+	environFn = func() []string {
+		return []string{"PEERS=p4,p5", "HOSTS=h3"}
+	}
+	argsFn = func() []string {
+		return []string{"--tags=t2,t3"}
+	}
+	defer func() {
+		statFn = os.Stat
+		readFileFn = os.ReadFile
+		environFn = os.Environ
+		argsFn = func() []string {
+			return os.Args[1:]
+		}
+	}()
+
+	type testObj struct {
+		Peers []string `conma:"peers"`
+		Hosts []string `conma:"hosts"`
+		Tags  []string `conma:"tags"`
+	}
+
+	t.Run("replace", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mgr := NewConfigMgr(NewFileConfigReader("a.yaml"), NewEnvConfigReader(), NewOptionConfigReader())
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			Peers: []string{"p4", "p5"},
+			Hosts: []string{"h3"},
+			Tags:  []string{"t2", "t3"},
+		}))
+		g.Expect(mgr.Keys("hosts")).To(Equal([]string{"hosts"}))
+	})
+
+	t.Run("append", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mgr := NewConfigMgrWithOptions(
+			[]ConfigReader{NewFileConfigReader("a.yaml"), NewEnvConfigReader(), NewOptionConfigReader()},
+			WithMergeRule("peers", MergeAppend),
+			WithMergeRule("hosts", MergeAppend),
+			WithMergeRule("tags", MergeIndex),
+		)
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			Peers: []string{"p1", "p2", "p3", "p4", "p5"},
+			Hosts: []string{"h1", "h2", "h3"},
+			Tags:  []string{"t2", "t3"},
+		}))
+
+		// read again will not append the lists twice
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		o = testObj{}
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			Peers: []string{"p1", "p2", "p3", "p4", "p5"},
+			Hosts: []string{"h1", "h2", "h3"},
+			Tags:  []string{"t2", "t3"},
+		}))
+	})
+}
+
+func TestFlattenStorageConcurrent(t *testing.T) {
+	g := NewWithT(t)
+
+	s := newFlattenStorage()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		i := i
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			ss := s.WithSource(Source{Reader: fmt.Sprint(i)})
+			for j := 0; j < 100; j++ {
+				g.Expect(ss.Set(fmt.Sprintf("k%d", i), []int{j, j})).ToNot(HaveOccurred())
+				g.Expect(s.Set("k", j)).ToNot(HaveOccurred())
+			}
+		}()
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				_, _ = s.Get(fmt.Sprintf("k%d", i), WithType(reflect.TypeOf(&[]int{})))
+				_, _ = s.Get("k", WithDefault("1"))
+				_ = s.IsSet("k")
+				_ = s.Keys("")
+				_, _ = s.indexes("k0")
+				_ = s.childKeys("")
+				_ = s.Explain("")
+				_, _ = s.nested()
+			}
+		}()
+	}
+	wg.Wait()
+
+	g.Expect(s.items).To(HaveLen(9))
+	v, err := s.Get("k0", WithType(reflect.TypeOf(&[]int{})))
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(v).To(Equal(&[]int{99, 99}))
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// httpConfigReader will read the json object from http endpoint to
+// config storage, the ETag is used to avoid download the unchanged one.
+type httpConfigReader struct {
+	url string
+	opt *httpReaderOption
+
+	mu sync.Mutex
+	// etag and body is the latest fetched response
+	etag string
+	body []byte
+	// readETag and readBody is the response used by last ReadTo
+	readETag string
+	readBody []byte
+}
+
+type httpReaderOption struct {
+	// Client is the http client to send request.
+	// Default: http.DefaultClient
+	Client *http.Client
+
+	// Header is the extra header of request, such as Authorization.
+	// Default: empty
+	Header http.Header
+
+	// Timeout is the timeout of each request, it's used when the ctx
+	// doesn't have deadline, such as Changed or the ctx of Watch.
+	// Default: 10s
+	Timeout time.Duration
+
+	// MaxBodySize is the max bytes of response body, the larger one is
+	// reported as error, zero means no limit.
+	// Default: 10MiB
+	MaxBodySize int64
+}
+
+func defaultHTTPReaderOption() *httpReaderOption {
+	return &httpReaderOption{
+		Client:      http.DefaultClient,
+		Header:      http.Header{},
+		Timeout:     10 * time.Second,
+		MaxBodySize: 10 << 20,
+	}
+}
+
+// WithHTTPClient will set the client option
+func WithHTTPClient(c *http.Client) ena.Option[httpReaderOption] {
+	return ena.NewFnOption(func(opt *httpReaderOption) {
+		opt.Client = c
+	})
+}
+
+// WithHTTPHeader will add the header of request
+func WithHTTPHeader(key string, value string) ena.Option[httpReaderOption] {
+	return ena.NewFnOption(func(opt *httpReaderOption) {
+		if opt.Header == nil {
+			opt.Header = http.Header{}
+		}
+		opt.Header.Add(key, value)
+	})
+}
+
+// WithHTTPTimeout will set the timeout option
+func WithHTTPTimeout(d time.Duration) ena.Option[httpReaderOption] {
+	return ena.NewFnOption(func(opt *httpReaderOption) {
+		opt.Timeout = d
+	})
+}
+
+// WithHTTPMaxBodySize will set the max body size option
+func WithHTTPMaxBodySize(n int64) ena.Option[httpReaderOption] {
+	return ena.NewFnOption(func(opt *httpReaderOption) {
+		opt.MaxBodySize = n
+	})
+}
+
+// HTTPConfigReader is the ConfigReader which read json object from
+// http endpoint, it can been watched by ConfigMgr.Watch.
+type HTTPConfigReader interface {
+	ContextConfigReader
+	ContextWatchableConfigReader
+}
+
+// NewHTTPConfigReader will return an http reader, which read the json
+// object from url by GET request. The 404 Not Found response is reported
+// as missing, see IsMissing.
+func NewHTTPConfigReader(url string, opts ...ena.Option[httpReaderOption]) HTTPConfigReader {
+	opt := defaultHTTPReaderOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	return &httpConfigReader{
+		url: url,
+		opt: opt,
+	}
+}
+
+func (r *httpConfigReader) ReadTo(store ConfigStorage) error {
+	return r.ReadToContext(context.Background(), store)
+}
+
+// ReadToContext will implement ContextConfigReader.ReadToContext method, the
+// cached response is used if the server response 304 Not Modified.
+func (r *httpConfigReader) ReadToContext(ctx context.Context, store ConfigStorage) error {
+	etag, body, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	d, err := defaultDecoderRegistry.Lookup(FormatJSON)
+	if err != nil {
+		return err
+	}
+	m, err := d(body)
+	if err != nil {
+		return xerrors.Wrapf(err, "decode response of '%s' failed", r.url)
+	}
+
+	hstore := withSource(store, Source{Reader: SourceHTTP, Detail: r.url})
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := hstore.Set(k, m[k]); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	r.readETag, r.readBody = etag, body
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *httpConfigReader) Changed() (bool, error) {
+	return r.ChangedContext(context.Background())
+}
+
+// ChangedContext will implement ContextWatchableConfigReader.ChangedContext
+// method, the response is treated as changed if the ETag (or the body if
+// there is no ETag) is different from the last ReadTo.
+func (r *httpConfigReader) ChangedContext(ctx context.Context) (bool, error) {
+	etag, body, err := r.fetch(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if etag != "" || r.readETag != "" {
+		return etag != r.readETag, nil
+	}
+	return !bytes.Equal(body, r.readBody), nil
+}
+
+// fetch will send the conditional request, and return the latest response.
+func (r *httpConfigReader) fetch(ctx context.Context) (string, []byte, error) {
+	if _, ok := ctx.Deadline(); !ok && r.opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opt.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	for k, vs := range r.opt.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+
+	r.mu.Lock()
+	etag, body := r.etag, r.body
+	r.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := r.opt.Client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		if body == nil {
+			return "", nil, xerrors.Errorf("unexpected 304 response of '%s' without cached body", r.url)
+		}
+		return etag, body, nil
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil, xerrors.Errorf("unexpected status '%s' of '%s': %w", resp.Status, r.url, ErrMissing)
+	default:
+		return "", nil, xerrors.Errorf("unexpected status '%s' of '%s'", resp.Status, r.url)
+	}
+
+	reader := io.Reader(resp.Body)
+	if r.opt.MaxBodySize > 0 {
+		// Read one more byte to detect the larger body
+		reader = io.LimitReader(resp.Body, r.opt.MaxBodySize+1)
+	}
+	body, err = io.ReadAll(reader)
+	if err != nil {
+		return "", nil, err
+	}
+	if r.opt.MaxBodySize > 0 && int64(len(body)) > r.opt.MaxBodySize {
+		return "", nil, xerrors.Errorf("response body of '%s' exceeds %d bytes", r.url, r.opt.MaxBodySize)
+	}
+	etag = resp.Header.Get("ETag")
+
+	r.mu.Lock()
+	r.etag, r.body = etag, body
+	r.mu.Unlock()
+	return etag, body, nil
+}
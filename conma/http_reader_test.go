@@ -0,0 +1,342 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+// testHTTPServer serve the json body with ETag, and record the requests.
+type testHTTPServer struct {
+	mu       sync.Mutex
+	body     string
+	version  int
+	delay    time.Duration
+	status   int
+	requests int
+	notMod   int
+	header   http.Header
+}
+
+func (s *testHTTPServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	s.header = req.Header.Clone()
+	body, etag, delay, status := s.body, fmt.Sprintf(`"v%d"`, s.version), s.delay, s.status
+	if req.Header.Get("If-None-Match") == etag {
+		s.notMod++
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(body))
+}
+
+func (s *testHTTPServer) update(fn func(s *testHTTPServer)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(s)
+}
+
+func (s *testHTTPServer) stats() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.notMod
+}
+
+func TestHTTPConfigReader(t *testing.T) {
+	g := NewWithT(t)
+
+	hs := &testHTTPServer{
+		body:    `{"db": {"host": "h1", "port": 3306}, "peers": ["p1", "p2"]}`,
+		version: 1,
+	}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	r := NewHTTPConfigReader(srv.URL, WithHTTPHeader("Authorization", "Bearer t1"))
+	s := newFlattenStorage()
+	g.Expect(r.ReadTo(s)).ToNot(HaveOccurred())
+	g.Expect(s.items).To(Equal(map[string]string{
+		"db.host":  "h1",
+		"db.port":  "3306",
+		"peers[0]": "p1",
+		"peers[1]": "p2",
+	}))
+	g.Expect(s.sources["db.host"]).To(Equal(Source{Reader: SourceHTTP, Detail: srv.URL}))
+	g.Expect(hs.header.Get("Authorization")).To(Equal("Bearer t1"))
+
+	// The unchanged response is not downloaded again
+	g.Expect(r.Changed()).To(BeFalse())
+	requests, notMod := hs.stats()
+	g.Expect(requests).To(Equal(2))
+	g.Expect(notMod).To(Equal(1))
+
+	hs.update(func(s *testHTTPServer) {
+		s.body = `{"db": {"host": "h2"}}`
+		s.version = 2
+	})
+	g.Expect(r.Changed()).To(BeTrue())
+	g.Expect(r.Changed()).To(BeTrue())
+
+	// The ReadTo will use the cached response of Changed
+	s = newFlattenStorage()
+	g.Expect(r.ReadToContext(context.Background(), s)).ToNot(HaveOccurred())
+	g.Expect(s.items).To(Equal(map[string]string{
+		"db.host": "h2",
+	}))
+	g.Expect(r.Changed()).To(BeFalse())
+	requests, notMod = hs.stats()
+	g.Expect(requests).To(Equal(6))
+	g.Expect(notMod).To(Equal(4))
+
+	t.Run("unexpected status", func(t *testing.T) {
+		g := NewWithT(t)
+
+		hs.update(func(s *testHTTPServer) {
+			s.status = http.StatusInternalServerError
+		})
+		defer hs.update(func(s *testHTTPServer) {
+			s.status = 0
+		})
+
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unexpected status '500 Internal Server Error'"))
+		g.Expect(IsMissing(err)).To(BeFalse())
+		_, err = r.Changed()
+		g.Expect(err).To(HaveOccurred())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		g := NewWithT(t)
+
+		hs.update(func(s *testHTTPServer) {
+			s.status = http.StatusNotFound
+		})
+		defer hs.update(func(s *testHTTPServer) {
+			s.status = 0
+		})
+
+		err := r.ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(IsMissing(err)).To(BeTrue())
+		_, err = r.Changed()
+		g.Expect(IsMissing(err)).To(BeTrue())
+
+		// The optional reader ignore the missing endpoint
+		or := NewOptionalConfigReader(NewHTTPConfigReader(srv.URL))
+		g.Expect(or.ReadTo(newFlattenStorage())).ToNot(HaveOccurred())
+		g.Expect(IsMissing(or.Ignored())).To(BeTrue())
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		g := NewWithT(t)
+
+		hs.update(func(s *testHTTPServer) {
+			s.body = `{"db": {"host": "h3"}}`
+			s.version = 4
+		})
+		err := NewHTTPConfigReader(srv.URL, WithHTTPMaxBodySize(8)).ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("exceeds 8 bytes"))
+
+		s := newFlattenStorage()
+		g.Expect(NewHTTPConfigReader(srv.URL, WithHTTPMaxBodySize(int64(len(`{"db": {"host": "h3"}}`)))).ReadTo(s)).ToNot(HaveOccurred())
+		g.Expect(s.items).To(Equal(map[string]string{"db.host": "h3"}))
+		g.Expect(NewHTTPConfigReader(srv.URL, WithHTTPMaxBodySize(0)).ReadTo(newFlattenStorage())).ToNot(HaveOccurred())
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		g := NewWithT(t)
+
+		hs.update(func(s *testHTTPServer) {
+			s.body = `{`
+			s.version = 3
+		})
+		err := NewHTTPConfigReader(srv.URL).ReadTo(newFlattenStorage())
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("decode response of"))
+	})
+}
+
+func TestConfigMgrReaderTimeout(t *testing.T) {
+	hs := &testHTTPServer{
+		body:  `{"k1": "v1"}`,
+		delay: time.Second,
+	}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	t.Run("manager timeout", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mgr := NewConfigMgrWithOptions([]ConfigReader{NewHTTPConfigReader(srv.URL)}, WithReaderTimeout(10*time.Millisecond))
+		err := mgr.ReadConfig()
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring(context.DeadlineExceeded.Error()))
+	})
+
+	t.Run("reader timeout override manager", func(t *testing.T) {
+		g := NewWithT(t)
+
+		hs.update(func(s *testHTTPServer) {
+			s.delay = 50 * time.Millisecond
+		})
+		mgr := NewConfigMgrWithOptions([]ConfigReader{
+			NewTimeoutConfigReader(NewHTTPConfigReader(srv.URL), time.Second),
+		}, WithReaderTimeout(10*time.Millisecond))
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		g.Expect(Get[string](mgr, "k1")).To(Equal("v1"))
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		called := false
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				called = true
+				return r.Set("k1", "v1")
+			},
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		g.Expect(mgr.ReadConfigContext(ctx)).To(MatchError(context.Canceled))
+		g.Expect(called).To(BeFalse())
+		g.Expect(mgr.IsSet("k1")).To(BeFalse())
+	})
+}
+
+func TestConfigMgrWatchHTTP(t *testing.T) {
+	g := NewWithT(t)
+
+	hs := &testHTTPServer{
+		body:    `{"k1": "v1"}`,
+		version: 1,
+	}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	mgr := NewConfigMgr(NewHTTPConfigReader(srv.URL))
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	changes := make(chan []Change, 1)
+	mgr.Subscribe("k1", func(c []Change) {
+		changes <- c
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	defer func() {
+		cancel()
+		<-done
+	}()
+	go func() {
+		defer close(done)
+		_ = mgr.Watch(ctx, WithWatchInterval(10*time.Millisecond))
+	}()
+
+	hs.update(func(s *testHTTPServer) {
+		s.body = `{"k1": "v2"}`
+		s.version = 2
+	})
+	g.Eventually(changes, time.Second).Should(Receive(Equal([]Change{
+		{Key: "k1", Type: ChangeUpdated, OldValue: "v1", NewValue: "v2"},
+	})))
+}
+
+func TestConfigMgrWatchHTTPCancel(t *testing.T) {
+	g := NewWithT(t)
+
+	hs := &testHTTPServer{
+		body:    `{"k1": "v1"}`,
+		version: 1,
+	}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	mgr := NewConfigMgr(NewHTTPConfigReader(srv.URL, WithHTTPTimeout(10*time.Second)))
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	// The check of Watch is blocked by the slow server
+	hs.update(func(s *testHTTPServer) {
+		s.delay = 10 * time.Second
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Watch(ctx, WithWatchInterval(10*time.Millisecond), WithWatchErrorHandler(func(context.Context, error) {}))
+	}()
+	g.Eventually(func() int {
+		requests, _ := hs.stats()
+		return requests
+	}, time.Second).Should(Equal(2))
+
+	// The request is cancelled with the Watch, not after the Timeout
+	cancel()
+	g.Eventually(done, time.Second).Should(Receive(MatchError(context.Canceled)))
+}
+
+func TestOptionalConfigReaderChangedContext(t *testing.T) {
+	g := NewWithT(t)
+
+	hs := &testHTTPServer{
+		body:    `{"k1": "v1"}`,
+		version: 1,
+		delay:   10 * time.Second,
+	}
+	srv := httptest.NewServer(hs)
+	defer srv.Close()
+
+	r := NewOptionalConfigReader(NewHTTPConfigReader(srv.URL, WithHTTPTimeout(10*time.Second)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := r.ChangedContext(ctx)
+	g.Expect(err).To(MatchError(context.DeadlineExceeded))
+	g.Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+}
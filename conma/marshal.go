@@ -0,0 +1,445 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// Marshal will write the current values of object o to store base on `conma`
+// struct tag, it's the reverse of Unmarshal:
+//  1. the nested struct and pointer to struct is written with accumulated prefix,
+//     the nil pointer is skipped
+//  2. the map is written as 'key.mapkey', the slice and array as 'key[index]'
+//  3. the fields of untagged embedded struct is promoted to current prefix
+//
+// The empty map and slice is skipped, because it cannot been represent by
+// flattened items.
+func Marshal(o interface{}, store ConfigStorage) error {
+	v := reflect.ValueOf(o)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return xerrors.Errorf("The target object must be an struct or pointer to struct, current is %s", v.String())
+	}
+	if !v.CanAddr() {
+		// Make it addressable so that the unexported fields can been read
+		pv := reflect.New(v.Type())
+		pv.Elem().Set(v)
+		v = pv.Elem()
+	}
+
+	// All fields is set in one write session
+	return marshalStruct(v, "", withSource(store, Source{}))
+}
+
+func marshalStruct(v reflect.Value, prefix string, store ConfigStorage) error {
+	for idx := 0; idx < v.NumField(); idx++ {
+		field := v.Type().Field(idx)
+		fd, err := NewFieldDescriptor(field, idx)
+		if err != nil {
+			return err
+		}
+
+		fv := v.Field(idx)
+		if !fv.CanInterface() {
+			// The field is unexported, we cannot directly use Interface
+			fv = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem()
+		}
+		if fd == nil {
+			if !field.Anonymous {
+				continue
+			}
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if err := marshalStruct(fv, prefix, store); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := marshalValue(fv, joinKey(prefix, fd.Name), store); err != nil {
+			return &FieldError{
+				Key:   joinKey(prefix, fd.Name),
+				Field: fd.FieldName,
+				Err:   err,
+			}
+		}
+	}
+
+	return nil
+}
+
+func marshalValue(v reflect.Value, key string, store ConfigStorage) error {
+	switch v.Kind() { //nolint
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return marshalValue(v.Elem(), key, store)
+	}
+	if conv.HasConverter(v.Type()) {
+		// The type with converter is scalar, such as time.Time and net.IP
+		s, err := scalarToString(v)
+		if err != nil {
+			return err
+		}
+		return store.Set(key, s)
+	}
+
+	switch v.Kind() { //nolint
+	case reflect.Struct:
+		return marshalStruct(v, key, store)
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i int, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for _, k := range keys {
+			kstr, err := scalarToString(k)
+			if err != nil {
+				return xerrors.Wrapf(err, "Cannot convert map's key '%v' to string", k)
+			}
+			if err := marshalValue(v.MapIndex(k), key+"."+kstr, store); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := marshalValue(v.Index(i), fmt.Sprintf("%s[%d]", key, i), store); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// The bool and number is set as it's underlying type, so that the type
+	// is kept, see Export
+	switch v.Kind() { //nolint
+	case reflect.Bool:
+		return store.Set(key, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return store.Set(key, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return store.Set(key, v.Uint())
+	case reflect.Float32:
+		return store.Set(key, float32(v.Float()))
+	case reflect.Float64:
+		return store.Set(key, v.Float())
+	}
+
+	s, err := scalarToString(v)
+	if err != nil {
+		return err
+	}
+	return store.Set(key, s)
+}
+
+// scalarToString will convert v to string by conv.ToString, the named
+// type (such as `type Level string`) is converted to it's underlying type.
+func scalarToString(v reflect.Value) (string, error) {
+	s, err := conv.ToString(v.Interface())
+	if err == nil {
+		return s, nil
+	}
+
+	switch v.Kind() { //nolint
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, v.Type().Bits()), nil
+	case reflect.String:
+		return v.String(), nil
+	}
+
+	return "", err
+}
+
+// structConfigReader will read the current values of struct by Marshal.
+type structConfigReader struct {
+	o interface{}
+}
+
+// NewStructConfigReader will return an ConfigReader which read the current
+// values of struct (or pointer to struct) o, it's useful to provide the
+// defaults, or write the struct to file with ConfigMgr.Export.
+func NewStructConfigReader(o interface{}) ConfigReader {
+	return &structConfigReader{
+		o: o,
+	}
+}
+
+func (r *structConfigReader) ReadTo(store ConfigStorage) error {
+	return Marshal(r.o, store)
+}
+
+// Export will serialize the effective configuration items to nested yaml
+// or json, the flattened keys are expanded to nested maps and slices:
+//  1. the items which is set by bool or number value is kept as it's type,
+//     others are written as string
+//  2. the secret items are written as the unresolved reference (such as
+//     'file:///run/secrets/db') instead of the secret value, it's marked by
+//     the '# secret' comment in yaml, json have no marker. The reference is
+//     resolved again only if it's read with WithResolve
+//  3. the items which cannot been nested are written with flattened key
+//     to the nearest map, such as 'a.b' when 'a' is also a value
+func (m *configMgr) Export(format string) ([]byte, error) {
+	nested, err := m.snapshot().nested()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(nested)
+	case FormatJSON:
+		return json.MarshalIndent(nested, "", "  ")
+	}
+	return nil, xerrors.WrapNotFound("encoder for format '%s' not found", format)
+}
+
+// secretValue is the unresolved reference of secret item.
+type secretValue string
+
+// MarshalYAML will mark the secret value by comment.
+func (v secretValue) MarshalYAML() (interface{}, error) {
+	return &yaml.Node{
+		Kind:        yaml.ScalarNode,
+		Tag:         "!!str",
+		Value:       string(v),
+		LineComment: "secret",
+	}, nil
+}
+
+// typedValue will convert the item value v back to the kind which it's set
+// by, the v is returned if the kind is not bool or number.
+func typedValue(v string, kind reflect.Kind) interface{} {
+	var (
+		ret interface{}
+		err error
+	)
+	switch kind { //nolint
+	case reflect.Bool:
+		ret, err = strconv.ParseBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		ret, err = strconv.ParseInt(v, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		ret, err = strconv.ParseUint(v, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		ret, err = strconv.ParseFloat(v, 64)
+	default:
+		return v
+	}
+	if err != nil {
+		return v
+	}
+	return ret
+}
+
+// nestedNode is the tree node of flattened keys.
+type nestedNode struct {
+	value    interface{}
+	children map[string]*nestedNode
+	items    map[int64]*nestedNode
+}
+
+// nested will expand the flattened items to nested maps and slices, the
+// slice is compacted by index as doGetSlice.
+func (s *flattenStorage) nested() (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	root := &nestedNode{}
+	for k, v := range s.items {
+		n := root
+		segments, err := splitKey(k)
+		if err != nil {
+			return nil, err
+		}
+		for _, seg := range segments {
+			n = n.child(seg)
+		}
+
+		n.value = typedValue(v, s.kinds[k])
+		if raw, ok := s.secrets[k]; ok {
+			n.value = secretValue(raw)
+		}
+	}
+
+	ret, _ := root.build()
+	switch m := ret.(type) {
+	case nil:
+		return map[string]interface{}{}, nil
+	case map[string]interface{}:
+		return m, nil
+	}
+	return nil, xerrors.Errorf("the root of items must be a map, current is %T", ret)
+}
+
+// keySegment is the name or index part of key
+type keySegment struct {
+	name  string
+	index int64
+	isIdx bool
+}
+
+// splitKey will split the key such as 'a.b[0].c' to segments.
+func splitKey(key string) ([]keySegment, error) {
+	segments := []keySegment{}
+	for _, part := range strings.Split(key, ".") {
+		name := part
+		idx := strings.IndexByte(part, '[')
+		if idx >= 0 {
+			name = part[:idx]
+		}
+		if name != "" {
+			segments = append(segments, keySegment{name: name})
+		}
+
+		for idx >= 0 {
+			part = part[idx:]
+			end := strings.IndexByte(part, ']')
+			if end < 0 {
+				return nil, xerrors.Errorf("invalid key '%s'", key)
+			}
+			i, err := strconv.ParseInt(part[1:end], 10, 64)
+			if err != nil {
+				return nil, xerrors.Wrapf(err, "invalid index of key '%s'", key)
+			}
+			segments = append(segments, keySegment{index: i, isIdx: true})
+
+			part = part[end+1:]
+			idx = strings.IndexByte(part, '[')
+			if idx != 0 && part != "" {
+				return nil, xerrors.Errorf("invalid key '%s'", key)
+			}
+		}
+	}
+
+	return segments, nil
+}
+
+func (n *nestedNode) child(seg keySegment) *nestedNode {
+	if seg.isIdx {
+		if n.items == nil {
+			n.items = map[int64]*nestedNode{}
+		}
+		c, ok := n.items[seg.index]
+		if !ok {
+			c = &nestedNode{}
+			n.items[seg.index] = c
+		}
+		return c
+	}
+
+	if n.children == nil {
+		n.children = map[string]*nestedNode{}
+	}
+	c, ok := n.children[seg.name]
+	if !ok {
+		c = &nestedNode{}
+		n.children[seg.name] = c
+	}
+	return c
+}
+
+// build return the nested value of n, and the items under n which cannot
+// been nested with the key relative to n, such as '.b' and '[0].b'. They're
+// conflict with the value of n, or the map and slice is both under n.
+func (n *nestedNode) build() (interface{}, map[string]interface{}) {
+	switch {
+	case n.value != nil:
+		rest := map[string]interface{}{}
+		(&nestedNode{children: n.children, items: n.items}).flatten("", rest)
+		return n.value, rest
+	case n.children != nil:
+		ret := make(map[string]interface{}, len(n.children))
+		for name, c := range n.children {
+			v, rest := c.build()
+			ret[name] = v
+			for k, rv := range rest {
+				ret[name+k] = rv
+			}
+		}
+
+		rest := map[string]interface{}{}
+		(&nestedNode{items: n.items}).flatten("", rest)
+		return ret, rest
+	case n.items != nil:
+		indexes := make([]int64, 0, len(n.items))
+		for i := range n.items {
+			indexes = append(indexes, i)
+		}
+		sort.Slice(indexes, func(i int, j int) bool {
+			return indexes[i] < indexes[j]
+		})
+
+		ret := make([]interface{}, 0, len(indexes))
+		rest := map[string]interface{}{}
+		for j, i := range indexes {
+			v, irest := n.items[i].build()
+			ret = append(ret, v)
+			for k, rv := range irest {
+				// The index is compacted as the slice
+				rest[fmt.Sprintf("[%d]%s", j, k)] = rv
+			}
+		}
+		return ret, rest
+	}
+
+	return nil, nil
+}
+
+// flatten will write the values of n and it's children to ret with the
+// flattened key.
+func (n *nestedNode) flatten(key string, ret map[string]interface{}) {
+	if n.value != nil {
+		ret[key] = n.value
+	}
+	for name, c := range n.children {
+		c.flatten(key+"."+name, ret)
+	}
+	for i, c := range n.items {
+		c.flatten(fmt.Sprintf("%s[%d]", key, i), ret)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testLevel string
+
+type testMarshalObj struct {
+	testBase
+	*testBase2
+
+	Level     testLevel                `conma:"level"`
+	Timeout   time.Duration            `conma:"timeout"`
+	Peers     []string                 `conma:"peers"`
+	Upstreams []testUpstream           `conma:"upstreams"`
+	Routes    map[string]*testUpstream `conma:"routes"`
+	TLS       *testTLSConfig           `conma:"tls"`
+	DB        struct {
+		port int `conma:"port"`
+	} `conma:"db"`
+	Empty   []string `conma:"empty"`
+	ignored string
+}
+
+func TestMarshal(t *testing.T) {
+	g := NewWithT(t)
+
+	o := testMarshalObj{
+		testBase:  testBase{Name: "n1"},
+		Level:     "debug",
+		Timeout:   time.Second,
+		Peers:     []string{"p1", "p2"},
+		Upstreams: []testUpstream{{Host: "h1", Weight: 2}},
+		Routes: map[string]*testUpstream{
+			"r1": {Host: "h2", Weight: 1},
+			"r2": nil,
+		},
+		ignored: "i1",
+	}
+	o.DB.port = 3306
+
+	s := newFlattenStorage()
+	g.Expect(Marshal(o, s)).ToNot(HaveOccurred())
+	g.Expect(s.items).To(Equal(map[string]string{
+		"name":                "n1",
+		"level":               "debug",
+		"timeout":             "1s",
+		"peers[0]":            "p1",
+		"peers[1]":            "p2",
+		"upstreams[0].host":   "h1",
+		"upstreams[0].weight": "2",
+		"routes.r1.host":      "h2",
+		"routes.r1.weight":    "1",
+		"db.port":             "3306",
+	}))
+
+	// Unmarshal will get the same object, except the skipped nil and empty values
+	g.Expect(s.Set("empty", "")).ToNot(HaveOccurred())
+	g.Expect(s.Set("version", "v2")).ToNot(HaveOccurred())
+	mgr := &configMgr{store: s}
+	var out testMarshalObj
+	g.Expect(mgr.Unmarshal(&out)).ToNot(HaveOccurred())
+	o.testBase2 = &testBase2{Version: "v2"}
+	o.Routes = map[string]*testUpstream{"r1": o.Routes["r1"]}
+	o.Empty = []string{""}
+	o.ignored = ""
+	g.Expect(out).To(Equal(o))
+
+	err := Marshal(1, s)
+	g.Expect(err).To(HaveOccurred())
+
+	err = Marshal(struct {
+		V chan int `conma:"v"`
+	}{V: make(chan int)}, s)
+	g.Expect(err).To(HaveOccurred())
+	var fe *FieldError
+	g.Expect(xerrors.As(err, &fe)).To(BeTrue())
+	g.Expect(fe.Key).To(Equal("v"))
+}
+
+func TestConfigMgrExport(t *testing.T) {
+	g := NewWithT(t)
+
+	mgr := NewConfigMgrWithOptions([]ConfigReader{
+		NewStructConfigReader(&testMarshalObj{
+			testBase:  testBase{Name: "n1"},
+			Peers:     []string{"p1"},
+			Upstreams: []testUpstream{{Host: "h1", Weight: 2}},
+		}),
+		&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				if err := r.Set("debug", true); err != nil {
+					return err
+				}
+				if err := r.Set("timeout.unit", "s"); err != nil {
+					return err
+				}
+				return r.Set("peers[3]", "p3")
+			},
+		},
+	}, WithMergeRule("peers", MergeIndex))
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	expect := func(two interface{}, zero interface{}) map[string]interface{} {
+		return map[string]interface{}{
+			"name":         "n1",
+			"level":        "",
+			"debug":        true,
+			"timeout":      "0s",
+			"timeout.unit": "s",
+			"peers":        []interface{}{"p1", "p3"},
+			"upstreams":    []interface{}{map[string]interface{}{"host": "h1", "weight": two}},
+			"db":           map[string]interface{}{"port": zero},
+		}
+	}
+
+	data, err := mgr.Export(FormatYAML)
+	g.Expect(err).ToNot(HaveOccurred())
+	var ym map[string]interface{}
+	g.Expect(yaml.Unmarshal(data, &ym)).ToNot(HaveOccurred())
+	g.Expect(ym).To(Equal(expect(2, 0)))
+
+	// The exported items can been read back, the slice is compacted
+	file := filepath.Join(t.TempDir(), "export.yaml")
+	g.Expect(os.WriteFile(file, data, 0o600)).ToNot(HaveOccurred())
+	rmgr := NewConfigMgr(NewFileConfigReader(file))
+	g.Expect(rmgr.ReadConfig()).ToNot(HaveOccurred())
+	rdata, err := rmgr.Export(FormatYAML)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(rdata)).To(Equal(string(data)))
+
+	data, err = mgr.Export(FormatJSON)
+	g.Expect(err).ToNot(HaveOccurred())
+	var jm map[string]interface{}
+	g.Expect(json.Unmarshal(data, &jm)).ToNot(HaveOccurred())
+	g.Expect(jm).To(Equal(expect(float64(2), float64(0))))
+
+	_, err = mgr.Export(FormatTOML)
+	g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestFlattenStorageNested(t *testing.T) {
+	type testcase struct {
+		desp   string
+		items  map[string]string
+		expect map[string]interface{}
+		err    string
+	}
+	testcases := []testcase{
+		{
+			desp:   "empty",
+			items:  map[string]string{},
+			expect: map[string]interface{}{},
+		},
+		{
+			desp: "normal test",
+			items: map[string]string{
+				"a.b[0][1]": "v1",
+				"a.b[0][0]": "v0",
+				"a.c":       "v2",
+				"d[2].e":    "v3",
+			},
+			expect: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b": []interface{}{[]interface{}{"v0", "v1"}},
+					"c": "v2",
+				},
+				"d": []interface{}{map[string]interface{}{"e": "v3"}},
+			},
+		},
+		{
+			desp: "value and parent",
+			items: map[string]string{
+				"a":   "v1",
+				"a.b": "v2",
+			},
+			expect: map[string]interface{}{
+				"a":   "v1",
+				"a.b": "v2",
+			},
+		},
+		{
+			desp: "map and slice",
+			items: map[string]string{
+				"a[0]": "v1",
+				"a.b":  "v2",
+			},
+			expect: map[string]interface{}{
+				"a":    map[string]interface{}{"b": "v2"},
+				"a[0]": "v1",
+			},
+		},
+		{
+			desp: "value and parent in slice",
+			items: map[string]string{
+				"a.b[1]":      "v1",
+				"a.b[1].c":    "v2",
+				"a.b[1].d[0]": "v3",
+			},
+			expect: map[string]interface{}{
+				"a": map[string]interface{}{
+					"b":         []interface{}{"v1"},
+					"b[0].c":    "v2",
+					"b[0].d[0]": "v3",
+				},
+			},
+		},
+		{
+			desp: "invalid index",
+			items: map[string]string{
+				"a[x]": "v1",
+			},
+			err: `invalid index of key 'a[x]'`,
+		},
+		{
+			desp: "root slice",
+			items: map[string]string{
+				"[0]": "v1",
+			},
+			err: `the root of items must be a map`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s := &flattenStorage{items: tc.items}
+			m, err := s.nested()
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(m).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestFlattenStorageNestedSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	s := newFlattenStorage()
+	g.Expect(s.Set("db.password", "${DB_PASSWORD}")).ToNot(HaveOccurred())
+	g.Expect(s.resolve(&resolverRegistry{})).To(HaveOccurred())
+
+	s.items["db.password"] = "p1"
+	s.secrets["db.password"] = "${DB_PASSWORD}"
+	m, err := s.nested()
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(m).To(Equal(map[string]interface{}{
+		"db": map[string]interface{}{"password": secretValue("${DB_PASSWORD}")},
+	}))
+
+	// The secret is marked in yaml
+	data, err := yaml.Marshal(m)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(string(data)).To(Equal("db:\n    password: ${DB_PASSWORD} # secret\n"))
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// MergeRule is the rule to merge the value of key, when it's declared by
+// multiple files of one file reader (such as include and profile).
+type MergeRule int
+
+const (
+	// MergeDefault will merge the map deeply, and replace the others
+	MergeDefault MergeRule = iota
+
+	// MergeReplace will replace the value, include the map
+	MergeReplace
+
+	// MergeAppend will append the slice to the previous one
+	MergeAppend
+
+	// MergeIndex will merge the slice by index, the element is merged with
+	// the element of previous one at the same index
+	MergeIndex
+)
+
+// sourcedValue is the leaf value of decoded file with the file path.
+type sourcedValue struct {
+	v    interface{}
+	file string
+}
+
+// withFileSource will normalize the decoded value v to map[string]interface{}
+// and []interface{}, and wrap all leaves with the file.
+func withFileSource(v interface{}, file string) (interface{}, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() { //nolint
+	case reflect.Map:
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			kstr, err := conv.ToString(k.Interface())
+			if err != nil {
+				return nil, xerrors.Wrapf(err, "Cannot convert map's key '%v' to string", k)
+			}
+			e, err := withFileSource(rv.MapIndex(k).Interface(), file)
+			if err != nil {
+				return nil, err
+			}
+			m[kstr] = e
+		}
+		return m, nil
+	case reflect.Slice, reflect.Array:
+		s := make([]interface{}, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			e, err := withFileSource(rv.Index(i).Interface(), file)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, e)
+		}
+		return s, nil
+	}
+
+	return &sourcedValue{v: v, file: file}, nil
+}
+
+// mergeValue will merge the src to dst of key by the rules, the dst may
+// been modified.
+func mergeValue(rules map[string]MergeRule, key string, dst interface{}, src interface{}) interface{} {
+	rule := rules[key]
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok || rule == MergeReplace {
+			return s
+		}
+
+		for k, v := range s {
+			d[k] = mergeValue(rules, joinKey(key, k), d[k], v)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok {
+			return s
+		}
+
+		switch rule { //nolint
+		case MergeAppend:
+			return append(d, s...)
+		case MergeIndex:
+			for i, v := range s {
+				if i < len(d) {
+					d[i] = mergeValue(rules, fmt.Sprintf("%s[%d]", key, i), d[i], v)
+				} else {
+					d = append(d, v)
+				}
+			}
+			return d
+		}
+		return s
+	}
+
+	return src
+}
+
+// setSourcedValue will set all leaves of v to store with the flattened key
+// and the file source.
+func setSourcedValue(store ConfigStorage, key string, v interface{}) error {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			if err := setSourcedValue(store, joinKey(key, k), vv[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []interface{}:
+		if len(vv) == 0 {
+			// Set the empty slice to replace the previous list
+			return store.Set(key, vv)
+		}
+		for i, e := range vv {
+			if err := setSourcedValue(store, fmt.Sprintf("%s[%d]", key, i), e); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *sourcedValue:
+		return withSource(store, Source{Reader: SourceFile, Detail: vv.file}).Set(key, vv.v)
+	}
+
+	return store.Set(key, v)
+}
@@ -46,6 +46,8 @@ func NewOptionConfigReader() ConfigReader {
 func (r *optionConfigReader) ReadTo(store ConfigStorage) error {
 	for _, arg := range argsFn() {
 		parts := strings.SplitN(arg, "=", 2)
+		// The value is not in the detail, it may be a secret
+		ostore := withSource(store, Source{Reader: SourceOption, Detail: parts[0]})
 		switch len(parts) {
 		case 1:
 			key := strings.TrimLeft(parts[0], "-")
@@ -53,7 +55,7 @@ func (r *optionConfigReader) ReadTo(store ConfigStorage) error {
 				continue
 			}
 
-			if err := store.Set(key, true); err != nil {
+			if err := ostore.Set(key, true); err != nil {
 				return err
 			}
 		case 2:
@@ -65,12 +67,12 @@ func (r *optionConfigReader) ReadTo(store ConfigStorage) error {
 			rawValues := parts[1]
 			values := strings.Split(rawValues, ",")
 			if len(values) > 1 {
-				err := store.Set(key, values)
+				err := ostore.Set(key, values)
 				if err != nil {
 					return err
 				}
 			} else {
-				err := store.Set(key, rawValues)
+				err := ostore.Set(key, rawValues)
 				if err != nil {
 					return err
 				}
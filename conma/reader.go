@@ -19,6 +19,22 @@
 
 package conma
 
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+var (
+	// ErrMissing is returned by reader when the source is not exist, such
+	// as the file is not found or the http endpoint response 404.
+	ErrMissing = xerrors.New("conma: source is missing")
+)
+
 // ConfigStorage is the storage for persistent all configuration
 // items.
 type ConfigStorage interface {
@@ -30,3 +46,266 @@ type ConfigStorage interface {
 type ConfigReader interface {
 	ReadTo(store ConfigStorage) error
 }
+
+// ContextConfigReader is the ConfigReader which can been cancelled by
+// context, such as the slow or remote reader. The ConfigMgr will use
+// ReadToContext instead of ReadTo if the reader implement it.
+type ContextConfigReader interface {
+	ConfigReader
+
+	ReadToContext(ctx context.Context, store ConfigStorage) error
+}
+
+// timeoutConfigReader will read with the timeout.
+type timeoutConfigReader struct {
+	r       ConfigReader
+	timeout time.Duration
+}
+
+// NewTimeoutConfigReader will return the reader which read from r with the
+// timeout, it will override the reader timeout option of ConfigMgr. If the r
+// is not ContextConfigReader, it cannot been cancelled after started, only
+// the ctx is checked before that.
+func NewTimeoutConfigReader(r ConfigReader, timeout time.Duration) ContextConfigReader {
+	return &timeoutConfigReader{
+		r:       r,
+		timeout: timeout,
+	}
+}
+
+// Unwrap return the underlying reader.
+func (r *timeoutConfigReader) Unwrap() ConfigReader {
+	return r.r
+}
+
+func (r *timeoutConfigReader) ReadTo(store ConfigStorage) error {
+	return r.ReadToContext(context.Background(), store)
+}
+
+func (r *timeoutConfigReader) ReadToContext(ctx context.Context, store ConfigStorage) error {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	return readWithContext(ctx, r.r, store)
+}
+
+// readWithContext will read from r with ctx if it's ContextConfigReader,
+// otherwise the ctx is checked before read.
+func readWithContext(ctx context.Context, r ConfigReader, store ConfigStorage) error {
+	if cr, ok := r.(ContextConfigReader); ok {
+		return cr.ReadToContext(ctx, store)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.ReadTo(store)
+}
+
+// WatchableConfigReader is the ConfigReader which can report whether
+// the underlying source has been modified since the last ReadTo, it's
+// used by ConfigMgr.Watch to decide when to reload.
+type WatchableConfigReader interface {
+	ConfigReader
+
+	// Changed returns true if the source has been modified since
+	// the last ReadTo.
+	Changed() (bool, error)
+}
+
+// ContextWatchableConfigReader is the WatchableConfigReader which can been
+// cancelled by context, such as the remote reader. The ConfigMgr.Watch will
+// use ChangedContext instead of Changed if the reader implement it.
+type ContextWatchableConfigReader interface {
+	WatchableConfigReader
+
+	ChangedContext(ctx context.Context) (bool, error)
+}
+
+// changedWithContext will check r with ctx if it's ContextWatchableConfigReader,
+// otherwise the ctx is checked before that.
+func changedWithContext(ctx context.Context, r WatchableConfigReader) (bool, error) {
+	if cr, ok := r.(ContextWatchableConfigReader); ok {
+		return cr.ChangedContext(ctx)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return r.Changed()
+}
+
+// IsMissing return true if the err means the source of reader is not
+// exist (see ErrMissing), such as the file is not found. The errors of
+// source content, such as the unknown format or the missing included
+// file, is not missing.
+func IsMissing(err error) bool {
+	return xerrors.Is(err, ErrMissing)
+}
+
+// OptionalConfigReader is the reader which ignore some errors of the
+// underlying reader, the ignored error can been inspected by Ignored.
+type OptionalConfigReader interface {
+	ContextConfigReader
+	ContextWatchableConfigReader
+
+	// Ignored return the error which is ignored by the last ReadTo, nil
+	// means the last ReadTo is succeed.
+	Ignored() error
+}
+
+// optionalConfigReader will ignore the errors which is accepted by ignore.
+type optionalConfigReader struct {
+	r      ConfigReader
+	ignore func(err error) bool
+
+	mu sync.Mutex
+	// ignored is the error ignored by the last ReadTo
+	ignored error
+}
+
+// NewOptionalConfigReader will return the reader which ignore the error of
+// r when the source is missing (see IsMissing), such as the optional
+// 'local.yaml'. The other errors is still returned.
+func NewOptionalConfigReader(r ConfigReader) OptionalConfigReader {
+	return &optionalConfigReader{
+		r:      r,
+		ignore: IsMissing,
+	}
+}
+
+// NewBestEffortConfigReader will return the reader which ignore all errors
+// of r except the context is done, the items set before the error is kept.
+func NewBestEffortConfigReader(r ConfigReader) OptionalConfigReader {
+	return &optionalConfigReader{
+		r: r,
+		ignore: func(err error) bool {
+			return !xerrors.Is(err, context.Canceled) && !xerrors.Is(err, context.DeadlineExceeded)
+		},
+	}
+}
+
+// Unwrap return the underlying reader.
+func (r *optionalConfigReader) Unwrap() ConfigReader {
+	return r.r
+}
+
+func (r *optionalConfigReader) Ignored() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.ignored
+}
+
+func (r *optionalConfigReader) ReadTo(store ConfigStorage) error {
+	return r.ReadToContext(context.Background(), store)
+}
+
+func (r *optionalConfigReader) ReadToContext(ctx context.Context, store ConfigStorage) error {
+	err := readWithContext(ctx, r.r, store)
+	if err != nil && !r.ignore(err) {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ignored = err
+	return nil
+}
+
+func (r *optionalConfigReader) Changed() (bool, error) {
+	return r.ChangedContext(context.Background())
+}
+
+// ChangedContext will implement ContextWatchableConfigReader.ChangedContext
+// method, the ignored error of underlying reader is treated as changed if
+// the last ReadTo is succeed, and the recovered reader is always treated as
+// changed. It's always false if the underlying reader is not watchable.
+func (r *optionalConfigReader) ChangedContext(ctx context.Context) (bool, error) {
+	wr, ok := r.r.(WatchableConfigReader)
+	if !ok {
+		return false, nil
+	}
+
+	ignored := r.Ignored()
+	changed, err := changedWithContext(ctx, wr)
+	switch {
+	case err != nil && r.ignore(err):
+		return ignored == nil, nil
+	case err != nil:
+		return false, err
+	}
+	return changed || ignored != nil, nil
+}
+
+// readerName return the name of reader for source and error, the wrapper
+// such as optional and timeout reader is skipped.
+func readerName(r ConfigReader) string {
+	for {
+		u, ok := r.(interface{ Unwrap() ConfigReader })
+		if !ok {
+			return fmt.Sprintf("%T", r)
+		}
+		r = u.Unwrap()
+	}
+}
+
+// ReaderError is the error returned by one ConfigReader.
+type ReaderError struct {
+	// Reader is the name of reader, such as '*conma.fileConfigReader'
+	Reader string
+
+	// Key is the key which failed to set to storage, it's empty if the
+	// reader failed before that, such as the file cannot been read.
+	Key string
+
+	Err error
+}
+
+func (e *ReaderError) Error() string {
+	if e.Key == "" {
+		return fmt.Sprintf("reader %s: %v", e.Reader, e.Err)
+	}
+
+	return fmt.Sprintf("reader %s (key %s): %v", e.Reader, e.Key, e.Err)
+}
+
+func (e *ReaderError) Unwrap() error {
+	return e.Err
+}
+
+// ReadError is the aggregated errors of all failed ConfigReader.
+type ReadError struct {
+	Errors []*ReaderError
+}
+
+func (e *ReadError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, re := range e.Errors {
+		msgs = append(msgs, re.Error())
+	}
+
+	return fmt.Sprintf("%d reader(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap will return all reader errors, so the xerrors.Is and xerrors.As
+// can match any of them.
+func (e *ReadError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, re := range e.Errors {
+		errs = append(errs, re)
+	}
+	return errs
+}
+
+// ErrorOrNil return nil if there is no error.
+func (e *ReadError) ErrorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
@@ -0,0 +1,302 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// Resolver will resolve the reference to it's actual value, the ref is
+// the part after 'scheme://' of configuration value, such as
+// '/run/secrets/db' of 'file:///run/secrets/db'.
+type Resolver func(ref string) (string, error)
+
+const (
+	// SchemeFile is the scheme of file-backed reference, the value is
+	// the content of file with trailing newlines trimmed.
+	SchemeFile = "file"
+)
+
+var (
+	lookupEnvFn = os.LookupEnv
+
+	schemeRegexp = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.-]*)://(.*)$`)
+)
+
+type resolverOption struct {
+	// Secret will mark the resolved value as secret, which will been
+	// redacted by Explain and Dump.
+	// Default: true
+	Secret bool
+}
+
+func defaultResolverOption() *resolverOption {
+	return &resolverOption{
+		Secret: true,
+	}
+}
+
+// WithResolverSecret will set the secret option
+func WithResolverSecret(secret bool) ena.Option[resolverOption] {
+	return ena.NewFnOption(func(opt *resolverOption) {
+		opt.Secret = secret
+	})
+}
+
+type resolverEntry struct {
+	fn  Resolver
+	opt *resolverOption
+}
+
+// resolverRegistry is the registry of Resolver by scheme.
+type resolverRegistry struct {
+	mu        sync.RWMutex
+	resolvers map[string]*resolverEntry
+}
+
+var (
+	defaultResolverRegistry = &resolverRegistry{
+		resolvers: map[string]*resolverEntry{},
+	}
+)
+
+// RegisterResolver will register the resolver for scheme, the configuration
+// value like 'scheme://ref' will been replaced by the result of it after read.
+// It will return duplicate error if the scheme is registered.
+func RegisterResolver(scheme string, r Resolver, opts ...ena.Option[resolverOption]) error {
+	return defaultResolverRegistry.Register(scheme, r, opts...)
+}
+
+func (r *resolverRegistry) Register(scheme string, fn Resolver, opts ...ena.Option[resolverOption]) error {
+	opt := defaultResolverOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if _, ok := r.resolvers[scheme]; ok {
+		return xerrors.WrapDuplicate("resolver for scheme '%s' is already registered", scheme)
+	}
+
+	r.resolvers[scheme] = &resolverEntry{
+		fn:  fn,
+		opt: opt,
+	}
+	return nil
+}
+
+// Lookup will return the resolver for scheme.
+func (r *resolverRegistry) Lookup(scheme string) (*resolverEntry, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	e, ok := r.resolvers[strings.ToLower(scheme)]
+	return e, ok
+}
+
+func resolveFile(ref string) (string, error) {
+	data, err := readFileFn(ref)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// referenceResolver will resolve all items of storage, the result is
+// cached so that every key is resolved only once.
+type referenceResolver struct {
+	s        *flattenStorage
+	r        *resolverRegistry
+	resolved map[string]string
+	secrets  map[string]string
+	visiting map[string]struct{}
+}
+
+// resolve will resolve the references in all items of storage, it
+// contains two stages:
+//  1. expand the '${name}' with the value of key 'name', or the env 'name'
+//     if the key is not exist, '$${' is the escape of literal '${'
+//  2. replace the 'scheme://ref' with the result of registered Resolver
+//
+// The item is marked as secret if it's resolved by secret Resolver or
+// expanded with secret item or env, the env is always treated as secret
+// because it's the common way to inject the credential. The items resolved by previous call is
+// skipped, and the storage is not modified if any failed.
+func (s *flattenStorage) resolve(r *resolverRegistry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rr := &referenceResolver{
+		s:        s,
+		r:        r,
+		resolved: map[string]string{},
+		secrets:  map[string]string{},
+		visiting: map[string]struct{}{},
+	}
+
+	keys := make([]string, 0, len(s.items))
+	for k := range s.items {
+		if _, ok := s.resolved[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if _, err := rr.resolveKey(k); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range rr.resolved {
+		s.items[k] = v
+		delete(s.kinds, k)
+	}
+	if s.secrets == nil {
+		s.secrets = map[string]string{}
+	}
+	for k, raw := range rr.secrets {
+		s.secrets[k] = raw
+	}
+	if s.resolved == nil {
+		s.resolved = map[string]struct{}{}
+	}
+	for k := range rr.resolved {
+		s.resolved[k] = struct{}{}
+	}
+	return nil
+}
+
+func (rr *referenceResolver) resolveKey(key string) (string, error) {
+	if v, ok := rr.resolved[key]; ok {
+		return v, nil
+	}
+	if _, ok := rr.s.resolved[key]; ok {
+		if raw, ok := rr.s.secrets[key]; ok {
+			rr.secrets[key] = raw
+		}
+		return rr.s.items[key], nil
+	}
+	if _, ok := rr.visiting[key]; ok {
+		return "", xerrors.Errorf("reference cycle detected at key '%s'", key)
+	}
+	rr.visiting[key] = struct{}{}
+	defer delete(rr.visiting, key)
+
+	v, err := rr.interpolate(key, rr.s.items[key])
+	if err != nil {
+		return "", xerrors.Wrapf(err, "resolve value of key '%s' failed", key)
+	}
+
+	if m := schemeRegexp.FindStringSubmatch(v); m != nil {
+		if e, ok := rr.r.Lookup(m[1]); ok {
+			v, err = e.fn(m[2])
+			if err != nil {
+				return "", xerrors.Wrapf(err, "resolve value of key '%s' with scheme '%s' failed", key, m[1])
+			}
+			if e.opt.Secret {
+				rr.secrets[key] = rr.s.items[key]
+			}
+		}
+	}
+
+	rr.resolved[key] = v
+	return v, nil
+}
+
+func (rr *referenceResolver) interpolate(key string, v string) (string, error) {
+	if !strings.Contains(v, "${") {
+		return v, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.Index(v, "${")
+		if i < 0 {
+			b.WriteString(v)
+			break
+		}
+		if i > 0 && v[i-1] == '$' {
+			// The '$${' is escaped to literal '${'
+			b.WriteString(v[:i-1])
+			b.WriteString("${")
+			v = v[i+2:]
+			continue
+		}
+
+		b.WriteString(v[:i])
+		j := strings.IndexByte(v[i:], '}')
+		if j < 0 {
+			return "", xerrors.Errorf("unclosed reference in '%s'", v[i:])
+		}
+		name := strings.TrimSpace(v[i+2 : i+j])
+		if name == "" {
+			return "", xerrors.Errorf("empty reference in '%s'", v)
+		}
+
+		val, err := rr.lookup(key, name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(val)
+		v = v[i+j+1:]
+	}
+
+	return b.String(), nil
+}
+
+// lookup return the value of key name, or the env name if the key is
+// not exist, the key is marked as secret if it's expanded with env.
+func (rr *referenceResolver) lookup(key string, name string) (string, error) {
+	if _, ok := rr.s.items[name]; ok {
+		val, err := rr.resolveKey(name)
+		if err != nil {
+			return "", err
+		}
+		if _, ok := rr.secrets[name]; ok {
+			rr.secrets[key] = rr.s.items[key]
+		}
+		return val, nil
+	}
+
+	if val, ok := lookupEnvFn(name); ok {
+		rr.secrets[key] = rr.s.items[key]
+		return val, nil
+	}
+
+	return "", xerrors.WrapNotFound("reference '%s' is neither a key nor an env", name)
+}
+
+func init() {
+	if err := RegisterResolver(SchemeFile, resolveFile); err != nil {
+		panic(err)
+	}
+}
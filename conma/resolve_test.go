@@ -0,0 +1,256 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestResolverRegistry(t *testing.T) {
+	g := NewWithT(t)
+
+	r := &resolverRegistry{
+		resolvers: map[string]*resolverEntry{},
+	}
+	fn := func(ref string) (string, error) {
+		return ref, nil
+	}
+	g.Expect(r.Register("Vault", fn, WithResolverSecret(false))).ToNot(HaveOccurred())
+	g.Expect(xerrors.IsDuplicate(r.Register("vault", fn))).To(BeTrue())
+
+	e, ok := r.Lookup("VAULT")
+	g.Expect(ok).To(BeTrue())
+	g.Expect(e.opt.Secret).To(BeFalse())
+
+	_, ok = r.Lookup("file")
+	g.Expect(ok).To(BeFalse())
+}
+
+func TestFlattenStorageResolve(t *testing.T) {
+	lookupEnvFn = func(name string) (string, bool) {
+		switch name {
+		case "SECRETS_DIR":
+			return "/run/secrets", true
+		case "DB_PASS":
+			return "p2", true
+		}
+		return "", false
+	}
+	readFileFn = func(name string) ([]byte, error) {
+		if name == "/run/secrets/db" {
+			return []byte("p1\n"), nil
+		}
+		return nil, os.ErrNotExist
+	}
+	defer func() {
+		lookupEnvFn = os.LookupEnv
+		readFileFn = os.ReadFile
+	}()
+
+	r := &resolverRegistry{
+		resolvers: map[string]*resolverEntry{},
+	}
+	g := NewWithT(t)
+	g.Expect(r.Register(SchemeFile, resolveFile)).ToNot(HaveOccurred())
+	g.Expect(r.Register("upper", func(ref string) (string, error) {
+		return "U" + ref, nil
+	}, WithResolverSecret(false))).ToNot(HaveOccurred())
+
+	type testcase struct {
+		desp    string
+		items   map[string]string
+		expect  map[string]string
+		secrets map[string]string
+		err     string
+	}
+	testcases := []testcase{
+		{
+			desp: "normal test",
+			items: map[string]string{
+				"db.host":     "h1",
+				"db.password": "file://${SECRETS_DIR}/db",
+				"db.dsn":      "${db.host}:${ db.port }/${db.password}",
+				"db.port":     "3306",
+				"db.name":     "upper://n1",
+				"db.url":      "http://${db.host}",
+				"escaped":     "$${db.host}",
+			},
+			expect: map[string]string{
+				"db.host":     "h1",
+				"db.password": "p1",
+				"db.dsn":      "h1:3306/p1",
+				"db.port":     "3306",
+				"db.name":     "Un1",
+				"db.url":      "http://h1",
+				"escaped":     "${db.host}",
+			},
+			secrets: map[string]string{
+				"db.password": "file://${SECRETS_DIR}/db",
+				"db.dsn":      "${db.host}:${ db.port }/${db.password}",
+			},
+		},
+		{
+			desp: "env reference",
+			items: map[string]string{
+				"db.host": "h1",
+				"db.port": "3306",
+				"db.dsn":  "postgres://u:${DB_PASS}@${db.host}",
+				"db.url":  "${db.dsn}/d1",
+			},
+			expect: map[string]string{
+				"db.host": "h1",
+				"db.port": "3306",
+				"db.dsn":  "postgres://u:p2@h1",
+				"db.url":  "postgres://u:p2@h1/d1",
+			},
+			secrets: map[string]string{
+				"db.dsn": "postgres://u:${DB_PASS}@${db.host}",
+				"db.url": "${db.dsn}/d1",
+			},
+		},
+		{
+			desp: "reference not found",
+			items: map[string]string{
+				"k1": "${k2}",
+			},
+			err: `reference 'k2' is neither a key nor an env`,
+		},
+		{
+			desp: "reference cycle",
+			items: map[string]string{
+				"k1": "${k2}",
+				"k2": "${k1}",
+			},
+			err: `reference cycle detected at key 'k1'`,
+		},
+		{
+			desp: "unclosed reference",
+			items: map[string]string{
+				"k1": "a${k2",
+			},
+			err: `unclosed reference in '${k2'`,
+		},
+		{
+			desp: "resolver failed",
+			items: map[string]string{
+				"k1": "file:///not-exist",
+			},
+			err: `resolve value of key 'k1' with scheme 'file' failed`,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s := newFlattenStorage()
+			for k, v := range tc.items {
+				g.Expect(s.Set(k, v)).ToNot(HaveOccurred())
+			}
+
+			err := s.resolve(r)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(ContainSubstring(tc.err))
+				g.Expect(s.items).To(Equal(tc.items))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(s.items).To(Equal(tc.expect))
+			g.Expect(s.secrets).To(Equal(tc.secrets))
+
+			// The resolved items will not been resolved again
+			g.Expect(s.resolve(r)).ToNot(HaveOccurred())
+			g.Expect(s.items).To(Equal(tc.expect))
+
+			// The overridden item is not secret anymore
+			g.Expect(s.Set("db.password", "${db.port}")).ToNot(HaveOccurred())
+			g.Expect(s.resolve(r)).ToNot(HaveOccurred())
+			g.Expect(s.items["db.password"]).To(Equal("3306"))
+			g.Expect(s.secrets).ToNot(HaveKey("db.password"))
+		})
+	}
+}
+
+func TestConfigMgrResolve(t *testing.T) {
+	readFileFn = func(name string) ([]byte, error) {
+		return []byte("p1"), nil
+	}
+	defer func() {
+		readFileFn = os.ReadFile
+	}()
+
+	g := NewWithT(t)
+	reader := &testConfigReader{
+		fnReadTo: func(r ConfigStorage) error {
+			return r.Set("db", map[string]interface{}{
+				"pass": "file:///run/secrets/db",
+				"user": "u1",
+				"dsn":  "${db.user}:${db.pass}",
+			})
+		},
+	}
+
+	mgr := NewConfigMgrWithOptions([]ConfigReader{reader}, WithResolve(true))
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	type testObj struct {
+		Pass string `conma:"db.pass"`
+		DSN  string `conma:"db.dsn"`
+	}
+	var o testObj
+	g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+	g.Expect(o).To(Equal(testObj{Pass: "p1", DSN: "u1:p1"}))
+
+	g.Expect(mgr.Dump(WithRedactKeys())).To(Equal([]Explanation{
+		{Key: "db.dsn", Value: redactedValue, Source: Source{Reader: "*conma.testConfigReader"}, Redacted: true},
+		{Key: "db.pass", Value: redactedValue, Source: Source{Reader: "*conma.testConfigReader"}, Redacted: true},
+		{Key: "db.user", Value: "u1", Source: Source{Reader: "*conma.testConfigReader"}},
+	}))
+
+	// the references is left unchanged by default
+	mgr = NewConfigMgr(reader)
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	g.Expect(Get[string](mgr, "db.pass")).To(Equal("file:///run/secrets/db"))
+	g.Expect(Get[string](mgr, "db.dsn")).To(Equal("${db.user}:${db.pass}"))
+
+	mgr = NewConfigMgrWithOptions([]ConfigReader{reader}, WithResolve(false))
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	g.Expect(Get[string](mgr, "db.pass")).To(Equal("file:///run/secrets/db"))
+}
+
+func TestConfigMgrResolveDefault(t *testing.T) {
+	g := NewWithT(t)
+	reader := &testConfigReader{
+		fnReadTo: func(r ConfigStorage) error {
+			return r.Set("greeting", "hello ${x}, ${undefined")
+		},
+	}
+
+	mgr := NewConfigMgr(reader)
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+	g.Expect(Get[string](mgr, "greeting")).To(Equal("hello ${x}, ${undefined"))
+}
@@ -0,0 +1,495 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+const (
+	// JSONSchemaDraft is the JSON Schema dialect of Schema.JSON
+	JSONSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// Schema is the JSON Schema of the configuration items, it's generated
+// from the `conma` struct tag by NewSchema.
+type Schema struct {
+	Schema      string      `json:"$schema,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+
+	Enum          []interface{} `json:"enum,omitempty"`
+	Pattern       string        `json:"pattern,omitempty"`
+	Minimum       interface{}   `json:"minimum,omitempty"`
+	Maximum       interface{}   `json:"maximum,omitempty"`
+	MinLength     *int          `json:"minLength,omitempty"`
+	MaxLength     *int          `json:"maxLength,omitempty"`
+	MinItems      *int          `json:"minItems,omitempty"`
+	MaxItems      *int          `json:"maxItems,omitempty"`
+	MinProperties *int          `json:"minProperties,omitempty"`
+	MaxProperties *int          `json:"maxProperties,omitempty"`
+
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// order is the declaration order of properties, json will sort the
+	// keys but the sample yaml keep this order.
+	order []string
+}
+
+// NewSchema will generate the Schema from struct (or pointer to struct) o
+// with the same rule as Unmarshal:
+//  1. the nested struct field is object, the '.' in key is also expanded
+//     to nested object
+//  2. the fields of untagged embedded struct is promoted
+//  3. the map is object with additionalProperties, the slice is array
+//  4. the default, desc and validate tag is converted to the keywords
+//  5. the field which Unmarshal will fail when it's missing is required,
+//     such as the field without default, the nested struct is required if
+//     any of it's fields is required, but the pointer to struct is not
+func NewSchema(o interface{}) (*Schema, error) {
+	typ := reflect.TypeOf(o)
+	if typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, xerrors.Errorf("The target object must be an struct or pointer to struct, current is %v", typ)
+	}
+
+	return newObjectSchema(typ)
+}
+
+// newObjectSchema will generate the object Schema of struct typ, the fields
+// is visited by walkStruct as Unmarshal does.
+func newObjectSchema(typ reflect.Type) (*Schema, error) {
+	s := &Schema{
+		Type: "object",
+	}
+
+	// The pointer to struct is nil when it's missing, so the required of
+	// it's fields is not propagated to the parents.
+	optional := map[string]bool{}
+	empty := &configMgr{store: newFlattenStorage()}
+	err := walkStructE(typ, "", func(key string, fd *FieldDescriptor, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err := s.addField(key, fd); err != nil {
+			return xerrors.Wrapf(err, "generate schema for field '%s' failed", fd.FieldName)
+		}
+		switch {
+		case isStructPtrType(fd.Typ):
+			optional[key] = true
+		case isStructType(fd.Typ):
+		default:
+			// The field is required if Unmarshal will fail when it's missing
+			if _, err := empty.valueForField("", fd); err != nil {
+				s.setRequired(key, optional)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schema) addField(key string, fd *FieldDescriptor) error {
+	names := strings.Split(key, ".")
+	parent := s
+	for _, name := range names[:len(names)-1] {
+		parent = parent.property(name, &Schema{Type: "object"})
+	}
+	name := names[len(names)-1]
+
+	if isStructType(fd.Typ) || isStructPtrType(fd.Typ) {
+		// The fields is added by walkStruct, and the rules is not applied
+		// to the struct by Unmarshal
+		ps := parent.property(name, &Schema{Type: "object"})
+		ps.Description = fd.Description
+		return nil
+	}
+
+	fs, err := schemaForType(fd.Typ)
+	if err != nil {
+		return err
+	}
+	fs.Description = fd.Description
+	if fd.Default != nil && !isCompositeType(fd.Typ) {
+		fs.Default = schemaDefault(fd.Typ, *fd.Default)
+	}
+	for _, rule := range fd.Rules {
+		fs.applyRule(rule, fd.Typ)
+	}
+
+	parent.property(name, fs)
+	return nil
+}
+
+// setRequired will add the key to the required of it's parent, and the
+// parents to their parent until the pointer to struct (in optional).
+func (s *Schema) setRequired(key string, optional map[string]bool) {
+	names := strings.Split(key, ".")
+	for i := len(names) - 1; i >= 0; i-- {
+		parent := s
+		for _, name := range names[:i] {
+			parent = parent.Properties[name]
+		}
+		if !parent.isRequired(names[i]) {
+			parent.Required = append(parent.Required, names[i])
+		}
+
+		if optional[strings.Join(names[:i], ".")] {
+			break
+		}
+	}
+}
+
+// property return the property with name, it will been set to ps if
+// not exist.
+func (s *Schema) property(name string, ps *Schema) *Schema {
+	if s.Properties == nil {
+		s.Properties = map[string]*Schema{}
+	}
+	if p, ok := s.Properties[name]; ok {
+		return p
+	}
+
+	s.Properties[name] = ps
+	s.order = append(s.order, name)
+	return ps
+}
+
+func schemaForType(typ reflect.Type) (*Schema, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if conv.HasConverter(typ) {
+		// The type with converter is represented by string, such as
+		// time.Duration and time.Time
+		return &Schema{Type: "string"}, nil
+	}
+	switch typ.Kind() { //nolint
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}, nil
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}, nil
+	case reflect.String:
+		return &Schema{Type: "string"}, nil
+	case reflect.Interface:
+		return &Schema{}, nil
+	case reflect.Slice, reflect.Array:
+		items, err := schemaForType(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		s := &Schema{Type: "array", Items: items}
+		if typ.Kind() == reflect.Array {
+			// The missing elements is zero value, so only the more elements
+			// than array length is invalid
+			s.MaxItems = intPtr(typ.Len())
+		}
+		return s, nil
+	case reflect.Map:
+		elem, err := schemaForType(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: elem}, nil
+	case reflect.Struct:
+		return newObjectSchema(typ)
+	}
+
+	return nil, xerrors.Errorf("unsupported type '%s'", typ.String())
+}
+
+// schemaDefault return the default value converted to the field type, the
+// value which cannot been converted is kept as string.
+func schemaDefault(typ reflect.Type, v string) interface{} {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if conv.HasConverter(typ) {
+		return v
+	}
+	data := []string{v}
+	if typ.Kind() == reflect.Slice {
+		data = []string{}
+		if v != "" {
+			data = strings.Split(v, ",")
+		}
+		if conv.HasConverter(typ.Elem()) {
+			return data
+		}
+	}
+
+	cv, err := conv.ConvertTo(context.Background(), typ, data)
+	if err != nil {
+		return v
+	}
+	return cv
+}
+
+func (s *Schema) applyRule(rule *ValidateRule, typ reflect.Type) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch rule.Name {
+	case RuleRequired:
+		// The required is set by newObjectSchema
+	case RuleNonEmpty:
+		s.setMinLen(1)
+	case RuleMin, RuleMax:
+		bound, ok := rule.bound.(int)
+		if isNumberKind(typ.Kind()) {
+			if rule.Name == RuleMin {
+				s.Minimum = rule.bound
+			} else {
+				s.Maximum = rule.bound
+			}
+			return
+		}
+		if !ok {
+			return
+		}
+		if rule.Name == RuleMin {
+			s.setMinLen(bound)
+		} else {
+			s.setMaxLen(bound)
+		}
+	case RuleOneOf, RuleRegex:
+		target := s
+		if s.Items != nil {
+			// The rule is applied to each element of slice
+			target, typ = s.Items, typ.Elem()
+		}
+		if rule.Name == RuleRegex {
+			target.Pattern = rule.Arg
+			return
+		}
+		for _, o := range rule.oneOf {
+			target.Enum = append(target.Enum, schemaDefault(typ, o))
+		}
+	}
+}
+
+func (s *Schema) setMinLen(n int) {
+	switch s.Type {
+	case "array":
+		s.MinItems = intPtr(n)
+	case "object":
+		s.MinProperties = intPtr(n)
+	default:
+		s.MinLength = intPtr(n)
+	}
+}
+
+func (s *Schema) setMaxLen(n int) {
+	switch s.Type {
+	case "array":
+		s.MaxItems = intPtr(n)
+	case "object":
+		s.MaxProperties = intPtr(n)
+	default:
+		s.MaxLength = intPtr(n)
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// JSON will return the indented JSON Schema document.
+func (s *Schema) JSON() ([]byte, error) {
+	doc := *s
+	doc.Schema = JSONSchemaDraft
+	return json.MarshalIndent(&doc, "", "  ")
+}
+
+// SampleYAML will return the sample yaml file, each key is commented with
+// it's description, type, default and constraints. The value is the default
+// value, or the zero value if there is no default.
+func (s *Schema) SampleYAML() []byte {
+	buf := &bytes.Buffer{}
+	s.writeYAMLProperties(buf, 0)
+	return buf.Bytes()
+}
+
+func (s *Schema) writeYAMLProperties(buf *bytes.Buffer, indent int) {
+	prefix := strings.Repeat(" ", indent)
+	for i, name := range s.order {
+		ps := s.Properties[name]
+		if i > 0 && indent == 0 {
+			buf.WriteString("\n")
+		}
+
+		if ps.Description != "" {
+			for _, line := range strings.Split(ps.Description, "\n") {
+				fmt.Fprintf(buf, "%s# %s\n", prefix, line)
+			}
+		}
+		fmt.Fprintf(buf, "%s# %s\n", prefix, ps.summary(s.isRequired(name)))
+
+		switch {
+		case ps.Type == "object" && len(ps.order) > 0:
+			fmt.Fprintf(buf, "%s%s:\n", prefix, yamlScalar(name))
+			ps.writeYAMLProperties(buf, indent+2)
+		case ps.Type == "array" && ps.Default == nil && ps.Items != nil && len(ps.Items.order) > 0:
+			// Write one element as the sample of array of object
+			fmt.Fprintf(buf, "%s%s:\n%s  -\n", prefix, yamlScalar(name), prefix)
+			ps.Items.writeYAMLProperties(buf, indent+4)
+		default:
+			fmt.Fprintf(buf, "%s%s: %s\n", prefix, yamlScalar(name), yamlScalar(ps.sampleValue()))
+		}
+	}
+}
+
+func (s *Schema) isRequired(name string) bool {
+	for _, r := range s.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
+// summary return the one line description of type and constraints.
+func (s *Schema) summary(required bool) string {
+	typ := s.Type
+	if typ == "" {
+		typ = "any"
+	}
+	if s.Items != nil && s.Items.Type != "" {
+		typ = fmt.Sprintf("array of %s", s.Items.Type)
+	}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Type != "" {
+		typ = fmt.Sprintf("map of %s", s.AdditionalProperties.Type)
+	}
+
+	parts := []string{"type: " + typ}
+	if required {
+		parts = append(parts, "required")
+	}
+	if s.Default != nil {
+		parts = append(parts, fmt.Sprintf("default: %v", s.Default))
+	}
+	for _, v := range []struct {
+		name  string
+		value interface{}
+	}{
+		{name: "minimum", value: s.Minimum},
+		{name: "maximum", value: s.Maximum},
+	} {
+		if v.value != nil {
+			parts = append(parts, fmt.Sprintf("%s: %v", v.name, v.value))
+		}
+	}
+	for _, v := range []struct {
+		name  string
+		value *int
+	}{
+		{name: "min length", value: s.MinLength},
+		{name: "max length", value: s.MaxLength},
+		{name: "min items", value: s.MinItems},
+		{name: "max items", value: s.MaxItems},
+		{name: "min properties", value: s.MinProperties},
+		{name: "max properties", value: s.MaxProperties},
+	} {
+		if v.value != nil {
+			parts = append(parts, fmt.Sprintf("%s: %d", v.name, *v.value))
+		}
+	}
+
+	e := s
+	if s.Items != nil {
+		e = s.Items
+	}
+	if len(e.Enum) > 0 {
+		parts = append(parts, fmt.Sprintf("one of: %v", e.Enum))
+	}
+	if e.Pattern != "" {
+		parts = append(parts, fmt.Sprintf("pattern: %s", e.Pattern))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// sampleValue return the default value, or the zero value of type.
+func (s *Schema) sampleValue() interface{} {
+	if s.Default != nil {
+		return s.Default
+	}
+
+	switch s.Type {
+	case "boolean":
+		return false
+	case "integer", "number":
+		return 0
+	case "string":
+		return ""
+	case "array":
+		return []interface{}{}
+	case "object":
+		return map[string]interface{}{}
+	}
+	return nil
+}
+
+// yamlScalar return the value in yaml flow style.
+func yamlScalar(v interface{}) string {
+	node := &yaml.Node{}
+	if err := node.Encode(v); err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	setFlowStyle(node)
+
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return strings.TrimSuffix(string(data), "\n")
+}
+
+func setFlowStyle(node *yaml.Node) {
+	node.Style |= yaml.FlowStyle
+	for _, n := range node.Content {
+		setFlowStyle(n)
+	}
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testSchemaServer struct {
+	Host string `conma:"host" validate:"required" desc:"the host of server"`
+	Port int    `conma:"port:=8080" validate:"min=1,max=65535"`
+}
+
+type testSchemaConfig struct {
+	testBase
+
+	Level   string             `conma:"log.level:=info" validate:"oneof=debug info warn" desc:"the log level"`
+	Timeout time.Duration      `conma:"timeout:=1s"`
+	Tags    []string           `conma:"tags:=a,b" validate:"nonempty,regex=^[a-z]+$"`
+	Labels  map[string]string  `conma:"labels"`
+	Servers []testSchemaServer `conma:"servers"`
+	Log     struct {
+		File string `conma:"file"`
+	} `conma:"log"`
+	TLS      *testTLSConfig `conma:"tls"`
+	disabled bool           `conma:"disabled"`
+	ignored  string
+	Started  time.Time     `conma:"started"`
+	MaxSize  conv.ByteSize `conma:"max_size:=1MiB"`
+}
+
+func TestNewSchema(t *testing.T) {
+	g := NewWithT(t)
+
+	s, err := NewSchema(&testSchemaConfig{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	data, err := s.JSON()
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var doc map[string]interface{}
+	g.Expect(json.Unmarshal(data, &doc)).ToNot(HaveOccurred())
+	g.Expect(doc["$schema"]).To(Equal(JSONSchemaDraft))
+
+	g.Expect(doc["required"]).To(Equal([]interface{}{"name", "labels", "servers", "log", "disabled", "started"}))
+
+	props := doc["properties"].(map[string]interface{})
+	g.Expect(props).To(HaveKey("name"))
+	g.Expect(props["timeout"]).To(Equal(map[string]interface{}{"type": "string", "default": "1s"}))
+	g.Expect(props["tags"]).To(Equal(map[string]interface{}{
+		"type":     "array",
+		"default":  []interface{}{"a", "b"},
+		"minItems": float64(1),
+		"items":    map[string]interface{}{"type": "string", "pattern": "^[a-z]+$"},
+	}))
+	g.Expect(props["labels"]).To(Equal(map[string]interface{}{
+		"type":                 "object",
+		"additionalProperties": map[string]interface{}{"type": "string"},
+	}))
+	g.Expect(props["log"]).To(Equal(map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"file"},
+		"properties": map[string]interface{}{
+			"level": map[string]interface{}{
+				"type":        "string",
+				"description": "the log level",
+				"default":     "info",
+				"enum":        []interface{}{"debug", "info", "warn"},
+			},
+			"file": map[string]interface{}{"type": "string"},
+		},
+	}))
+	g.Expect(props["servers"]).To(Equal(map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":     "object",
+			"required": []interface{}{"host"},
+			"properties": map[string]interface{}{
+				"host": map[string]interface{}{"type": "string", "description": "the host of server"},
+				"port": map[string]interface{}{"type": "integer", "default": float64(8080), "minimum": float64(1), "maximum": float64(65535)},
+			},
+		},
+	}))
+	g.Expect(props["tls"]).To(Equal(map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"cert", "key"},
+		"properties": map[string]interface{}{
+			"cert": map[string]interface{}{"type": "string"},
+			"key":  map[string]interface{}{"type": "string"},
+		},
+	}))
+	g.Expect(props["disabled"]).To(Equal(map[string]interface{}{"type": "boolean"}))
+	g.Expect(props["started"]).To(Equal(map[string]interface{}{"type": "string"}))
+	g.Expect(props["max_size"]).To(Equal(map[string]interface{}{"type": "string", "default": "1MiB"}))
+
+	_, err = NewSchema(1)
+	g.Expect(err).To(HaveOccurred())
+
+	type invalidObj struct {
+		v int `conma:"v" validate:"min=a"`
+	}
+	_, err = NewSchema(invalidObj{})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestSchemaRequired(t *testing.T) {
+	type testObj struct {
+		testSchemaConfig
+
+		Ports   [2]int         `conma:"ports:="`
+		Proxy   *testTLSConfig `conma:"proxy.tls"`
+		Retry   *int           `conma:"retry"`
+		Backups []string       `conma:"backups:=" validate:"required"`
+		Weight  int            `conma:"upstream.weight:=1"`
+	}
+
+	g := NewWithT(t)
+	s, err := NewSchema(testObj{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The missing elements of array is zero value
+	g.Expect(s.Properties["ports"].MinItems).To(BeNil())
+	g.Expect(s.Properties["ports"].MaxItems).To(Equal(intPtr(2)))
+
+	type testcase struct {
+		desp   string
+		items  map[string]string
+		expect []string
+	}
+	testcases := []testcase{
+		{
+			desp:   "empty",
+			items:  map[string]string{},
+			expect: requiredKeys(s, ""),
+		},
+		{
+			desp:  "pointer to struct",
+			items: map[string]string{"tls.cert": "c1", "proxy.tls.key": "k1"},
+			expect: append(requiredKeys(s, ""),
+				"tls.key",
+				"proxy.tls.cert",
+			),
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mgr := NewConfigMgr().(*configMgr)
+			mgr.store = &flattenStorage{items: tc.items}
+
+			var o testObj
+			err := mgr.Unmarshal(&o)
+			g.Expect(err).To(HaveOccurred())
+
+			var ve *ValidationError
+			g.Expect(xerrors.As(err, &ve)).To(BeTrue())
+			keys := []string{}
+			for _, fe := range ve.Errors {
+				keys = append(keys, fe.Key)
+			}
+			g.Expect(keys).To(ConsistOf(tc.expect))
+		})
+	}
+}
+
+// requiredKeys return the full keys of required properties, the object is
+// expanded to it's required properties.
+func requiredKeys(s *Schema, prefix string) []string {
+	keys := []string{}
+	for _, name := range s.Required {
+		ps := s.Properties[name]
+		if len(ps.Required) > 0 {
+			keys = append(keys, requiredKeys(ps, joinKey(prefix, name))...)
+			continue
+		}
+		keys = append(keys, joinKey(prefix, name))
+	}
+	return keys
+}
+
+func TestSchemaSampleYAML(t *testing.T) {
+	g := NewWithT(t)
+
+	s, err := NewSchema(testSchemaConfig{})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	data := s.SampleYAML()
+
+	var m map[string]interface{}
+	g.Expect(yaml.Unmarshal(data, &m)).ToNot(HaveOccurred())
+	g.Expect(m["timeout"]).To(Equal("1s"))
+	g.Expect(m["tags"]).To(Equal([]interface{}{"a", "b"}))
+	g.Expect(m["labels"]).To(Equal(map[string]interface{}{}))
+	g.Expect(m["log"]).To(Equal(map[string]interface{}{"level": "info", "file": ""}))
+	g.Expect(m["servers"]).To(Equal([]interface{}{
+		map[string]interface{}{"host": "", "port": 8080},
+	}))
+	g.Expect(string(data)).To(ContainSubstring(`  # the log level
+  # type: string, default: info, one of: [debug info warn]
+  level: info
+`))
+	g.Expect(string(data)).To(ContainSubstring(`# type: array of string, default: [a b], min items: 1, pattern: ^[a-z]+$
+tags: [a, b]
+`))
+	g.Expect(string(data)).To(ContainSubstring(`    # the host of server
+    # type: string, required
+    host: ""
+`))
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lsytj0413/ena"
+)
+
+const (
+	// SourceFile is the reader name of file reader
+	SourceFile = "file"
+
+	// SourceEnv is the reader name of env reader
+	SourceEnv = "env"
+
+	// SourceOption is the reader name of command line option reader
+	SourceOption = "option"
+
+	// SourceHTTP is the reader name of http reader
+	SourceHTTP = "http"
+
+	// SourceDefault is the reader name of `conma:"k:=default"` tag default
+	SourceDefault = "default"
+
+	redactedValue = "******"
+)
+
+// Source describe where the configuration item comes from.
+type Source struct {
+	// Reader is the name of ConfigReader, such as SourceFile
+	Reader string
+
+	// Detail is the location in reader, such as the file path or env name
+	Detail string
+}
+
+func (s Source) String() string {
+	if s.Detail == "" {
+		return s.Reader
+	}
+
+	return s.Reader + "(" + s.Detail + ")"
+}
+
+// merge return the source with non-empty fields of o override s
+func (s Source) merge(o Source) Source {
+	if o.Reader != "" {
+		s.Reader = o.Reader
+	}
+	if o.Detail != "" {
+		s.Detail = o.Detail
+	}
+	return s
+}
+
+// SourceConfigStorage is the ConfigStorage which can record the
+// source of configuration items.
+type SourceConfigStorage interface {
+	ConfigStorage
+
+	// WithSource return the ConfigStorage which record src for all items
+	// set by it, the empty fields of src is inherited from current source.
+	WithSource(src Source) ConfigStorage
+}
+
+// withSource will return the ConfigStorage which record src if the
+// store support it, otherwise return the store itself.
+func withSource(store ConfigStorage, src Source) ConfigStorage {
+	if ss, ok := store.(SourceConfigStorage); ok {
+		return ss.WithSource(src)
+	}
+
+	return store
+}
+
+// Explanation is the effective value of configuration item and
+// where it comes from.
+type Explanation struct {
+	Key      string
+	Value    string
+	Source   Source
+	Redacted bool
+}
+
+func (e Explanation) String() string {
+	return e.Key + "=" + e.Value + " (" + e.Source.String() + ")"
+}
+
+type explainOption struct {
+	// RedactKeys is the words in key which value should been redacted,
+	// the matching is case-insensitive.
+	// Default: password, passwd, secret, token, credential, private
+	RedactKeys []string
+}
+
+func defaultExplainOption() *explainOption {
+	return &explainOption{
+		RedactKeys: []string{"password", "passwd", "secret", "token", "credential", "private"},
+	}
+}
+
+// WithRedactKeys will set the redact keys option, empty means
+// do not redact any value.
+func WithRedactKeys(words ...string) ena.Option[explainOption] {
+	return ena.NewFnOption(func(opt *explainOption) {
+		opt.RedactKeys = words
+	})
+}
+
+func (o *explainOption) shouldRedact(key string) bool {
+	key = strings.ToLower(key)
+	for _, w := range o.RedactKeys {
+		if strings.Contains(key, strings.ToLower(w)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *explainOption) redact(explanations []Explanation) []Explanation {
+	for i, e := range explanations {
+		if o.shouldRedact(e.Key) {
+			explanations[i].Value = redactedValue
+			explanations[i].Redacted = true
+		}
+	}
+
+	return explanations
+}
+
+// sortExplanations will sort the explanations by key.
+func sortExplanations(explanations []Explanation) []Explanation {
+	sort.Slice(explanations, func(i int, j int) bool {
+		return explanations[i].Key < explanations[j].Key
+	})
+	return explanations
+}
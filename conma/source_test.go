@@ -0,0 +1,202 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestSource(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(Source{Reader: SourceEnv}.String()).To(Equal("env"))
+	g.Expect(Source{Reader: SourceEnv, Detail: "K1"}.String()).To(Equal("env(K1)"))
+	g.Expect(Source{Reader: "r1", Detail: "d1"}.merge(Source{Detail: "d2"})).To(Equal(Source{Reader: "r1", Detail: "d2"}))
+	g.Expect(Source{Reader: "r1", Detail: "d1"}.merge(Source{Reader: "r2"})).To(Equal(Source{Reader: "r2", Detail: "d1"}))
+}
+
+func TestFlattenStorageExplain(t *testing.T) {
+	g := NewWithT(t)
+
+	s := newFlattenStorage()
+	g.Expect(s.Set("k0", "v0")).ToNot(HaveOccurred())
+	fstore := s.WithSource(Source{Reader: SourceFile})
+	g.Expect(fstore.Set("k1", map[string]interface{}{"k2": "v2", "k3": []string{"v3"}})).ToNot(HaveOccurred())
+	g.Expect(withSource(fstore, Source{Detail: "a.yaml"}).Set("k1.k4", "v4")).ToNot(HaveOccurred())
+	_, err := s.Get("k1.k5", WithDefault("v5"))
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = s.Get("k1.k2", WithDefault("v2.1"))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(s.Explain("k1")).To(Equal([]Explanation{
+		{Key: "k1.k2", Value: "v2", Source: Source{Reader: SourceFile}},
+		{Key: "k1.k3[0]", Value: "v3", Source: Source{Reader: SourceFile}},
+		{Key: "k1.k4", Value: "v4", Source: Source{Reader: SourceFile, Detail: "a.yaml"}},
+		{Key: "k1.k5", Value: "v5", Source: Source{Reader: SourceDefault}},
+	}))
+	g.Expect(s.Explain("")).To(HaveLen(5))
+	g.Expect(s.Explain("k2")).To(BeEmpty())
+}
+
+func TestExplainOptionRedact(t *testing.T) {
+	g := NewWithT(t)
+
+	explanations := []Explanation{
+		{Key: "db.password", Value: "p1"},
+		{Key: "db.host", Value: "h1"},
+		{Key: "api.Token", Value: "t1"},
+	}
+
+	opt := defaultExplainOption()
+	g.Expect(opt.redact(append([]Explanation{}, explanations...))).To(Equal([]Explanation{
+		{Key: "db.password", Value: redactedValue, Redacted: true},
+		{Key: "db.host", Value: "h1"},
+		{Key: "api.Token", Value: redactedValue, Redacted: true},
+	}))
+
+	WithRedactKeys().Apply(opt)
+	g.Expect(opt.redact(append([]Explanation{}, explanations...))).To(Equal(explanations))
+}
+
+func TestConfigMgrExplain(t *testing.T) {
+	statFn = func(name string) (fs.FileInfo, error) {
+		return &testFileInfo{}, nil
+	}
+	defer func() {
+		statFn = os.Stat
+		readFileFn = os.ReadFile
+		environFn = os.Environ
+		argsFn = func() []string {
+			return os.Args[1:]
+		}
+	}()
+	readFileFn = func(name string) ([]byte, error) {
+		return []byte(`
+db:
+  host: h1
+  port: 3306
+  password: p1`), nil
+	}
+	environFn = func() []string {
+		return []string{"DB_HOST=h2"}
+	}
+	argsFn = func() []string {
+		return []string{"--db.user=u1"}
+	}
+
+	g := NewWithT(t)
+	mgr := NewConfigMgr(
+		NewFileConfigReader("a.yaml"),
+		NewEnvConfigReader(),
+		NewOptionConfigReader(),
+		&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				return r.Set("db.name", "n1")
+			},
+		},
+	)
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	type testObj struct {
+		timeout string `conma:"db.timeout:=1s"`
+	}
+	g.Expect(mgr.Unmarshal(&testObj{})).ToNot(HaveOccurred())
+
+	explanations, err := mgr.Explain("db.host")
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(explanations).To(Equal([]Explanation{
+		{Key: "db.host", Value: "h2", Source: Source{Reader: SourceEnv, Detail: "DB_HOST"}},
+	}))
+
+	_, err = mgr.Explain("db.unknown")
+	g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+
+	g.Expect(mgr.Dump()).To(Equal([]Explanation{
+		{Key: "db.host", Value: "h2", Source: Source{Reader: SourceEnv, Detail: "DB_HOST"}},
+		{Key: "db.name", Value: "n1", Source: Source{Reader: "*conma.testConfigReader"}},
+		{Key: "db.password", Value: redactedValue, Source: Source{Reader: SourceFile, Detail: "a.yaml"}, Redacted: true},
+		{Key: "db.port", Value: "3306", Source: Source{Reader: SourceFile, Detail: "a.yaml"}},
+		{Key: "db.timeout", Value: "1s", Source: Source{Reader: SourceDefault}},
+		{Key: "db.user", Value: "u1", Source: Source{Reader: SourceOption, Detail: "--db.user"}},
+	}))
+}
+
+func TestConfigMgrExplainSecretArgs(t *testing.T) {
+	argsFn = func() []string {
+		return []string{"--db.password=hunter2", "--db.host=h1"}
+	}
+	defer func() {
+		argsFn = func() []string {
+			return os.Args[1:]
+		}
+	}()
+
+	type testObj struct {
+		Password string `conma:"db.password"`
+		Host     string `conma:"db.host"`
+	}
+	fr, err := NewFlagConfigReader(&testObj{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testcase struct {
+		desp   string
+		r      ConfigReader
+		expect []Explanation
+	}
+	testcases := []testcase{
+		{
+			desp: "option",
+			r:    NewOptionConfigReader(),
+			expect: []Explanation{
+				{Key: "db.host", Value: "h1", Source: Source{Reader: SourceOption, Detail: "--db.host"}},
+				{Key: "db.password", Value: redactedValue, Source: Source{Reader: SourceOption, Detail: "--db.password"}, Redacted: true},
+			},
+		},
+		{
+			desp: "flag",
+			r:    fr,
+			expect: []Explanation{
+				{Key: "db.host", Value: "h1", Source: Source{Reader: SourceOption, Detail: "--db.host"}},
+				{Key: "db.password", Value: redactedValue, Source: Source{Reader: SourceOption, Detail: "--db.password"}, Redacted: true},
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			mgr := NewConfigMgr(tc.r)
+			g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+			g.Expect(mgr.Dump()).To(Equal(tc.expect))
+			for _, e := range mgr.Dump() {
+				g.Expect(e.Source.String()).ToNot(ContainSubstring("hunter2"))
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lsytj0413/ena"
+)
+
+// StrictMode is the flags which control what is reported as error
+// by Unmarshal.
+type StrictMode int
+
+const (
+	// StrictUnknownKeys will report the keys under the prefixes declared by
+	// struct (such as nested struct field) which match no field.
+	StrictUnknownKeys StrictMode = 1 << iota
+
+	// StrictDefaults will report the keys of fields which fell back to
+	// `conma:"k:=default"` tag default.
+	StrictDefaults
+
+	// StrictAll will report all of above.
+	StrictAll = StrictUnknownKeys | StrictDefaults
+)
+
+type configMgrOption struct {
+	// Strict is the strict mode of Unmarshal.
+	// Default: 0, nothing is reported
+	Strict StrictMode
+
+	// Resolve will resolve the '${name}' and 'scheme://ref' references in
+	// values after all ConfigReader is read, see RegisterResolver. It's
+	// opt-in because the references in values from untrusted ConfigReader
+	// (such as env, flags or http) may read arbitrary local files.
+	// Default: false
+	Resolve bool
+
+	// MergeRules is the MergeRule of lists when it's set by multiple
+	// ConfigReader, the list without rule is replaced by the later one.
+	// Default: empty
+	MergeRules map[string]MergeRule
+
+	// ReaderTimeout is the timeout of each ConfigReader, the reader wrapped by
+	// NewTimeoutConfigReader use it's own timeout.
+	// Default: 0, no timeout
+	ReaderTimeout time.Duration
+}
+
+func defaultConfigMgrOption() *configMgrOption {
+	return &configMgrOption{
+		Strict:     0,
+		Resolve:    false,
+		MergeRules: map[string]MergeRule{},
+	}
+}
+
+// WithStrictMode will set the strict mode option
+func WithStrictMode(mode StrictMode) ena.Option[configMgrOption] {
+	return ena.NewFnOption(func(opt *configMgrOption) {
+		opt.Strict = mode
+	})
+}
+
+// WithResolve will set the resolve option
+func WithResolve(enabled bool) ena.Option[configMgrOption] {
+	return ena.NewFnOption(func(opt *configMgrOption) {
+		opt.Resolve = enabled
+	})
+}
+
+// WithMergeRule will set the MergeRule of list key, such as 'servers'
+func WithMergeRule(key string, rule MergeRule) ena.Option[configMgrOption] {
+	return ena.NewFnOption(func(opt *configMgrOption) {
+		if opt.MergeRules == nil {
+			opt.MergeRules = map[string]MergeRule{}
+		}
+		opt.MergeRules[key] = rule
+	})
+}
+
+// WithReaderTimeout will set the reader timeout option
+func WithReaderTimeout(d time.Duration) ena.Option[configMgrOption] {
+	return ena.NewFnOption(func(opt *configMgrOption) {
+		opt.ReaderTimeout = d
+	})
+}
+
+// StrictError is the error reported by Unmarshal in strict mode.
+type StrictError struct {
+	// UnknownKeys is the keys under declared prefixes which match no field
+	UnknownKeys []string
+
+	// DefaultKeys is the keys of fields which fell back to tag default
+	DefaultKeys []string
+}
+
+func (e *StrictError) Error() string {
+	msgs := []string{}
+	if len(e.UnknownKeys) > 0 {
+		msgs = append(msgs, fmt.Sprintf("unknown keys [%s]", strings.Join(e.UnknownKeys, ", ")))
+	}
+	if len(e.DefaultKeys) > 0 {
+		msgs = append(msgs, fmt.Sprintf("fields fell back to default [%s]", strings.Join(e.DefaultKeys, ", ")))
+	}
+
+	return "strict mode: " + strings.Join(msgs, "; ")
+}
+
+// checkStrict will check the store after unmarshal the struct typ with
+// prefix, and return *StrictError if anything is reported.
+func (m *configMgr) checkStrict(store *flattenStorage, typ reflect.Type, prefix string) error {
+	if m.opt == nil || m.opt.Strict == 0 {
+		return nil
+	}
+
+	prefixes, leaves := declaredKeys(typ, prefix)
+	if prefix != "" {
+		prefixes = append(prefixes, prefix)
+	}
+
+	e := &StrictError{}
+	if m.opt.Strict&StrictUnknownKeys != 0 {
+		e.UnknownKeys = store.unused(prefixes)
+	}
+	if m.opt.Strict&StrictDefaults != 0 {
+		e.DefaultKeys = store.defaulted(prefixes, leaves)
+	}
+
+	if len(e.UnknownKeys) == 0 && len(e.DefaultKeys) == 0 {
+		return nil
+	}
+	return e
+}
+
+// declaredKeys will walk the struct typ, and return the prefixes of
+// nested struct and composite fields, and the keys of other fields.
+func declaredKeys(typ reflect.Type, prefix string) (prefixes []string, leaves []string) {
+	walkStruct(typ, prefix, func(key string, fd *FieldDescriptor) {
+		if isStructType(fd.Typ) || isCompositeType(fd.Typ) {
+			prefixes = append(prefixes, key)
+			return
+		}
+
+		leaves = append(leaves, key)
+	})
+
+	return prefixes, leaves
+}
+
+func matchAnyPrefix(key string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if matchPrefix(key, p) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unused return the sorted keys of items which match any of prefixes
+// and haven't been retrieved by Get.
+func (s *flattenStorage) unused(prefixes []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	keys := []string{}
+	for k := range s.items {
+		if _, ok := s.consumed[k]; ok || !matchAnyPrefix(k, prefixes) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// defaulted return the sorted keys which fell back to tag default, and
+// match any of prefixes or leaves.
+func (s *flattenStorage) defaulted(prefixes []string, leaves []string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	s.usageMu.Lock()
+	defer s.usageMu.Unlock()
+
+	keys := []string{}
+	for k := range s.defaults {
+		if _, ok := s.items[k]; ok {
+			continue
+		}
+
+		if matchAnyPrefix(k, prefixes) || matchAnyPrefix(k, leaves) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// UnusedKeys return the sorted keys which is or under the prefix, and
+// haven't been retrieved by Unmarshal or Get.
+func (m *configMgr) UnusedKeys(prefix string) []string {
+	return m.snapshot().unused([]string{prefix})
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testStrictServer struct {
+	Host      string            `conma:"host"`
+	Port      int               `conma:"port:=80"`
+	Upstreams []testUpstream    `conma:"upstreams:="`
+	Labels    map[string]string `conma:"labels:="`
+	TLS       *testTLSConfig    `conma:"tls"`
+}
+
+type testStrictObj struct {
+	testBase
+
+	Server testStrictServer `conma:"server"`
+	Debug  bool             `conma:"debug:=false"`
+}
+
+func TestDeclaredKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	prefixes, leaves := declaredKeys(reflect.TypeOf(testStrictObj{}), "app")
+	g.Expect(prefixes).To(Equal([]string{
+		"app.server",
+		"app.server.upstreams",
+		"app.server.labels",
+		"app.server.tls",
+	}))
+	g.Expect(leaves).To(Equal([]string{
+		"app.name",
+		"app.server.host",
+		"app.server.port",
+		"app.server.tls.cert",
+		"app.server.tls.key",
+		"app.debug",
+	}))
+}
+
+func TestConfigMgrUnmarshalStrict(t *testing.T) {
+	newMgr := func(mode StrictMode) *configMgr {
+		mgr := NewConfigMgrWithOptions(nil, WithStrictMode(mode)).(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"name":                     "n1",
+				"server.host":              "h1",
+				"server.prot":              "8080",
+				"server.upstreams[0].hots": "u1",
+				"server.upstreams[0].host": "u1",
+				"server.labels.app":        "a1",
+				"sever.port":               "8080",
+				"path":                     "/usr/bin",
+			},
+		}
+		return mgr
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var o testStrictObj
+		g.Expect(newMgr(0).Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o.Server.Port).To(Equal(80))
+	})
+
+	t.Run("unknown keys", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var o testStrictObj
+		err := newMgr(StrictUnknownKeys).Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("strict mode: unknown keys [server.prot, server.upstreams[0].hots]"))
+		g.Expect(o).To(Equal(testStrictObj{}))
+	})
+
+	t.Run("all", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var o testStrictObj
+		err := newMgr(StrictAll).Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+
+		var se *StrictError
+		g.Expect(xerrors.As(err, &se)).To(BeTrue())
+		g.Expect(se.UnknownKeys).To(Equal([]string{"server.prot", "server.upstreams[0].hots"}))
+		g.Expect(se.DefaultKeys).To(Equal([]string{"debug", "server.port", "server.upstreams[0].weight"}))
+	})
+
+	t.Run("sub view", func(t *testing.T) {
+		g := NewWithT(t)
+
+		var o testStrictServer
+		err := newMgr(StrictUnknownKeys).Sub("server").Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(Equal("strict mode: unknown keys [server.prot, server.upstreams[0].hots]"))
+	})
+
+	t.Run("no violation", func(t *testing.T) {
+		g := NewWithT(t)
+
+		mgr := newMgr(StrictAll)
+		var o testStrictObj
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"name":        "n1",
+				"debug":       "true",
+				"server.host": "h1",
+				"server.port": "8080",
+				"path":        "/usr/bin",
+			},
+		}
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+	})
+}
+
+func TestConfigMgrUnusedKeys(t *testing.T) {
+	g := NewWithT(t)
+
+	mgr := NewConfigMgr().(*configMgr)
+	mgr.store = &flattenStorage{
+		items: map[string]string{
+			"k1":    "v1",
+			"k2[0]": "v2",
+			"k2[1]": "v3",
+			"k3.k4": "v4",
+			"k3.k5": "v5",
+		},
+	}
+	g.Expect(mgr.UnusedKeys("")).To(HaveLen(5))
+
+	_, err := Get[string](mgr, "k1")
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = Get[[]string](mgr, "k2")
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = Get[string](mgr.Sub("k3"), "k4")
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Expect(mgr.UnusedKeys("")).To(Equal([]string{"k3.k5"}))
+	g.Expect(mgr.UnusedKeys("k1")).To(BeEmpty())
+}
@@ -0,0 +1,378 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lsytj0413/ena/conv"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+const (
+	// RuleRequired require the value is not zero value, it's not whether
+	// the key is present, so the explicit false, 0 or empty string also
+	// failed, and the pointer must not be nil or point to zero value.
+	RuleRequired = "required"
+
+	// RuleNonEmpty require the length of string, slice or map is not zero
+	RuleNonEmpty = "nonempty"
+
+	// RuleMin require the number is >= arg, or the length of string, slice
+	// or map is >= arg
+	RuleMin = "min"
+
+	// RuleMax require the number is <= arg, or the length of string, slice
+	// or map is <= arg
+	RuleMax = "max"
+
+	// RuleOneOf require the value (or each element of slice) is one of
+	// the space-separated arg
+	RuleOneOf = "oneof"
+
+	// RuleRegex require the string (or each element of string slice) match
+	// the regexp arg, it must be the last rule in tag because the regexp
+	// may contain comma
+	RuleRegex = "regex"
+)
+
+// ValidateRule is the constraint of field value, it's parsed from the
+// `validate:"required,min=1"` struct tag.
+type ValidateRule struct {
+	Name string
+	Arg  string
+
+	// bound is the arg converted to field type for number min/max, or
+	// the int length for others.
+	bound interface{}
+	re    *regexp.Regexp
+	oneOf []string
+}
+
+// parseValidateRules will parse the validate tag of field with type typ.
+// The nested struct is unmarshaled by it's fields, so the rules of it is
+// not supported, use the pointer to struct instead.
+func parseValidateRules(tag string, typ reflect.Type) ([]*ValidateRule, error) {
+	nested := isStructType(typ)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	rules := []*ValidateRule{}
+	for tag != "" {
+		var item string
+		if strings.HasPrefix(tag, RuleRegex+"=") {
+			item, tag = tag, ""
+		} else {
+			item, tag, _ = strings.Cut(tag, ",")
+		}
+
+		name, arg, _ := strings.Cut(strings.TrimSpace(item), "=")
+		if name == "" {
+			continue
+		}
+		if nested {
+			return nil, xerrors.Errorf("%s rule is not supported by nested struct '%s'", name, typ.String())
+		}
+
+		rule, err := newValidateRule(name, arg, typ)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func newValidateRule(name string, arg string, typ reflect.Type) (*ValidateRule, error) {
+	rule := &ValidateRule{
+		Name: name,
+		Arg:  arg,
+	}
+
+	if !ruleSupported(name, typ) {
+		return nil, xerrors.Errorf("%s rule is not supported by type '%s'", name, typ.String())
+	}
+
+	switch name {
+	case RuleRequired, RuleNonEmpty:
+	case RuleMin, RuleMax:
+		if isNumberKind(typ.Kind()) {
+			bound, err := conv.ConvertTo(context.Background(), typ, []string{arg})
+			if err != nil {
+				return nil, xerrors.Wrapf(err, "invalid %s rule arg '%s'", name, arg)
+			}
+			rule.bound = bound
+			break
+		}
+
+		bound, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "invalid %s rule arg '%s'", name, arg)
+		}
+		rule.bound = bound
+	case RuleOneOf:
+		rule.oneOf = strings.Fields(arg)
+	case RuleRegex:
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "invalid %s rule arg '%s'", name, arg)
+		}
+		rule.re = re
+	default:
+		return nil, xerrors.Errorf("unknown validate rule '%s'", name)
+	}
+
+	return rule, nil
+}
+
+// ruleSupported return false if the rule name cannot been applied to the
+// value of typ, such as min on bool or struct, unknown rule is supported.
+func ruleSupported(name string, typ reflect.Type) bool {
+	// The length of array is fixed, so the length rules is not supported
+	lenKind := typ.Kind() == reflect.String || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map
+	elem := typ
+	if (typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array) && !conv.HasConverter(typ) {
+		// The oneof and regex rule is applied to each element
+		elem = typ.Elem()
+	}
+
+	switch name {
+	case RuleNonEmpty:
+		return lenKind
+	case RuleMin, RuleMax:
+		return isNumberKind(typ.Kind()) || lenKind
+	case RuleOneOf:
+		return conv.HasConverter(elem) || elem.Kind() == reflect.Bool || elem.Kind() == reflect.String || isNumberKind(elem.Kind())
+	case RuleRegex:
+		return elem.Kind() == reflect.String
+	}
+	return true
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k { //nolint
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func hasLen(k reflect.Kind) bool {
+	return k == reflect.String || k == reflect.Slice || k == reflect.Array || k == reflect.Map
+}
+
+// Validate will check the value v against the rule.
+func (r *ValidateRule) Validate(v reflect.Value) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if r.Name == RuleRequired {
+				return xerrors.Errorf("is required")
+			}
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	switch r.Name {
+	case RuleRequired:
+		if v.IsZero() {
+			return xerrors.Errorf("is required")
+		}
+	case RuleNonEmpty:
+		if hasLen(v.Kind()) && v.Len() == 0 {
+			return xerrors.Errorf("must not be empty")
+		}
+	case RuleMin, RuleMax:
+		return r.validateBound(v)
+	case RuleOneOf:
+		return r.validateEach(v, func(e reflect.Value) error {
+			s := fmt.Sprint(e.Interface())
+			for _, o := range r.oneOf {
+				if s == o {
+					return nil
+				}
+			}
+			return xerrors.Errorf("'%s' must be one of [%s]", s, strings.Join(r.oneOf, " "))
+		})
+	case RuleRegex:
+		return r.validateEach(v, func(e reflect.Value) error {
+			if e.Kind() != reflect.String || !r.re.MatchString(e.String()) {
+				return xerrors.Errorf("'%v' must match '%s'", e.Interface(), r.Arg)
+			}
+			return nil
+		})
+	}
+
+	return nil
+}
+
+func (r *ValidateRule) validateEach(v reflect.Value, fn func(e reflect.Value) error) error {
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fn(v)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if err := fn(v.Index(i)); err != nil {
+			return xerrors.Wrapf(err, "index %d", i)
+		}
+	}
+	return nil
+}
+
+// nolint
+func (r *ValidateRule) validateBound(v reflect.Value) error {
+	op, ok := ">=", true
+	if r.Name == RuleMax {
+		op = "<="
+	}
+
+	if hasLen(v.Kind()) {
+		bound := r.bound.(int)
+		if r.Name == RuleMin {
+			ok = v.Len() >= bound
+		} else {
+			ok = v.Len() <= bound
+		}
+		if !ok {
+			return xerrors.Errorf("length %d must be %s %d", v.Len(), op, bound)
+		}
+		return nil
+	}
+
+	b := reflect.ValueOf(r.bound)
+	switch {
+	case v.CanInt() && b.CanInt():
+		if r.Name == RuleMin {
+			ok = v.Int() >= b.Int()
+		} else {
+			ok = v.Int() <= b.Int()
+		}
+	case v.CanUint() && b.CanUint():
+		if r.Name == RuleMin {
+			ok = v.Uint() >= b.Uint()
+		} else {
+			ok = v.Uint() <= b.Uint()
+		}
+	case v.CanFloat() && b.CanFloat():
+		if r.Name == RuleMin {
+			ok = v.Float() >= b.Float()
+		} else {
+			ok = v.Float() <= b.Float()
+		}
+	}
+	if !ok {
+		return xerrors.Errorf("%v must be %s %v", v.Interface(), op, r.bound)
+	}
+	return nil
+}
+
+// FieldError is the error of one struct field when unmarshal.
+type FieldError struct {
+	// Key is the configuration key of field, such as 'server.port'
+	Key string
+
+	// Field is the name of struct field
+	Field string
+
+	Err error
+}
+
+func (e *FieldError) Error() string {
+	var ce *conv.ConversionError
+	if xerrors.As(e.Err, &ce) && ce.Key != "" {
+		// The key is already reported by the conversion error
+		if e.Field == "" {
+			return e.Err.Error()
+		}
+		return fmt.Sprintf("%v (field %s)", e.Err, e.Field)
+	}
+
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %v", e.Key, e.Err)
+	}
+
+	return fmt.Sprintf("%s (field %s): %v", e.Key, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError is the aggregated error of all invalid fields
+// when unmarshal.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+
+	return fmt.Sprintf("%d invalid field(s): %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap will return all field errors, so the xerrors.Is and xerrors.As
+// can match any of them.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		errs = append(errs, fe)
+	}
+	return errs
+}
+
+// Append will append the err to the errors, the *ValidationError
+// will been flattened.
+func (e *ValidationError) Append(err error) {
+	var ve *ValidationError
+	if xerrors.As(err, &ve) {
+		e.Errors = append(e.Errors, ve.Errors...)
+		return
+	}
+
+	var fe *FieldError
+	if xerrors.As(err, &fe) {
+		e.Errors = append(e.Errors, fe)
+		return
+	}
+
+	e.Errors = append(e.Errors, &FieldError{Err: err})
+}
+
+// ErrorOrNil return nil if there is no error.
+func (e *ValidationError) ErrorOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e
+}
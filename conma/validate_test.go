@@ -0,0 +1,325 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestParseValidateRules(t *testing.T) {
+	type testCase struct {
+		desp  string
+		tag   string
+		typ   reflect.Type
+		names []string
+		err   string
+	}
+	testCases := []testCase{
+		{
+			desp:  "normal",
+			tag:   "required, min=1,max=10,,oneof=1 2",
+			typ:   reflect.TypeOf(0),
+			names: []string{RuleRequired, RuleMin, RuleMax, RuleOneOf},
+		},
+		{
+			desp:  "regex with comma",
+			tag:   "nonempty,regex=^a{1,3}$",
+			typ:   reflect.TypeOf(""),
+			names: []string{RuleNonEmpty, RuleRegex},
+		},
+		{
+			desp:  "duration bound",
+			tag:   "min=1s",
+			typ:   reflect.TypeOf(ena.PointerTo(time.Second)),
+			names: []string{RuleMin},
+		},
+		{
+			desp: "unknown rule",
+			tag:  "unknown",
+			typ:  reflect.TypeOf(""),
+			err:  "unknown validate rule 'unknown'",
+		},
+		{
+			desp: "invalid number bound",
+			tag:  "min=a",
+			typ:  reflect.TypeOf(0),
+			err:  "invalid min rule arg 'a'",
+		},
+		{
+			desp: "invalid length bound",
+			tag:  "max=a",
+			typ:  reflect.TypeOf(""),
+			err:  "invalid max rule arg 'a'",
+		},
+		{
+			desp:  "slice element rules",
+			tag:   "nonempty,max=3,oneof=1 2,regex=^a$",
+			typ:   reflect.TypeOf([]string{}),
+			names: []string{RuleNonEmpty, RuleMax, RuleOneOf, RuleRegex},
+		},
+		{
+			desp: "min of bool",
+			tag:  "min=1",
+			typ:  reflect.TypeOf(true),
+			err:  "min rule is not supported by type 'bool'",
+		},
+		{
+			desp: "max of struct",
+			tag:  "max=1",
+			typ:  reflect.TypeOf(ena.PointerTo(testTLSConfig{})),
+			err:  "max rule is not supported by type 'conma.testTLSConfig'",
+		},
+		{
+			desp: "required of nested struct",
+			tag:  "required",
+			typ:  reflect.TypeOf(testTLSConfig{}),
+			err:  "required rule is not supported by nested struct 'conma.testTLSConfig'",
+		},
+		{
+			desp:  "required of pointer to struct",
+			tag:   "required",
+			typ:   reflect.TypeOf(ena.PointerTo(testTLSConfig{})),
+			names: []string{RuleRequired},
+		},
+		{
+			desp: "min of time",
+			tag:  "min=2024-01-01T00:00:00Z",
+			typ:  reflect.TypeOf(time.Time{}),
+			err:  "min rule is not supported by type 'time.Time'",
+		},
+		{
+			desp: "nonempty of int",
+			tag:  "nonempty",
+			typ:  reflect.TypeOf(0),
+			err:  "nonempty rule is not supported by type 'int'",
+		},
+		{
+			desp: "max of array",
+			tag:  "max=1",
+			typ:  reflect.TypeOf([2]int{}),
+			err:  "max rule is not supported by type '\\[2\\]int'",
+		},
+		{
+			desp: "oneof of map",
+			tag:  "oneof=a b",
+			typ:  reflect.TypeOf(map[string]string{}),
+			err:  "oneof rule is not supported by type 'map\\[string\\]string'",
+		},
+		{
+			desp: "regex of int slice",
+			tag:  "regex=^1$",
+			typ:  reflect.TypeOf([]int{}),
+			err:  "regex rule is not supported by type '\\[\\]int'",
+		},
+		{
+			desp: "invalid regex",
+			tag:  "regex=(",
+			typ:  reflect.TypeOf(""),
+			err:  "invalid regex rule arg '\\('",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rules, err := parseValidateRules(tc.tag, tc.typ)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(MatchRegexp(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			names := []string{}
+			for _, r := range rules {
+				names = append(names, r.Name)
+			}
+			g.Expect(names).To(Equal(tc.names))
+		})
+	}
+}
+
+func TestValidateRuleValidate(t *testing.T) {
+	type testCase struct {
+		desp  string
+		tag   string
+		value interface{}
+		err   string
+	}
+	testCases := []testCase{
+		{desp: "required ok", tag: "required", value: "v"},
+		{desp: "required empty string", tag: "required", value: "", err: "is required"},
+		{desp: "required nil pointer", tag: "required", value: (*int)(nil), err: "is required"},
+		{desp: "required explicit false", tag: "required", value: false, err: "is required"},
+		{desp: "required explicit zero", tag: "required", value: 0, err: "is required"},
+		{desp: "required false pointer", tag: "required", value: ena.PointerTo(false), err: "is required"},
+		{desp: "nil pointer skip other rules", tag: "min=1", value: (*int)(nil)},
+		{desp: "nonempty ok", tag: "nonempty", value: []string{"a"}},
+		{desp: "nonempty failed", tag: "nonempty", value: []string{}, err: "must not be empty"},
+		{desp: "min int ok", tag: "min=1", value: 1},
+		{desp: "min int failed", tag: "min=1", value: 0, err: "0 must be >= 1"},
+		{desp: "max uint failed", tag: "max=1", value: uint8(2), err: "2 must be <= 1"},
+		{desp: "max float failed", tag: "max=1.5", value: 1.6, err: "1.6 must be <= 1.5"},
+		{desp: "min duration failed", tag: "min=1s", value: time.Millisecond, err: "1ms must be >= 1s"},
+		{desp: "min duration pointer ok", tag: "min=1s", value: ena.PointerTo(time.Second)},
+		{desp: "min length failed", tag: "min=2", value: "a", err: "length 1 must be >= 2"},
+		{desp: "max length failed", tag: "max=1", value: []int{1, 2}, err: "length 2 must be <= 1"},
+		{desp: "oneof ok", tag: "oneof=a b", value: "b"},
+		{desp: "oneof failed", tag: "oneof=a b", value: "c", err: "'c' must be one of \\[a b\\]"},
+		{desp: "oneof slice failed", tag: "oneof=1 2", value: []int{1, 3}, err: "index 1: '3' must be one of"},
+		{desp: "regex ok", tag: "regex=^a{1,3}$", value: "aa"},
+		{desp: "regex failed", tag: "regex=^a{1,3}$", value: "aaaa", err: "'aaaa' must match"},
+		{desp: "regex slice failed", tag: "regex=^a$", value: []string{"a", "b"}, err: "index 1: 'b' must match"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			v := reflect.ValueOf(tc.value)
+			rules, err := parseValidateRules(tc.tag, v.Type())
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(rules).To(HaveLen(1))
+
+			err = rules[0].Validate(v)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).To(MatchRegexp(tc.err))
+				return
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	g := NewWithT(t)
+
+	errs := &ValidationError{}
+	g.Expect(errs.ErrorOrNil()).To(BeNil())
+
+	errs.Append(&FieldError{Key: "k1", Field: "F1", Err: xerrors.ErrNotFound})
+	errs.Append(&ValidationError{
+		Errors: []*FieldError{
+			{Key: "k2", Field: "F2", Err: xerrors.Errorf("is required")},
+		},
+	})
+	errs.Append(xerrors.ErrContinue)
+
+	err := errs.ErrorOrNil()
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(err.Error()).To(Equal("3 invalid field(s): k1 (field F1): ObjectNotFound; " +
+		"k2 (field F2): is required; : Continue"))
+	g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(xerrors.IsContinue(err)).To(BeTrue())
+
+	var fe *FieldError
+	g.Expect(xerrors.As(err, &fe)).To(BeTrue())
+	g.Expect(fe.Key).To(Equal("k1"))
+}
+
+func TestConfigMgrUnmarshalValidate(t *testing.T) {
+	type testObj struct {
+		host  string        `conma:"server.host" validate:"required"`
+		port  int           `conma:"server.port:=80" validate:"min=1,max=65535"`
+		mode  string        `conma:"server.mode:=debug" validate:"oneof=debug release"`
+		peers []string      `conma:"server.peers" validate:"nonempty,regex=^[a-z]+:[0-9]+$"`
+		idle  time.Duration `conma:"server.idle:=1m" validate:"max=10m"`
+		retry int           `conma:"server.retry"`
+	}
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"server.host":     "h1",
+				"server.peers[0]": "a:1",
+				"server.retry":    "3",
+			},
+		}
+
+		var o testObj
+		g.Expect(mgr.Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			host:  "h1",
+			port:  80,
+			mode:  "debug",
+			peers: []string{"a:1"},
+			idle:  time.Minute,
+			retry: 3,
+		}))
+	})
+
+	t.Run("aggregated error", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"server.host":     "",
+				"server.port":     "0",
+				"server.mode":     "test",
+				"server.peers[0]": "A:1",
+				"server.idle":     "1h",
+			},
+		}
+
+		var o testObj
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+
+		var ve *ValidationError
+		g.Expect(xerrors.As(err, &ve)).To(BeTrue())
+		keys := []string{}
+		for _, fe := range ve.Errors {
+			keys = append(keys, fe.Key)
+		}
+		g.Expect(keys).To(Equal([]string{
+			"server.host",
+			"server.port",
+			"server.mode",
+			"server.peers",
+			"server.idle",
+			"server.retry",
+		}))
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+		g.Expect(o).To(Equal(testObj{}))
+	})
+
+	t.Run("invalid tag", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+
+		var o struct {
+			v1 string `conma:"k1" validate:"unknown"` //nolint
+		}
+		err := mgr.Unmarshal(&o)
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(err.Error()).To(ContainSubstring("unknown validate rule 'unknown'"))
+	})
+}
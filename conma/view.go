@@ -0,0 +1,171 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// ConfigView is the read-only view of configuration items.
+type ConfigView interface {
+	// Unmarshal will load the configuration item to object base on
+	// tag.
+	Unmarshal(o interface{}) error
+
+	// Get will retrieve the configuration item with key, the value is
+	// converted to type specified by WithType or WithTarget option.
+	// Use the generic Get function for type safety.
+	Get(key string, opts ...ena.Option[getOption]) (interface{}, error)
+
+	// IsSet return true if the key, or any item under it, is set.
+	IsSet(key string) bool
+
+	// Keys return the sorted keys of items which is or under the prefix,
+	// empty prefix will return all keys.
+	Keys(prefix string) []string
+
+	// Sub return the view of items under prefix, the keys of view is
+	// relative to prefix, such as 'port' for 'server.port' with prefix 'server'.
+	Sub(prefix string) ConfigView
+}
+
+// Get will retrieve the configuration item with key from v, and convert
+// it to type T, such as:
+//
+//	port, err := conma.Get[int](mgr, "server.port", conma.WithDefault("80"))
+func Get[T any](v ConfigView, key string, opts ...ena.Option[getOption]) (T, error) {
+	var zero T
+
+	opts = append(opts, WithType(reflect.TypeOf(&zero).Elem()))
+	value, err := v.Get(key, opts...)
+	if err != nil {
+		return zero, err
+	}
+
+	ret, ok := value.(T)
+	if !ok {
+		return zero, xerrors.Errorf("The value of key '%s' is '%T', not '%T'", key, value, zero)
+	}
+	return ret, nil
+}
+
+// Get will retrieve the configuration item with key.
+func (m *configMgr) Get(key string, opts ...ena.Option[getOption]) (interface{}, error) {
+	return m.snapshot().Get(key, opts...)
+}
+
+// IsSet return true if the key, or any item under it, is set.
+func (m *configMgr) IsSet(key string) bool {
+	return m.snapshot().IsSet(key)
+}
+
+// Keys return the sorted keys of items which is or under the prefix.
+func (m *configMgr) Keys(prefix string) []string {
+	return m.snapshot().Keys(prefix)
+}
+
+// Sub return the view of items under prefix, the view will reflect
+// the changes after Reload.
+func (m *configMgr) Sub(prefix string) ConfigView {
+	return &subView{
+		m:      m,
+		prefix: prefix,
+	}
+}
+
+// subView is the ConfigView of items under prefix.
+type subView struct {
+	m      *configMgr
+	prefix string
+}
+
+func (v *subView) key(key string) string {
+	return joinKey(v.prefix, key)
+}
+
+func (v *subView) Unmarshal(o interface{}) error {
+	return v.m.unmarshal(o, v.prefix)
+}
+
+func (v *subView) Get(key string, opts ...ena.Option[getOption]) (interface{}, error) {
+	return v.m.Get(v.key(key), opts...)
+}
+
+func (v *subView) IsSet(key string) bool {
+	return v.m.IsSet(v.key(key))
+}
+
+func (v *subView) Keys(prefix string) []string {
+	keys := v.m.Keys(v.key(prefix))
+	if v.prefix == "" {
+		return keys
+	}
+
+	ret := make([]string, 0, len(keys))
+	for _, k := range keys {
+		// The key such as 'prefix[0]' cannot been represent in the view
+		if strings.HasPrefix(k, v.prefix+".") {
+			ret = append(ret, k[len(v.prefix)+1:])
+		}
+	}
+	return ret
+}
+
+func (v *subView) Sub(prefix string) ConfigView {
+	return &subView{
+		m:      v.m,
+		prefix: v.key(prefix),
+	}
+}
+
+// IsSet return true if the key, or any item under it, is set.
+func (s *flattenStorage) IsSet(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for k := range s.items {
+		if matchPrefix(k, key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keys return the sorted keys of items which is or under the prefix.
+func (s *flattenStorage) Keys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := []string{}
+	for k := range s.items {
+		if matchPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
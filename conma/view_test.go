@@ -0,0 +1,203 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func newTestViewMgr() *configMgr {
+	mgr := NewConfigMgr().(*configMgr)
+	mgr.store = &flattenStorage{
+		items: map[string]string{
+			"name":               "n1",
+			"server.host":        "h1",
+			"server.port":        "8080",
+			"server.timeout":     "1s",
+			"server.peers[0]":    "p1",
+			"server.peers[1]":    "p2",
+			"server.tls.enabled": "true",
+			"servers":            "s1",
+		},
+	}
+	return mgr
+}
+
+func TestGet(t *testing.T) {
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := newTestViewMgr()
+
+		port, err := Get[int](mgr, "server.port")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(port).To(Equal(8080))
+
+		timeout, err := Get[time.Duration](mgr, "server.timeout")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(timeout).To(Equal(time.Second))
+
+		peers, err := Get[[]string](mgr, "server.peers")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(peers).To(Equal([]string{"p1", "p2"}))
+
+		host, err := Get[*string](mgr, "server.host")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(host).To(Equal(ena.PointerTo("h1")))
+
+		retry, err := Get[uint8](mgr, "server.retry", WithDefault("3"))
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(retry).To(Equal(uint8(3)))
+	})
+
+	t.Run("nested list", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := NewConfigMgr().(*configMgr)
+		mgr.store = &flattenStorage{
+			items: map[string]string{
+				"groups[0][0]":       "g1",
+				"groups[0][1]":       "g2",
+				"groups[1][0]":       "g3",
+				"routes[0].hosts[0]": "h1",
+				"routes[0].hosts[1]": "h2",
+			},
+		}
+
+		group, err := Get[[]string](mgr, "groups[0]")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(group).To(Equal([]string{"g1", "g2"}))
+
+		hosts, err := Get[[]string](mgr, "routes[0].hosts")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(hosts).To(Equal([]string{"h1", "h2"}))
+
+		// The nested elements is not the element of the list
+		_, err = Get[[]string](mgr, "groups")
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+		_, err = Get[[]string](mgr, "routes")
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := newTestViewMgr()
+
+		_, err := Get[int](mgr, "server.retry")
+		g.Expect(xerrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	t.Run("convert failed", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := newTestViewMgr()
+
+		v, err := Get[int](mgr, "server.host")
+		g.Expect(err).To(HaveOccurred())
+		g.Expect(v).To(Equal(0))
+	})
+}
+
+func TestConfigMgrIsSetAndKeys(t *testing.T) {
+	g := NewWithT(t)
+	mgr := newTestViewMgr()
+
+	g.Expect(mgr.IsSet("server")).To(BeTrue())
+	g.Expect(mgr.IsSet("server.peers")).To(BeTrue())
+	g.Expect(mgr.IsSet("server.tls")).To(BeTrue())
+	g.Expect(mgr.IsSet("server.retry")).To(BeFalse())
+	g.Expect(mgr.IsSet("serv")).To(BeFalse())
+
+	g.Expect(mgr.Keys("server.peers")).To(Equal([]string{"server.peers[0]", "server.peers[1]"}))
+	g.Expect(mgr.Keys("server.tls")).To(Equal([]string{"server.tls.enabled"}))
+	g.Expect(mgr.Keys("")).To(HaveLen(8))
+	g.Expect(mgr.Keys("unknown")).To(BeEmpty())
+}
+
+func TestConfigMgrSub(t *testing.T) {
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := newTestViewMgr()
+
+		sub := mgr.Sub("server")
+		g.Expect(sub.Keys("")).To(Equal([]string{
+			"host",
+			"peers[0]",
+			"peers[1]",
+			"port",
+			"timeout",
+			"tls.enabled",
+		}))
+		g.Expect(sub.IsSet("host")).To(BeTrue())
+		g.Expect(sub.IsSet("name")).To(BeFalse())
+
+		port, err := Get[int](sub, "port")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(port).To(Equal(8080))
+
+		tls := sub.Sub("tls")
+		g.Expect(tls.Keys("")).To(Equal([]string{"enabled"}))
+		enabled, err := Get[bool](tls, "enabled")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(enabled).To(BeTrue())
+
+		g.Expect(mgr.Sub("").Keys("server.tls")).To(Equal([]string{"server.tls.enabled"}))
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		g := NewWithT(t)
+		mgr := newTestViewMgr()
+
+		type testObj struct {
+			host  string   `conma:"host"`
+			port  int      `conma:"port"`
+			peers []string `conma:"peers"`
+		}
+		var o testObj
+		g.Expect(mgr.Sub("server").Unmarshal(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{
+			host:  "h1",
+			port:  8080,
+			peers: []string{"p1", "p2"},
+		}))
+	})
+
+	t.Run("reflect reload", func(t *testing.T) {
+		g := NewWithT(t)
+
+		value := "h1"
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				return r.Set("server.host", value)
+			},
+		})
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		sub := mgr.Sub("server")
+		value = "h2"
+		g.Expect(mgr.Reload()).ToNot(HaveOccurred())
+		host, err := Get[string](sub, "host")
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(host).To(Equal("h2"))
+	})
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xslog"
+)
+
+// ChangeType is the type of configuration item change.
+type ChangeType string
+
+const (
+	// ChangeAdded represent the key is added.
+	ChangeAdded ChangeType = "Added"
+
+	// ChangeUpdated represent the value of key is updated.
+	ChangeUpdated ChangeType = "Updated"
+
+	// ChangeDeleted represent the key is deleted.
+	ChangeDeleted ChangeType = "Deleted"
+)
+
+// Change is the change of one flattened configuration item
+// between two reload.
+type Change struct {
+	Key      string
+	Type     ChangeType
+	OldValue string
+	NewValue string
+}
+
+// ChangeHandler will been invoked with the changes which match
+// the subscribed prefix, the changes is sorted by key.
+type ChangeHandler func(changes []Change)
+
+// diffItems return the key-level changes from old to new, sorted by key.
+func diffItems(old map[string]string, new map[string]string) []Change {
+	changes := []Change{}
+	for k, ov := range old {
+		nv, ok := new[k]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Key: k, Type: ChangeDeleted, OldValue: ov})
+		case nv != ov:
+			changes = append(changes, Change{Key: k, Type: ChangeUpdated, OldValue: ov, NewValue: nv})
+		}
+	}
+	for k, nv := range new {
+		if _, ok := old[k]; !ok {
+			changes = append(changes, Change{Key: k, Type: ChangeAdded, NewValue: nv})
+		}
+	}
+
+	sort.Slice(changes, func(i int, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return changes
+}
+
+// matchPrefix return true if the key is the prefix itself or it's
+// child (by '.' or '[' separator), empty prefix match all keys.
+func matchPrefix(key string, prefix string) bool {
+	if prefix == "" || key == prefix {
+		return true
+	}
+
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+
+	return key[len(prefix)] == '.' || key[len(prefix)] == '['
+}
+
+type subscription struct {
+	prefix string
+	fn     ChangeHandler
+}
+
+// subscribers is the registry of ChangeHandler.
+type subscribers struct {
+	mu    sync.Mutex
+	next  int
+	items map[int]*subscription
+}
+
+func (s *subscribers) Add(prefix string, fn ChangeHandler) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.items == nil {
+		s.items = map[int]*subscription{}
+	}
+	id := s.next
+	s.next++
+	s.items[id] = &subscription{
+		prefix: prefix,
+		fn:     fn,
+	}
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.items, id)
+	}
+}
+
+// Notify will invoke every subscription with the matched changes, the
+// subscription without any matched change will not been invoked.
+func (s *subscribers) Notify(changes []Change) {
+	s.mu.Lock()
+	ids := make([]int, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	subs := make([]*subscription, 0, len(ids))
+	for _, id := range ids {
+		subs = append(subs, s.items[id])
+	}
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		matched := []Change{}
+		for _, c := range changes {
+			if matchPrefix(c.Key, sub.prefix) {
+				matched = append(matched, c)
+			}
+		}
+
+		if len(matched) > 0 {
+			sub.fn(matched)
+		}
+	}
+}
+
+type watchOption struct {
+	// Interval is the duration between two check of WatchableConfigReader.
+	// Default: 5s
+	Interval time.Duration
+
+	// ErrorHandler will been invoked when check or reload failed, the
+	// watch will continue after that.
+	// Default: log the error with logger in context
+	ErrorHandler func(ctx context.Context, err error)
+}
+
+func defaultWatchOption() *watchOption {
+	return &watchOption{
+		Interval: 5 * time.Second,
+		ErrorHandler: func(ctx context.Context, err error) {
+			xslog.FromContext(ctx).ErrorContext(ctx, "conma: watch config failed", "error", err)
+		},
+	}
+}
+
+// WithWatchInterval will set the interval option
+func WithWatchInterval(d time.Duration) ena.Option[watchOption] {
+	return ena.NewFnOption(func(opt *watchOption) {
+		opt.Interval = d
+	})
+}
+
+// WithWatchErrorHandler will set the error handler option
+func WithWatchErrorHandler(fn func(ctx context.Context, err error)) ena.Option[watchOption] {
+	return ena.NewFnOption(func(opt *watchOption) {
+		opt.ErrorHandler = fn
+	})
+}
+
+// Watch will check all WatchableConfigReader periodically, and reload
+// the configuration if any of them is changed. It will block until the
+// ctx is done.
+func (m *configMgr) Watch(ctx context.Context, opts ...ena.Option[watchOption]) error {
+	opt := defaultWatchOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+
+	ticker := time.NewTicker(opt.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		changed, err := m.changed(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				// The check is cancelled by ctx, it's not the reader error
+				return ctx.Err()
+			}
+			opt.ErrorHandler(ctx, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		if err := m.reload(ctx); err != nil {
+			opt.ErrorHandler(ctx, err)
+		}
+	}
+}
+
+// changed will check the readers with ctx, so that the slow check such as
+// the http request is cancelled with the Watch.
+func (m *configMgr) changed(ctx context.Context) (bool, error) {
+	m.readMu.Lock()
+	readers := append([]ConfigReader{}, m.configReaders...)
+	m.readMu.Unlock()
+
+	for _, r := range readers {
+		wr, ok := r.(WatchableConfigReader)
+		if !ok {
+			continue
+		}
+
+		changed, err := changedWithContext(ctx, wr)
+		if err != nil {
+			return false, err
+		}
+		if changed {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Reload will re-read all ConfigReader to a fresh storage, and replace
+// the current storage with it. The bound objects are re-unmarshaled and
+// the subscribers are notified with the changed keys.
+// If any reader or bound object failed, the current storage is kept
+// and none of the bound objects is modified.
+func (m *configMgr) Reload() error {
+	return m.reload(context.Background())
+}
+
+func (m *configMgr) reload(ctx context.Context) error {
+	changes, err := m.swap(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The handlers is invoked without lock, so that they can call the
+	// methods of mgr, such as Bind and Reload.
+	if len(changes) > 0 {
+		m.subscribers.Notify(changes)
+	}
+	return nil
+}
+
+// swap will read all readers to the new storage and update the bound objects,
+// then replace the current storage by it and return the changes.
+func (m *configMgr) swap(ctx context.Context) ([]Change, error) {
+	m.readMu.Lock()
+	defer m.readMu.Unlock()
+
+	// Read to the new storage, and publish it after all readers succeed. The
+	// current storage is not reused, otherwise the lists will been appended
+	// again by MergeAppend rule.
+	store := newFlattenStorage()
+	if err := m.readTo(ctx, store); err != nil {
+		return nil, err
+	}
+
+	// Prepare all bound objects with the new storage before swap it,
+	// so that the objects are updated all or nothing.
+	next := &configMgr{
+		store: store,
+	}
+	p := &appliers{
+		applies: make([]Applier, 0),
+	}
+	m.bindMu.Lock()
+	defer m.bindMu.Unlock()
+	for _, o := range m.bindings {
+		v := reflect.ValueOf(o).Elem()
+		if err := next.unmarshalToStruct(v, "", p); err != nil {
+			return nil, err
+		}
+		if err := m.checkStrict(store, v.Type(), ""); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changes := diffItems(m.store.items, store.items)
+	m.store = store
+	p.Apply()
+	return changes, nil
+}
+
+// Subscribe will register the handler for changes of keys with prefix, the
+// handler will been invoked after each ReadConfig or Reload which changed the
+// matched keys. Empty prefix will match all keys.
+func (m *configMgr) Subscribe(prefix string, fn ChangeHandler) (cancel func()) {
+	return m.subscribers.Add(prefix, fn)
+}
+
+// Bind will unmarshal the configuration items to o, and re-unmarshal it
+// after each successful ReadConfig or Reload.
+func (m *configMgr) Bind(o interface{}) error {
+	m.bindMu.Lock()
+	defer m.bindMu.Unlock()
+
+	if err := m.Unmarshal(o); err != nil {
+		return err
+	}
+
+	m.bindings = append(m.bindings, o)
+	return nil
+}
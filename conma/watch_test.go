@@ -0,0 +1,316 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conma
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+func TestDiffItems(t *testing.T) {
+	g := NewWithT(t)
+
+	changes := diffItems(map[string]string{
+		"k1": "v1",
+		"k2": "v2",
+		"k3": "v3",
+	}, map[string]string{
+		"k1": "v1",
+		"k2": "v2.1",
+		"k4": "v4",
+	})
+	g.Expect(changes).To(Equal([]Change{
+		{Key: "k2", Type: ChangeUpdated, OldValue: "v2", NewValue: "v2.1"},
+		{Key: "k3", Type: ChangeDeleted, OldValue: "v3"},
+		{Key: "k4", Type: ChangeAdded, NewValue: "v4"},
+	}))
+}
+
+func TestMatchPrefix(t *testing.T) {
+	type testCase struct {
+		desp   string
+		key    string
+		prefix string
+		expect bool
+	}
+	testCases := []testCase{
+		{desp: "empty prefix", key: "k1.k2", prefix: "", expect: true},
+		{desp: "equal", key: "k1", prefix: "k1", expect: true},
+		{desp: "child", key: "k1.k2", prefix: "k1", expect: true},
+		{desp: "index", key: "k1[0]", prefix: "k1", expect: true},
+		{desp: "same prefix but not child", key: "k10", prefix: "k1", expect: false},
+		{desp: "not match", key: "k2.k1", prefix: "k1", expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(matchPrefix(tc.key, tc.prefix)).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestSubscribers(t *testing.T) {
+	g := NewWithT(t)
+
+	s := &subscribers{}
+	var all, k1 [][]Change
+	s.Add("", func(changes []Change) {
+		all = append(all, changes)
+	})
+	cancel := s.Add("k1", func(changes []Change) {
+		k1 = append(k1, changes)
+	})
+
+	s.Notify([]Change{
+		{Key: "k1.k2", Type: ChangeAdded, NewValue: "v1"},
+		{Key: "k2", Type: ChangeAdded, NewValue: "v2"},
+	})
+	s.Notify([]Change{
+		{Key: "k2", Type: ChangeDeleted, OldValue: "v2"},
+	})
+	cancel()
+	s.Notify([]Change{
+		{Key: "k1", Type: ChangeAdded, NewValue: "v1"},
+	})
+
+	g.Expect(all).To(HaveLen(3))
+	g.Expect(k1).To(Equal([][]Change{
+		{
+			{Key: "k1.k2", Type: ChangeAdded, NewValue: "v1"},
+		},
+	}))
+}
+
+func TestConfigMgrReload(t *testing.T) {
+	type testObj struct {
+		v1 string `conma:"k1"`
+		v2 int    `conma:"k2:=1"`
+	}
+
+	t.Run("normal test", func(t *testing.T) {
+		g := NewWithT(t)
+
+		items := map[string]interface{}{"k1": "v1"}
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				for k, v := range items {
+					if err := r.Set(k, v); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		g.Expect(mgr.Bind(&o)).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{v1: "v1", v2: 1}))
+
+		var changes []Change
+		mgr.Subscribe("k2", func(c []Change) {
+			changes = append(changes, c...)
+		})
+
+		items = map[string]interface{}{"k1": "v1.1", "k2": 2}
+		g.Expect(mgr.Reload()).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{v1: "v1.1", v2: 2}))
+		g.Expect(changes).To(Equal([]Change{
+			{Key: "k2", Type: ChangeAdded, NewValue: "2"},
+		}))
+	})
+
+	t.Run("bound object failed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		items := map[string]interface{}{"k1": "v1"}
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				for k, v := range items {
+					if err := r.Set(k, v); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		}).(*configMgr)
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		g.Expect(mgr.Bind(&o)).ToNot(HaveOccurred())
+		count := 0
+		mgr.Subscribe("", func(c []Change) {
+			count++
+		})
+
+		items = map[string]interface{}{"k1": "v1.1", "k2": "abc"}
+		g.Expect(mgr.Reload()).To(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{v1: "v1", v2: 1}))
+		g.Expect(mgr.store.items).To(Equal(map[string]string{"k1": "v1"}))
+		g.Expect(count).To(Equal(0))
+	})
+
+	t.Run("reentrant handler", func(t *testing.T) {
+		g := NewWithT(t)
+
+		value := "v1"
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				return r.Set("k1", value)
+			},
+		})
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		mgr.Subscribe("k1", func(c []Change) {
+			// The handler can call the methods which acquire the locks of mgr
+			mgr.AddConfigReader(&testConfigReader{
+				fnReadTo: func(r ConfigStorage) error {
+					return nil
+				},
+			})
+			if value == "v2" {
+				value = "v3"
+				g.Expect(mgr.Reload()).ToNot(HaveOccurred())
+			}
+			g.Expect(mgr.Bind(&o)).ToNot(HaveOccurred())
+		})
+
+		done := make(chan error, 1)
+		go func() {
+			value = "v2"
+			done <- mgr.Reload()
+		}()
+		g.Eventually(done, time.Second).Should(Receive(BeNil()))
+		g.Expect(o).To(Equal(testObj{v1: "v3", v2: 1}))
+	})
+
+	t.Run("read config", func(t *testing.T) {
+		g := NewWithT(t)
+
+		value := "v1"
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				return r.Set("k1", value)
+			},
+		})
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		var o testObj
+		g.Expect(mgr.Bind(&o)).ToNot(HaveOccurred())
+		var changes []Change
+		mgr.Subscribe("", func(c []Change) {
+			changes = append(changes, c...)
+		})
+
+		// The ReadConfig is the same as Reload
+		value = "v2"
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+		g.Expect(o).To(Equal(testObj{v1: "v2", v2: 1}))
+		g.Expect(changes).To(Equal([]Change{
+			{Key: "k1", Type: ChangeUpdated, OldValue: "v1", NewValue: "v2"},
+		}))
+	})
+
+	t.Run("reader failed", func(t *testing.T) {
+		g := NewWithT(t)
+
+		fail := false
+		mgr := NewConfigMgr(&testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				if fail {
+					return xerrors.ErrContinue
+				}
+				return r.Set("k1", "v1")
+			},
+		}).(*configMgr)
+		g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+		fail = true
+		g.Expect(mgr.Reload()).To(HaveOccurred())
+		g.Expect(mgr.store.items).To(Equal(map[string]string{"k1": "v1"}))
+	})
+}
+
+type testWatchableConfigReader struct {
+	testConfigReader
+
+	fnChanged func() (bool, error)
+}
+
+func (r *testWatchableConfigReader) Changed() (bool, error) {
+	return r.fnChanged()
+}
+
+func TestConfigMgrWatch(t *testing.T) {
+	g := NewWithT(t)
+
+	var mu sync.Mutex
+	value := "v1"
+	changed := false
+	mgr := NewConfigMgr(&testWatchableConfigReader{
+		testConfigReader: testConfigReader{
+			fnReadTo: func(r ConfigStorage) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				changed = false
+				return r.Set("k1", value)
+			},
+		},
+		fnChanged: func() (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			return changed, nil
+		},
+	})
+	g.Expect(mgr.ReadConfig()).ToNot(HaveOccurred())
+
+	ch := make(chan []Change, 1)
+	mgr.Subscribe("k1", func(c []Change) {
+		ch <- c
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- mgr.Watch(ctx, WithWatchInterval(10*time.Millisecond))
+	}()
+
+	mu.Lock()
+	value = "v2"
+	changed = true
+	mu.Unlock()
+
+	g.Eventually(ch).Should(Receive(Equal([]Change{
+		{Key: "k1", Type: ChangeUpdated, OldValue: "v1", NewValue: "v2"},
+	})))
+
+	cancel()
+	g.Eventually(done).Should(Receive(MatchError(context.Canceled)))
+}
@@ -0,0 +1,131 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conv
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// ByteSize is the size in bytes, it's converted from string such as
+// '512', '10KB' or '10MiB'. The units is case-insensitive, the decimal
+// units (KB, MB...) is power of 1000 and the binary units (KiB, MiB...)
+// is power of 1024.
+type ByteSize uint64
+
+// The common ByteSize units.
+const (
+	Byte ByteSize = 1
+	KB            = 1000 * Byte
+	MB            = 1000 * KB
+	GB            = 1000 * MB
+	TB            = 1000 * GB
+	PB            = 1000 * TB
+	KiB           = 1024 * Byte
+	MiB           = 1024 * KiB
+	GiB           = 1024 * MiB
+	TiB           = 1024 * GiB
+	PiB           = 1024 * TiB
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"k":   KiB,
+	"kb":  KB,
+	"kib": KiB,
+	"m":   MiB,
+	"mb":  MB,
+	"mib": MiB,
+	"g":   GiB,
+	"gb":  GB,
+	"gib": GiB,
+	"t":   TiB,
+	"tb":  TB,
+	"tib": TiB,
+	"p":   PiB,
+	"pb":  PB,
+	"pib": PiB,
+}
+
+// ParseByteSize will parse the s to ByteSize, the number can be decimal
+// such as '1.5GiB', and the single letter unit such as '10M' is binary.
+func ParseByteSize(s string) (ByteSize, error) {
+	origin := s
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return r != '.' && !unicode.IsDigit(r)
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, newConversionError(reflect.TypeOf(ByteSize(0)), origin, xerrors.Errorf("unknown unit '%s'", s[i:]))
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, newConversionError(reflect.TypeOf(ByteSize(0)), origin, err)
+	}
+
+	v := n * float64(unit)
+	if v >= math.MaxUint64 {
+		return 0, newConversionError(reflect.TypeOf(ByteSize(0)), origin, strconv.ErrRange)
+	}
+	return ByteSize(v), nil
+}
+
+// UnmarshalText will implement encoding.TextUnmarshaler by ParseByteSize.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	v, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+
+	*b = v
+	return nil
+}
+
+// MarshalText will implement encoding.TextMarshaler, the largest binary
+// unit which divide the size exactly is used, such as '10MiB'.
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b ByteSize) String() string {
+	units := []struct {
+		name string
+		size ByteSize
+	}{
+		{"PiB", PiB}, {"TiB", TiB}, {"GiB", GiB}, {"MiB", MiB}, {"KiB", KiB},
+	}
+	for _, u := range units {
+		if b >= u.size && b%u.size == 0 {
+			return strconv.FormatUint(uint64(b/u.size), 10) + u.name
+		}
+	}
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
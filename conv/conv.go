@@ -22,29 +22,57 @@ package conv
 
 import (
 	"context"
+	"encoding/base64"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/lsytj0413/ena/xerrors"
 )
 
+// intBase return the base to parse s, the base prefix ('0x', '0o' and '0b')
+// and underscores is accepted, but the leading zero is still decimal.
+func intBase(s string) int {
+	s = strings.TrimLeft(s, "+-")
+	if len(s) > 1 && s[0] == '0' {
+		switch s[1] {
+		case 'x', 'X', 'o', 'O', 'b', 'B':
+			return 0
+		}
+		return 10
+	}
+
+	return 0
+}
+
+func parseInt(s string, bitSize int) (int64, error) {
+	return strconv.ParseInt(s, intBase(s), bitSize)
+}
+
+func parseUint(s string, bitSize int) (uint64, error) {
+	return strconv.ParseUint(s, intBase(s), bitSize)
+}
+
 // ConvertToBool converts []string to bool. Only the first data is used.
 func ConvertToBool(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
 	target, err := strconv.ParseBool(origin)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type bool", origin)
+		return nil, newConversionError(reflect.TypeOf(false), origin, err)
 	}
 	return target, nil
 }
 
-// ConvertToInt converts []string to int. Only the first data is used.
+// ConvertToInt converts []string to int. Only the first data is used, the
+// base prefix such as '0x' and underscores is accepted. It's the same for
+// the other integer types.
 func ConvertToInt(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseInt(origin, 10, 0)
+	target, err := parseInt(origin, 0)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type int", origin)
+		return nil, newConversionError(reflect.TypeOf(int(0)), origin, err)
 	}
 	return int(target), nil
 }
@@ -52,9 +80,9 @@ func ConvertToInt(_ context.Context, data []string) (interface{}, error) {
 // ConvertToInt8 converts []string to int8. Only the first data is used.
 func ConvertToInt8(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseInt(origin, 10, 8)
+	target, err := parseInt(origin, 8)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type int8", origin)
+		return nil, newConversionError(reflect.TypeOf(int8(0)), origin, err)
 	}
 	return int8(target), nil
 }
@@ -62,9 +90,9 @@ func ConvertToInt8(_ context.Context, data []string) (interface{}, error) {
 // ConvertToInt16 converts []string to int16. Only the first data is used.
 func ConvertToInt16(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseInt(origin, 10, 16)
+	target, err := parseInt(origin, 16)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type int16", origin)
+		return nil, newConversionError(reflect.TypeOf(int16(0)), origin, err)
 	}
 	return int16(target), nil
 }
@@ -72,9 +100,9 @@ func ConvertToInt16(_ context.Context, data []string) (interface{}, error) {
 // ConvertToInt32 converts []string to int32. Only the first data is used.
 func ConvertToInt32(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseInt(origin, 10, 32)
+	target, err := parseInt(origin, 32)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type int32", origin)
+		return nil, newConversionError(reflect.TypeOf(int32(0)), origin, err)
 	}
 	return int32(target), nil
 }
@@ -82,9 +110,9 @@ func ConvertToInt32(_ context.Context, data []string) (interface{}, error) {
 // ConvertToInt64 converts []string to int64. Only the first data is used.
 func ConvertToInt64(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseInt(origin, 10, 64)
+	target, err := parseInt(origin, 64)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type int64", origin)
+		return nil, newConversionError(reflect.TypeOf(int64(0)), origin, err)
 	}
 	return target, nil
 }
@@ -92,9 +120,9 @@ func ConvertToInt64(_ context.Context, data []string) (interface{}, error) {
 // ConvertToUint converts []string to uint. Only the first data is used.
 func ConvertToUint(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseUint(origin, 10, 0)
+	target, err := parseUint(origin, 0)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type uint", origin)
+		return nil, newConversionError(reflect.TypeOf(uint(0)), origin, err)
 	}
 	return uint(target), nil
 }
@@ -102,9 +130,9 @@ func ConvertToUint(_ context.Context, data []string) (interface{}, error) {
 // ConvertToUint8 converts []string to uint8. Only the first data is used.
 func ConvertToUint8(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseUint(origin, 10, 8)
+	target, err := parseUint(origin, 8)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type uint8", origin)
+		return nil, newConversionError(reflect.TypeOf(uint8(0)), origin, err)
 	}
 	return uint8(target), nil
 }
@@ -112,9 +140,9 @@ func ConvertToUint8(_ context.Context, data []string) (interface{}, error) {
 // ConvertToUint16 converts []string to uint16. Only the first data is used.
 func ConvertToUint16(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseUint(origin, 10, 16)
+	target, err := parseUint(origin, 16)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type uint16", origin)
+		return nil, newConversionError(reflect.TypeOf(uint16(0)), origin, err)
 	}
 	return uint16(target), nil
 }
@@ -122,9 +150,9 @@ func ConvertToUint16(_ context.Context, data []string) (interface{}, error) {
 // ConvertToUint32 converts []string to uint32. Only the first data is used.
 func ConvertToUint32(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseUint(origin, 10, 32)
+	target, err := parseUint(origin, 32)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type uint32", origin)
+		return nil, newConversionError(reflect.TypeOf(uint32(0)), origin, err)
 	}
 	return uint32(target), nil
 }
@@ -132,9 +160,9 @@ func ConvertToUint32(_ context.Context, data []string) (interface{}, error) {
 // ConvertToUint64 converts []string to uint64. Only the first data is used.
 func ConvertToUint64(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
-	target, err := strconv.ParseUint(origin, 10, 64)
+	target, err := parseUint(origin, 64)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type uint64", origin)
+		return nil, newConversionError(reflect.TypeOf(uint64(0)), origin, err)
 	}
 	return target, nil
 }
@@ -144,7 +172,7 @@ func ConvertToFloat32(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
 	target, err := strconv.ParseFloat(origin, 32)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type float32", origin)
+		return nil, newConversionError(reflect.TypeOf(float32(0)), origin, err)
 	}
 	return float32(target), nil
 }
@@ -154,7 +182,49 @@ func ConvertToFloat64(_ context.Context, data []string) (interface{}, error) {
 	origin := data[0]
 	target, err := strconv.ParseFloat(origin, 64)
 	if err != nil {
-		return nil, xerrors.Wrapf(err, "Cann't convert %s to type float64", origin)
+		return nil, newConversionError(reflect.TypeOf(float64(0)), origin, err)
+	}
+	return target, nil
+}
+
+// ConvertToComplex64 converts []string to complex64. Only the first data is used.
+func ConvertToComplex64(_ context.Context, data []string) (interface{}, error) {
+	origin := data[0]
+	target, err := strconv.ParseComplex(origin, 64)
+	if err != nil {
+		return nil, newConversionError(reflect.TypeOf(complex64(0)), origin, err)
+	}
+	return complex64(target), nil
+}
+
+// ConvertToComplex128 converts []string to complex128. Only the first data is used.
+func ConvertToComplex128(_ context.Context, data []string) (interface{}, error) {
+	origin := data[0]
+	target, err := strconv.ParseComplex(origin, 128)
+	if err != nil {
+		return nil, newConversionError(reflect.TypeOf(complex128(0)), origin, err)
+	}
+	return target, nil
+}
+
+// ConvertToBytes converts the base64 encoded first element in []string
+// to []byte.
+func ConvertToBytes(_ context.Context, data []string) (interface{}, error) {
+	origin := data[0]
+	target, err := base64.StdEncoding.DecodeString(origin)
+	if err != nil {
+		return nil, newConversionError(reflect.TypeOf([]byte{}), origin, err)
+	}
+	return target, nil
+}
+
+// ConvertToTime converts the first element in []string to time.Time with
+// layout time.RFC3339, the fractional second is optional.
+func ConvertToTime(_ context.Context, data []string) (interface{}, error) {
+	origin := data[0]
+	target, err := time.Parse(time.RFC3339Nano, origin)
+	if err != nil {
+		return nil, newConversionError(reflect.TypeOf(time.Time{}), origin, err)
 	}
 	return target, nil
 }
@@ -166,31 +236,92 @@ func ConvertToString(_ context.Context, data []string) (interface{}, error) {
 
 // ConvertToTimeDuration return the first element in []string as time.Duration
 func ConvertToTimeDuration(_ context.Context, data []string) (interface{}, error) {
-	return time.ParseDuration(data[0])
+	origin := data[0]
+	target, err := time.ParseDuration(origin)
+	if err != nil {
+		return nil, newConversionError(reflect.TypeOf(time.Duration(0)), origin, err)
+	}
+	return target, nil
 }
 
-// ConvertTo return data to typ
-// nolint
+const (
+	// mapItemSeparator is the separator between map items, such as 'k1=v1;k2=v2'
+	mapItemSeparator = ";"
+
+	// mapKeySeparator is the separator between key and value of map item
+	mapKeySeparator = "="
+
+	// listSeparator is the separator between slice or array elements when
+	// format them to string
+	listSeparator = ","
+)
+
+// ConvertTo return data to typ, the registered Converter (see RegisterConverter)
+// and encoding.TextUnmarshaler is used before the builtin conversions. The
+// error is always *ConversionError, the Index is set if it's failed at an
+// element of slice or array.
 func ConvertTo(ctx context.Context, typ reflect.Type, data []string) (interface{}, error) {
-	// NOTE: we must check the typ first, otherwise if the type is time.Duration
-	// the kind will be reflect.Int64
-	switch {
-	case typ == reflect.TypeOf(time.Duration(0)):
-		return ConvertToTimeDuration(ctx, data)
+	v, err := convertTo(ctx, typ, data)
+	if err == nil {
+		return v, nil
+	}
+
+	ce := toConversionError(typ, strings.Join(data, listSeparator), err)
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Ptr:
+	default:
+		// Report the named type instead of it's kind, such as 'type Port int'
+		ce.Type = typ
+	}
+	return nil, ce
+}
+
+// nolint
+func convertTo(ctx context.Context, typ reflect.Type, data []string) (interface{}, error) {
+	// NOTE: we must check the registry first, otherwise if the type is time.Duration
+	// the kind will be reflect.Int64, and net.IP will be reflect.Slice
+	if v, ok, err := convertByRegistry(ctx, typ, data); ok {
+		return v, err
 	}
 
 	switch typ.Kind() {
 	case reflect.Slice:
 		ret := reflect.MakeSlice(typ, 0, len(data))
-		for _, v := range data {
+		for idx, v := range data {
+			i, err := ConvertTo(ctx, typ.Elem(), []string{v})
+			if err != nil {
+				return nil, elementError(err, idx)
+			}
+
+			ret = reflect.Append(ret, reflect.ValueOf(i).Convert(typ.Elem()))
+		}
+		return ret.Interface(), nil
+	case reflect.Array:
+		if len(data) > typ.Len() {
+			return nil, xerrors.Errorf("%d elements exceed the array length %d", len(data), typ.Len())
+		}
+
+		ret := reflect.New(typ).Elem()
+		for idx, v := range data {
 			i, err := ConvertTo(ctx, typ.Elem(), []string{v})
 			if err != nil {
-				return nil, err
+				return nil, elementError(err, idx)
 			}
 
-			ret = reflect.Append(ret, reflect.ValueOf(i))
+			ret.Index(idx).Set(reflect.ValueOf(i).Convert(typ.Elem()))
 		}
 		return ret.Interface(), nil
+	case reflect.Map:
+		return convertToMap(ctx, typ, data[0])
+	case reflect.Ptr:
+		e, err := ConvertTo(ctx, typ.Elem(), data)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := reflect.New(typ.Elem())
+		ret.Elem().Set(reflect.ValueOf(e).Convert(typ.Elem()))
+		return ret.Interface(), nil
 	case reflect.Bool:
 		return ConvertToBool(ctx, data)
 	case reflect.Int:
@@ -217,6 +348,10 @@ func ConvertTo(ctx context.Context, typ reflect.Type, data []string) (interface{
 		return ConvertToFloat32(ctx, data)
 	case reflect.Float64:
 		return ConvertToFloat64(ctx, data)
+	case reflect.Complex64:
+		return ConvertToComplex64(ctx, data)
+	case reflect.Complex128:
+		return ConvertToComplex128(ctx, data)
 	case reflect.String:
 		return ConvertToString(ctx, data)
 	}
@@ -224,7 +359,46 @@ func ConvertTo(ctx context.Context, typ reflect.Type, data []string) (interface{
 	return nil, xerrors.Errorf("Unsupport target type %s", typ.String())
 }
 
-// ToString convert i to string
+// elementError will set the index of element to err.
+func elementError(err error, idx int) error {
+	var ce *ConversionError
+	if xerrors.As(err, &ce) && ce.Index < 0 && ce.Key == "" {
+		ce.Index = idx
+	}
+	return err
+}
+
+// convertToMap will convert the s in format 'k1=v1;k2=v2' to map typ, the
+// empty s is converted to empty map.
+func convertToMap(ctx context.Context, typ reflect.Type, s string) (interface{}, error) {
+	ret := reflect.MakeMap(typ)
+	if s == "" {
+		return ret.Interface(), nil
+	}
+
+	for _, item := range strings.Split(s, mapItemSeparator) {
+		k, v, ok := strings.Cut(item, mapKeySeparator)
+		if !ok {
+			return nil, xerrors.Errorf("item '%s' must be key%svalue", item, mapKeySeparator)
+		}
+
+		kv, err := ConvertTo(ctx, typ.Key(), []string{k})
+		if err != nil {
+			return nil, err
+		}
+		vv, err := ConvertTo(ctx, typ.Elem(), []string{v})
+		if err != nil {
+			return nil, toConversionError(typ.Elem(), v, err).WithKey(k)
+		}
+		ret.SetMapIndex(reflect.ValueOf(kv).Convert(typ.Key()), reflect.ValueOf(vv).Convert(typ.Elem()))
+	}
+	return ret.Interface(), nil
+}
+
+// ToString convert i to string, the registered Formatter (see RegisterFormatter)
+// and encoding.TextMarshaler is used if the type is not builtin. It's the
+// reverse of ConvertTo: the map is formatted as 'k1=v1;k2=v2' sorted by key,
+// the slice and array is joined by ',', and the pointer is dereferenced.
 // nolint
 func ToString(i interface{}) (string, error) {
 	switch s := i.(type) {
@@ -256,9 +430,59 @@ func ToString(i interface{}) (string, error) {
 		return strconv.FormatUint(uint64(s), 10), nil
 	case uint8:
 		return strconv.FormatUint(uint64(s), 10), nil
-	case time.Duration:
-		return s.String(), nil
+	case complex64:
+		return strconv.FormatComplex(complex128(s), 'f', -1, 64), nil
+	case complex128:
+		return strconv.FormatComplex(s, 'f', -1, 128), nil
 	}
 
+	if s, ok, err := formatByRegistry(i); ok {
+		return s, err
+	}
+	if s, ok, err := formatComposite(reflect.ValueOf(i)); ok {
+		return s, err
+	}
 	return "", xerrors.Errorf("Unsupport target type '%T'", i)
 }
+
+// formatComposite will format the pointer, map, slice and array v to string,
+// the bool is false if it's not supported.
+// nolint
+func formatComposite(v reflect.Value) (string, bool, error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "", true, xerrors.Errorf("Cann't convert nil pointer of type '%s' to string", v.Type().String())
+		}
+
+		s, err := ToString(v.Elem().Interface())
+		return s, true, err
+	case reflect.Map:
+		items := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			ks, err := ToString(k.Interface())
+			if err != nil {
+				return "", true, err
+			}
+			vs, err := ToString(v.MapIndex(k).Interface())
+			if err != nil {
+				return "", true, err
+			}
+			items = append(items, ks+mapKeySeparator+vs)
+		}
+		sort.Strings(items)
+		return strings.Join(items, mapItemSeparator), true, nil
+	case reflect.Slice, reflect.Array:
+		items := make([]string, 0, v.Len())
+		for idx := 0; idx < v.Len(); idx++ {
+			s, err := ToString(v.Index(idx).Interface())
+			if err != nil {
+				return "", true, err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, listSeparator), true, nil
+	}
+
+	return "", false, nil
+}
@@ -46,7 +46,7 @@ func TestConvertToBool(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type bool",
+			err:    `"true1" is not a bool`,
 		},
 	}
 	for _, tc := range testCases {
@@ -85,7 +85,7 @@ func TestConvertToUint(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type uint",
+			err:    `"true1" is not a uint`,
 		},
 	}
 	for _, tc := range testCases {
@@ -124,7 +124,7 @@ func TestConvertToUint8(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type uint8",
+			err:    `"true1" is not a uint8`,
 		},
 	}
 	for _, tc := range testCases {
@@ -163,7 +163,7 @@ func TestConvertToUint16(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type uint16",
+			err:    `"true1" is not a uint16`,
 		},
 	}
 	for _, tc := range testCases {
@@ -202,7 +202,7 @@ func TestConvertToUint32(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type uint32",
+			err:    `"true1" is not a uint32`,
 		},
 	}
 	for _, tc := range testCases {
@@ -241,7 +241,7 @@ func TestConvertToUint64(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type uint64",
+			err:    `"true1" is not a uint64`,
 		},
 	}
 	for _, tc := range testCases {
@@ -276,11 +276,41 @@ func TestConvertToInt(t *testing.T) {
 			expect: int(1),
 			err:    "",
 		},
+		{
+			desp:   "hex with underscores",
+			data:   []string{"0xFF_FF"},
+			expect: int(65535),
+			err:    "",
+		},
+		{
+			desp:   "negative octal",
+			data:   []string{"-0o17"},
+			expect: int(-15),
+			err:    "",
+		},
+		{
+			desp:   "binary",
+			data:   []string{"0b101"},
+			expect: int(5),
+			err:    "",
+		},
+		{
+			desp:   "leading zero is decimal",
+			data:   []string{"010"},
+			expect: int(10),
+			err:    "",
+		},
+		{
+			desp:   "decimal with underscores",
+			data:   []string{"1_000"},
+			expect: int(1000),
+			err:    "",
+		},
 		{
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type int",
+			err:    `"true1" is not an int`,
 		},
 	}
 	for _, tc := range testCases {
@@ -319,7 +349,7 @@ func TestConvertToInt8(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type int8",
+			err:    `"true1" is not an int8`,
 		},
 	}
 	for _, tc := range testCases {
@@ -358,7 +388,7 @@ func TestConvertToInt16(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type int16",
+			err:    `"true1" is not an int16`,
 		},
 	}
 	for _, tc := range testCases {
@@ -397,7 +427,7 @@ func TestConvertToInt32(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type int32",
+			err:    `"true1" is not an int32`,
 		},
 	}
 	for _, tc := range testCases {
@@ -436,7 +466,7 @@ func TestConvertToInt64(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type int64",
+			err:    `"true1" is not an int64`,
 		},
 	}
 	for _, tc := range testCases {
@@ -475,7 +505,7 @@ func TestConvertToFloat32(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type float32",
+			err:    `"true1" is not a float32`,
 		},
 	}
 	for _, tc := range testCases {
@@ -514,7 +544,7 @@ func TestConvertToFloat64(t *testing.T) {
 			desp:   "convert failed",
 			data:   []string{"true1"},
 			expect: true,
-			err:    "Cann't convert true1 to type float64",
+			err:    `"true1" is not a float64`,
 		},
 	}
 	for _, tc := range testCases {
@@ -730,7 +760,112 @@ func TestConvertTo(t *testing.T) {
 			data:   []string{"true"},
 			typ:    reflect.TypeOf([]int{}),
 			expect: []int{},
-			err:    "Cann't convert true to type int",
+			err:    `"true" is not an int`,
+		},
+		{
+			desp:   "hex uint8",
+			data:   []string{"0x7f"},
+			typ:    reflect.TypeOf(uint8(0)),
+			expect: uint8(127),
+			err:    "",
+		},
+		{
+			desp:   "complex128",
+			data:   []string{"1+2i"},
+			typ:    reflect.TypeOf(complex128(0)),
+			expect: complex(1, 2),
+			err:    "",
+		},
+		{
+			desp:   "complex64",
+			data:   []string{"1.5-2i"},
+			typ:    reflect.TypeOf(complex64(0)),
+			expect: complex64(complex(1.5, -2)),
+			err:    "",
+		},
+		{
+			desp:   "time",
+			data:   []string{"2023-01-02T03:04:05.5+08:00"},
+			typ:    reflect.TypeOf(time.Time{}),
+			expect: time.Date(2023, 1, 2, 3, 4, 5, 5e8, time.FixedZone("", 8*3600)),
+			err:    "",
+		},
+		{
+			desp:   "invalid time",
+			data:   []string{"2023-01-02"},
+			typ:    reflect.TypeOf(time.Time{}),
+			expect: nil,
+			err:    `"2023-01-02" is not a time.Time`,
+		},
+		{
+			desp:   "base64 bytes",
+			data:   []string{"aGVsbG8="},
+			typ:    reflect.TypeOf([]byte{}),
+			expect: []byte("hello"),
+			err:    "",
+		},
+		{
+			desp:   "invalid base64 bytes",
+			data:   []string{"!!"},
+			typ:    reflect.TypeOf([]byte{}),
+			expect: nil,
+			err:    `"!!" is not a \[\]uint8: illegal base64 data`,
+		},
+		{
+			desp:   "map",
+			data:   []string{"a=1;b=0x10"},
+			typ:    reflect.TypeOf(map[string]int{}),
+			expect: map[string]int{"a": 1, "b": 16},
+			err:    "",
+		},
+		{
+			desp:   "empty map",
+			data:   []string{""},
+			typ:    reflect.TypeOf(map[string]int{}),
+			expect: map[string]int{},
+			err:    "",
+		},
+		{
+			desp:   "invalid map item",
+			data:   []string{"a=1;b"},
+			typ:    reflect.TypeOf(map[string]int{}),
+			expect: nil,
+			err:    "item 'b' must be key=value",
+		},
+		{
+			desp:   "invalid map value",
+			data:   []string{"a=x"},
+			typ:    reflect.TypeOf(map[string]int{}),
+			expect: nil,
+			err:    `a: "x" is not an int`,
+		},
+		{
+			desp:   "array",
+			data:   []string{"1", "2"},
+			typ:    reflect.TypeOf([3]int{}),
+			expect: [3]int{1, 2, 0},
+			err:    "",
+		},
+		{
+			desp:   "array overflow",
+			data:   []string{"1", "2"},
+			typ:    reflect.TypeOf([1]int{}),
+			expect: nil,
+			err:    `"1,2" is not a \[1\]int: 2 elements exceed the array length 1`,
+		},
+		{
+			desp:   "pointer",
+			data:   []string{"1"},
+			typ:    reflect.TypeOf((*int)(nil)),
+			expect: func() *int { i := 1; return &i }(),
+			err:    "",
+		},
+		{
+			desp:   "slice of pointer",
+			data:   []string{"a"},
+			typ:    reflect.TypeOf([]*string{}),
+			expect: func() []*string { s := "a"; return []*string{&s} }(),
+			err:    "",
 		},
 		{
 			desp:   "unsupport type",
@@ -855,6 +990,54 @@ func TestToString(t *testing.T) {
 			expect: "1s",
 			err:    "",
 		},
+		{
+			desp:   "normal complex128",
+			i:      complex(1, -2),
+			expect: "(1-2i)",
+			err:    "",
+		},
+		{
+			desp:   "normal time",
+			i:      time.Date(2023, 1, 2, 3, 4, 5, 5e8, time.UTC),
+			expect: "2023-01-02T03:04:05.5Z",
+			err:    "",
+		},
+		{
+			desp:   "normal bytes",
+			i:      []byte("hello"),
+			expect: "aGVsbG8=",
+			err:    "",
+		},
+		{
+			desp:   "normal map",
+			i:      map[string]int{"b": 2, "a": 1},
+			expect: "a=1;b=2",
+			err:    "",
+		},
+		{
+			desp:   "normal array",
+			i:      [2]int{1, 2},
+			expect: "1,2",
+			err:    "",
+		},
+		{
+			desp:   "normal pointer",
+			i:      func() *int { i := 1; return &i }(),
+			expect: "1",
+			err:    "",
+		},
+		{
+			desp:   "nil pointer",
+			i:      (*int)(nil),
+			expect: "",
+			err:    "Cann't convert nil pointer of type '\\*int' to string",
+		},
+		{
+			desp:   "unsupport element type",
+			i:      []testing.T{{}},
+			expect: "",
+			err:    "Unsupport target type 'testing.T'",
+		},
 		{
 			desp:   "unsupport type",
 			i:      testing.T{},
@@ -0,0 +1,138 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conv
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// ConversionError is the error when convert the input to target type, such
+// as 'server.port[1]: "abc" is not an int'. It can been matched by xerrors.As.
+type ConversionError struct {
+	// Key is the optional key path of input, such as 'server.port', it's
+	// populated by the caller which know it.
+	Key string
+
+	// Type is the target type
+	Type reflect.Type
+
+	// Input is the string which failed to convert
+	Input string
+
+	// Index is the index of input within the slice or array, it's -1 if
+	// the input is not an element.
+	Index int
+
+	// Err is the underlying error
+	Err error
+}
+
+// newConversionError will return the ConversionError of input to typ.
+func newConversionError(typ reflect.Type, input string, err error) *ConversionError {
+	return &ConversionError{
+		Type:  typ,
+		Input: input,
+		Index: -1,
+		Err:   err,
+	}
+}
+
+// toConversionError will wrap err as ConversionError if it's not.
+func toConversionError(typ reflect.Type, input string, err error) *ConversionError {
+	var ce *ConversionError
+	if xerrors.As(err, &ce) {
+		return ce
+	}
+
+	return newConversionError(typ, input, err)
+}
+
+// Path return the key path with the index, such as 'server.port[1]'.
+func (e *ConversionError) Path() string {
+	if e.Index < 0 {
+		return e.Key
+	}
+
+	return fmt.Sprintf("%s[%d]", e.Key, e.Index)
+}
+
+// WithKey will prepend the key to the key path, the '.' is used as separator
+// if the key path is not empty and not start with index. It return e for
+// convenience.
+func (e *ConversionError) WithKey(key string) *ConversionError {
+	switch {
+	case e.Key == "":
+		e.Key = key
+	case key != "" && !strings.HasPrefix(e.Key, "["):
+		e.Key = key + "." + e.Key
+	default:
+		e.Key = key + e.Key
+	}
+	return e
+}
+
+// article return the indefinite article of name by it's pronunciation, such
+// as 'an int', 'a uint' and 'an unsafe.Pointer'.
+func article(name string) string {
+	name = strings.ToLower(name)
+	for _, prefix := range []string{"uint", "url", "uuid", "uni", "use"} {
+		// The 'u' is pronounced as 'you'
+		if strings.HasPrefix(name, prefix) {
+			return "a"
+		}
+	}
+
+	if name != "" && strings.ContainsAny(name[:1], "aeiou") {
+		return "an"
+	}
+	return "a"
+}
+
+func (e *ConversionError) Error() string {
+	name := "<nil>"
+	if e.Type != nil {
+		name = e.Type.String()
+	}
+	msg := fmt.Sprintf("%q is not %s %s", e.Input, article(name), name)
+	if path := e.Path(); path != "" {
+		msg = path + ": " + msg
+	}
+
+	var ne *strconv.NumError
+	switch {
+	case e.Err == nil:
+		return msg
+	case xerrors.As(e.Err, &ne):
+		if ne.Err == strconv.ErrSyntax {
+			return msg
+		}
+		return msg + ": " + ne.Err.Error()
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
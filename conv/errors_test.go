@@ -0,0 +1,177 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conv
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"testing"
+	"unsafe"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testPort int
+
+func TestConversionError(t *testing.T) {
+	type testCase struct {
+		desp   string
+		typ    reflect.Type
+		data   []string
+		key    string
+		expect *ConversionError
+		msg    string
+	}
+	testCases := []testCase{
+		{
+			desp: "scalar",
+			typ:  reflect.TypeOf(0),
+			data: []string{"abc"},
+			key:  "server.port",
+			expect: &ConversionError{
+				Key:   "server.port",
+				Type:  reflect.TypeOf(0),
+				Input: "abc",
+				Index: -1,
+			},
+			msg: `server.port: "abc" is not an int`,
+		},
+		{
+			desp: "named type",
+			typ:  reflect.TypeOf(testPort(0)),
+			data: []string{"abc"},
+			expect: &ConversionError{
+				Type:  reflect.TypeOf(testPort(0)),
+				Input: "abc",
+				Index: -1,
+			},
+			msg: `"abc" is not a conv.testPort`,
+		},
+		{
+			desp: "element of slice",
+			typ:  reflect.TypeOf([]int{}),
+			data: []string{"1", "abc"},
+			key:  "server.port",
+			expect: &ConversionError{
+				Key:   "server.port",
+				Type:  reflect.TypeOf(0),
+				Input: "abc",
+				Index: 1,
+			},
+			msg: `server.port[1]: "abc" is not an int`,
+		},
+		{
+			desp: "out of range",
+			typ:  reflect.TypeOf(int8(0)),
+			data: []string{"0x100"},
+			expect: &ConversionError{
+				Type:  reflect.TypeOf(int8(0)),
+				Input: "0x100",
+				Index: -1,
+			},
+			msg: `"0x100" is not an int8: value out of range`,
+		},
+		{
+			desp: "value of map",
+			typ:  reflect.TypeOf(map[string]int{}),
+			data: []string{"a=1;b=x"},
+			key:  "labels",
+			expect: &ConversionError{
+				Key:   "labels.b",
+				Type:  reflect.TypeOf(0),
+				Input: "x",
+				Index: -1,
+			},
+			msg: `labels.b: "x" is not an int`,
+		},
+		{
+			desp: "unsupported type",
+			typ:  reflect.TypeOf(struct{}{}),
+			data: []string{"x"},
+			expect: &ConversionError{
+				Type:  reflect.TypeOf(struct{}{}),
+				Input: "x",
+				Index: -1,
+			},
+			msg: `"x" is not a struct {}: Unsupport target type struct {}`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := ConvertTo(context.Background(), tc.typ, tc.data)
+			g.Expect(err).To(HaveOccurred())
+
+			var ce *ConversionError
+			g.Expect(xerrors.As(err, &ce)).To(BeTrue())
+			if tc.key != "" {
+				ce.WithKey(tc.key)
+			}
+			g.Expect(err.Error()).To(Equal(tc.msg))
+
+			ce.Err = nil
+			g.Expect(ce).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestConversionErrorWithKey(t *testing.T) {
+	g := NewWithT(t)
+
+	e := newConversionError(reflect.TypeOf(0), "x", strconv.ErrSyntax)
+	g.Expect(e.WithKey("").Path()).To(Equal(""))
+	g.Expect(e.WithKey("b").Path()).To(Equal("b"))
+	g.Expect(e.WithKey("a").Path()).To(Equal("a.b"))
+
+	e = newConversionError(reflect.TypeOf(0), "x", strconv.ErrSyntax)
+	e.Key, e.Index = "[0]", 2
+	g.Expect(e.WithKey("a").Path()).To(Equal("a[0][2]"))
+	g.Expect(xerrors.Is(e, strconv.ErrSyntax)).To(BeTrue())
+}
+
+func TestConversionErrorArticle(t *testing.T) {
+	type testCase struct {
+		desp string
+		typ  reflect.Type
+		msg  string
+	}
+	testCases := []testCase{
+		{desp: "int", typ: reflect.TypeOf(0), msg: `"x" is not an int`},
+		{desp: "uint", typ: reflect.TypeOf(uint(0)), msg: `"x" is not a uint`},
+		{desp: "uint64", typ: reflect.TypeOf(uint64(0)), msg: `"x" is not a uint64`},
+		{desp: "uintptr", typ: reflect.TypeOf(uintptr(0)), msg: `"x" is not a uintptr`},
+		{desp: "unsafe pointer", typ: reflect.TypeOf(unsafe.Pointer(nil)), msg: `"x" is not an unsafe.Pointer`},
+		{desp: "error", typ: reflect.TypeOf((*error)(nil)).Elem(), msg: `"x" is not an error`},
+		{desp: "bool", typ: reflect.TypeOf(true), msg: `"x" is not a bool`},
+		{desp: "nil type", typ: nil, msg: `"x" is not a <nil>`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			err := newConversionError(tc.typ, "x", nil)
+			g.Expect(err.Error()).To(Equal(tc.msg))
+		})
+	}
+}
@@ -0,0 +1,286 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conv
+
+import (
+	"context"
+	"encoding"
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// Converter will convert the data to the registered type, only the first
+// data is used for scalar types.
+type Converter func(ctx context.Context, data []string) (interface{}, error)
+
+// Formatter will convert the value of registered type to string, it's the
+// reverse of Converter.
+type Formatter func(v interface{}) (string, error)
+
+// converterRegistry is the registry of Converter and Formatter by type.
+type converterRegistry struct {
+	mu         sync.RWMutex
+	converters map[reflect.Type]Converter
+	formatters map[reflect.Type]Formatter
+}
+
+func newConverterRegistry() *converterRegistry {
+	return &converterRegistry{
+		converters: map[reflect.Type]Converter{},
+		formatters: map[reflect.Type]Formatter{},
+	}
+}
+
+// RegisterConverter will register the Converter for typ.
+func (r *converterRegistry) RegisterConverter(typ reflect.Type, c Converter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.converters[typ]; ok {
+		return xerrors.WrapDuplicate("converter for type '%s'", typ.String())
+	}
+	r.converters[typ] = c
+	return nil
+}
+
+// RegisterFormatter will register the Formatter for typ.
+func (r *converterRegistry) RegisterFormatter(typ reflect.Type, f Formatter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.formatters[typ]; ok {
+		return xerrors.WrapDuplicate("formatter for type '%s'", typ.String())
+	}
+	r.formatters[typ] = f
+	return nil
+}
+
+// Converter return the Converter of typ.
+func (r *converterRegistry) Converter(typ reflect.Type) (Converter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if c, ok := r.converters[typ]; ok {
+		return c, true
+	}
+	c, ok := builtinConverters[typ]
+	return c, ok
+}
+
+// Formatter return the Formatter of typ.
+func (r *converterRegistry) Formatter(typ reflect.Type) (Formatter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if f, ok := r.formatters[typ]; ok {
+		return f, true
+	}
+	f, ok := builtinFormatters[typ]
+	return f, ok
+}
+
+var defaultConverterRegistry = newConverterRegistry()
+
+// RegisterConverter will register the Converter for typ, the ConvertTo
+// will use it before the builtin conversions, such as the TimeConverter
+// for time.Time with custom layout. The Converter of pointer
+// type is optional, the Converter of it's elem type is used if absent.
+func RegisterConverter(typ reflect.Type, c Converter) error {
+	return defaultConverterRegistry.RegisterConverter(typ, c)
+}
+
+// RegisterFormatter will register the Formatter for typ, the ToString will
+// use it before the builtin conversions.
+func RegisterFormatter(typ reflect.Type, f Formatter) error {
+	return defaultConverterRegistry.RegisterFormatter(typ, f)
+}
+
+// RegisterConverterFunc will register the fn as Converter of type T, and
+// the optional format as Formatter of it.
+func RegisterConverterFunc[T any](fn func(s string) (T, error), format func(v T) string) error {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	err := RegisterConverter(typ, func(_ context.Context, data []string) (interface{}, error) {
+		return fn(data[0])
+	})
+	if err != nil || format == nil {
+		return err
+	}
+
+	return RegisterFormatter(typ, func(v interface{}) (string, error) {
+		return format(v.(T)), nil
+	})
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// HasConverter return true if the typ is converted by registered Converter
+// or encoding.TextUnmarshaler instead of it's kind, such as time.Time and
+// net.IP. The caller should treat these types as scalar even it's a struct
+// or slice.
+func HasConverter(typ reflect.Type) bool {
+	if _, ok := defaultConverterRegistry.Converter(typ); ok {
+		return true
+	}
+
+	switch {
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return true
+	case typ.Kind() == reflect.Ptr:
+		return typ.Implements(textUnmarshalerType) || HasConverter(typ.Elem())
+	}
+	return false
+}
+
+// convertByRegistry will convert the data to typ by the registered Converter
+// or encoding.TextUnmarshaler, the bool is false if it's not supported.
+func convertByRegistry(ctx context.Context, typ reflect.Type, data []string) (interface{}, bool, error) {
+	if c, ok := defaultConverterRegistry.Converter(typ); ok {
+		v, err := c(ctx, data)
+		return v, true, err
+	}
+
+	switch {
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		v := reflect.New(typ)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(data[0])); err != nil {
+			return nil, true, newConversionError(typ, data[0], err)
+		}
+		return v.Elem().Interface(), true, nil
+	case typ.Kind() == reflect.Ptr && HasConverter(typ.Elem()):
+		e, _, err := convertByRegistry(ctx, typ.Elem(), data)
+		if err != nil {
+			return nil, true, err
+		}
+		v := reflect.New(typ.Elem())
+		v.Elem().Set(reflect.ValueOf(e).Convert(typ.Elem()))
+		return v.Interface(), true, nil
+	}
+
+	return nil, false, nil
+}
+
+// formatByRegistry will convert the i to string by the registered Formatter
+// or encoding.TextMarshaler, the bool is false if it's not supported.
+func formatByRegistry(i interface{}) (string, bool, error) {
+	v := reflect.ValueOf(i)
+	if !v.IsValid() {
+		return "", false, nil
+	}
+	if f, ok := defaultConverterRegistry.Formatter(v.Type()); ok {
+		s, err := f(i)
+		return s, true, err
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false, nil
+		}
+		if _, ok := defaultConverterRegistry.Formatter(v.Type().Elem()); ok {
+			return formatByRegistry(v.Elem().Interface())
+		}
+	}
+
+	m, ok := i.(encoding.TextMarshaler)
+	if !ok && v.Kind() != reflect.Ptr {
+		// The method maybe declared with pointer receiver, such as
+		// regexp.Regexp
+		pv := reflect.New(v.Type())
+		pv.Elem().Set(v)
+		m, ok = pv.Interface().(encoding.TextMarshaler)
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	data, err := m.MarshalText()
+	if err != nil {
+		return "", true, err
+	}
+	return string(data), true, nil
+}
+
+// TimeConverter will return the Converter of time.Time with layout, such
+// as time.RFC1123.
+func TimeConverter(layout string) Converter {
+	return func(_ context.Context, data []string) (interface{}, error) {
+		t, err := time.Parse(layout, data[0])
+		if err != nil {
+			return nil, newConversionError(reflect.TypeOf(time.Time{}), data[0], xerrors.Wrapf(err, "layout '%s'", layout))
+		}
+		return t, nil
+	}
+}
+
+// EnumConverter will return the Converter of string type T which only
+// accept the values.
+func EnumConverter[T ~string](values ...T) Converter {
+	return func(_ context.Context, data []string) (interface{}, error) {
+		for _, v := range values {
+			if string(v) == data[0] {
+				return v, nil
+			}
+		}
+
+		names := make([]string, 0, len(values))
+		for _, v := range values {
+			names = append(names, string(v))
+		}
+		return nil, newConversionError(reflect.TypeOf(*new(T)), data[0], xerrors.Errorf("must be one of [%s]", strings.Join(names, ", ")))
+	}
+}
+
+// builtinConverters is the Converter of types which is not decided by the
+// kind, the registered Converter will override it.
+var builtinConverters = map[reflect.Type]Converter{
+	reflect.TypeOf(time.Duration(0)): ConvertToTimeDuration,
+	reflect.TypeOf(time.Time{}):      ConvertToTime,
+	reflect.TypeOf([]byte{}):         ConvertToBytes,
+	reflect.TypeOf(url.URL{}): func(_ context.Context, data []string) (interface{}, error) {
+		u, err := url.Parse(data[0])
+		if err != nil {
+			return nil, newConversionError(reflect.TypeOf(url.URL{}), data[0], err)
+		}
+		return *u, nil
+	},
+}
+
+// builtinFormatters is the Formatter of types which is not builtin in
+// ToString, the registered Formatter will override it.
+var builtinFormatters = map[reflect.Type]Formatter{
+	reflect.TypeOf(time.Duration(0)): func(v interface{}) (string, error) {
+		return v.(time.Duration).String(), nil
+	},
+	reflect.TypeOf(time.Time{}): func(v interface{}) (string, error) {
+		return v.(time.Time).Format(time.RFC3339Nano), nil
+	},
+	reflect.TypeOf([]byte{}): func(v interface{}) (string, error) {
+		return base64.StdEncoding.EncodeToString(v.([]byte)), nil
+	},
+	reflect.TypeOf(url.URL{}): func(v interface{}) (string, error) {
+		u := v.(url.URL)
+		return u.String(), nil
+	},
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package conv
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+type testLevel string
+
+type testPoint struct {
+	X int
+	Y int
+}
+
+func init() {
+	_ = RegisterConverter(reflect.TypeOf(testLevel("")), EnumConverter[testLevel]("debug", "info"))
+	_ = RegisterConverterFunc(func(s string) (testPoint, error) {
+		var p testPoint
+		x, y, ok := strings.Cut(s, ",")
+		if !ok {
+			return p, xerrors.Errorf("invalid point '%s'", s)
+		}
+		v, err := ConvertTo(context.Background(), reflect.TypeOf([]int{}), []string{x, y})
+		if err != nil {
+			return p, err
+		}
+		p.X, p.Y = v.([]int)[0], v.([]int)[1]
+		return p, nil
+	}, func(p testPoint) string {
+		return strconv.Itoa(p.X) + "," + strconv.Itoa(p.Y)
+	})
+}
+
+func TestConvertToRegistry(t *testing.T) {
+	type testCase struct {
+		desp   string
+		typ    reflect.Type
+		data   []string
+		expect interface{}
+		err    string
+	}
+	testCases := []testCase{
+		{
+			desp:   "text unmarshaler slice",
+			typ:    reflect.TypeOf(net.IP{}),
+			data:   []string{"127.0.0.1"},
+			expect: net.ParseIP("127.0.0.1"),
+		},
+		{
+			desp:   "slice of text unmarshaler",
+			typ:    reflect.TypeOf([]net.IP{}),
+			data:   []string{"127.0.0.1", "::1"},
+			expect: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+		},
+		{
+			desp: "text unmarshaler failed",
+			typ:  reflect.TypeOf(net.IP{}),
+			data: []string{"1.2.3"},
+			err:  `"1.2.3" is not a net.IP`,
+		},
+		{
+			desp:   "text unmarshaler struct",
+			typ:    reflect.TypeOf(time.Time{}),
+			data:   []string{"2023-01-02T03:04:05Z"},
+			expect: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{
+			desp:   "pointer of text unmarshaler",
+			typ:    reflect.TypeOf(&regexp.Regexp{}),
+			data:   []string{"^a+$"},
+			expect: regexp.MustCompile("^a+$"),
+		},
+		{
+			desp:   "registered struct",
+			typ:    reflect.TypeOf(url.URL{}),
+			data:   []string{"http://localhost:8080/a"},
+			expect: url.URL{Scheme: "http", Host: "localhost:8080", Path: "/a"},
+		},
+		{
+			desp:   "pointer of registered struct",
+			typ:    reflect.TypeOf(&url.URL{}),
+			data:   []string{"http://localhost:8080/a"},
+			expect: &url.URL{Scheme: "http", Host: "localhost:8080", Path: "/a"},
+		},
+		{
+			desp:   "registered func",
+			typ:    reflect.TypeOf(testPoint{}),
+			data:   []string{"1,2"},
+			expect: testPoint{X: 1, Y: 2},
+		},
+		{
+			desp:   "enum",
+			typ:    reflect.TypeOf([]testLevel{}),
+			data:   []string{"debug", "info"},
+			expect: []testLevel{"debug", "info"},
+		},
+		{
+			desp: "invalid enum",
+			typ:  reflect.TypeOf(testLevel("")),
+			data: []string{"warn"},
+			err:  `"warn" is not a conv.testLevel: must be one of \[debug, info\]`,
+		},
+		{
+			desp:   "byte size",
+			typ:    reflect.TypeOf(ByteSize(0)),
+			data:   []string{"10MiB"},
+			expect: 10 * MiB,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(HasConverter(tc.typ) || tc.typ.Kind() == reflect.Slice).To(BeTrue())
+			actual, err := ConvertTo(context.Background(), tc.typ, tc.data)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).Should(MatchRegexp(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(actual).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestToStringRegistry(t *testing.T) {
+	type testCase struct {
+		desp   string
+		i      interface{}
+		expect string
+	}
+	testCases := []testCase{
+		{
+			desp:   "text marshaler",
+			i:      net.ParseIP("127.0.0.1"),
+			expect: "127.0.0.1",
+		},
+		{
+			desp:   "text marshaler struct",
+			i:      time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+			expect: "2023-01-02T03:04:05Z",
+		},
+		{
+			desp:   "pointer receiver text marshaler",
+			i:      *regexp.MustCompile("^a+$"),
+			expect: "^a+$",
+		},
+		{
+			desp:   "registered formatter",
+			i:      url.URL{Scheme: "http", Host: "localhost"},
+			expect: "http://localhost",
+		},
+		{
+			desp:   "pointer of registered formatter",
+			i:      &url.URL{Scheme: "http", Host: "localhost"},
+			expect: "http://localhost",
+		},
+		{
+			desp:   "registered func",
+			i:      testPoint{X: 1, Y: 2},
+			expect: "1,2",
+		},
+		{
+			desp:   "byte size",
+			i:      1536 * KiB,
+			expect: "1536KiB",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			actual, err := ToString(tc.i)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(actual).To(Equal(tc.expect))
+		})
+	}
+}
+
+func TestRegisterConverter(t *testing.T) {
+	g := NewWithT(t)
+
+	err := RegisterConverter(reflect.TypeOf(testLevel("")), EnumConverter[testLevel]("warn"))
+	g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+	err = RegisterFormatter(reflect.TypeOf(testPoint{}), nil)
+	g.Expect(xerrors.IsDuplicate(err)).To(BeTrue())
+
+	g.Expect(HasConverter(reflect.TypeOf(time.Duration(0)))).To(BeTrue())
+	g.Expect(HasConverter(reflect.TypeOf(&time.Time{}))).To(BeTrue())
+	g.Expect(HasConverter(reflect.TypeOf(struct{}{}))).To(BeFalse())
+	g.Expect(HasConverter(reflect.TypeOf(0))).To(BeFalse())
+
+	v, err := TimeConverter(time.RFC1123)(context.Background(), []string{"Mon, 02 Jan 2006 15:04:05 UTC"})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(v.(time.Time).Unix()).To(Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC).Unix()))
+	_, err = TimeConverter(time.RFC1123)(context.Background(), []string{"2006-01-02"})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestParseByteSize(t *testing.T) {
+	type testCase struct {
+		desp   string
+		s      string
+		expect ByteSize
+		err    string
+	}
+	testCases := []testCase{
+		{desp: "bytes", s: "512", expect: 512},
+		{desp: "binary unit", s: "10MiB", expect: 10 * MiB},
+		{desp: "decimal unit", s: "10mb", expect: 10 * MB},
+		{desp: "short unit", s: "2G", expect: 2 * GiB},
+		{desp: "fraction", s: "1.5 KiB", expect: 1536},
+		{desp: "unknown unit", s: "10XB", err: "unknown unit 'XB'"},
+		{desp: "invalid number", s: "1.2.3KB", err: `"1.2.3KB" is not a conv.ByteSize`},
+		{desp: "out of range", s: "100000PiB", err: "value out of range"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			actual, err := ParseByteSize(tc.s)
+			if tc.err != "" {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err.Error()).Should(ContainSubstring(tc.err))
+				return
+			}
+
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(actual).To(Equal(tc.expect))
+			g.Expect(ByteSize(1000).String()).To(Equal("1000B"))
+		})
+	}
+}
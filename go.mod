@@ -3,6 +3,7 @@ module github.com/lsytj0413/ena
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/agiledragon/gomonkey/v2 v2.9.0
 	github.com/golang/mock v1.6.0
 	github.com/onsi/gomega v1.27.5
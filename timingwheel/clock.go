@@ -0,0 +1,184 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the source of current time and timers for the Scheduler.
+type Clock interface {
+	// Now return the current time
+	Now() time.Time
+
+	// AfterFunc will call the Handler after the duration elapse.
+	AfterFunc(d time.Duration, f Handler) (TimerTask, error)
+}
+
+// wheelClock is the Clock implement by the TimingWheel
+type wheelClock struct {
+	tw TimingWheel
+}
+
+// NewWheelClock will return the Clock which timers is run by the TimingWheel.
+func NewWheelClock(tw TimingWheel) Clock {
+	return &wheelClock{
+		tw: tw,
+	}
+}
+
+func (c *wheelClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc will add the timer to TimingWheel, the TimingWheel fire the timer at the start
+// of it's tick which maybe up to one tick early, so the tick is added to the duration.
+func (c *wheelClock) AfterFunc(d time.Duration, f Handler) (TimerTask, error) {
+	if tw, ok := c.tw.(*timingWheel); ok && d > 0 {
+		d += time.Duration(tw.w.tick) * time.Millisecond
+	}
+	return c.tw.AfterFunc(d, f)
+}
+
+// ManualClock is the deterministic Clock for test usage, the time is only changed by
+// Advance or Set, and the timers is fired in the goroutine which call them.
+type ManualClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*manualTimer
+}
+
+// manualTimer is the timer of ManualClock
+type manualTimer struct {
+	c   *ManualClock
+	at  time.Time
+	seq uint64
+	f   Handler
+
+	// stopped is true when the timer is stopped
+	stopped bool
+}
+
+// NewManualClock will return the ManualClock start at now.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{
+		now: now,
+	}
+}
+
+// Now return the current time of clock
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// AfterFunc will add the timer which fired after the duration elapse, the timer
+// with non-positive duration will be fired at the next Advance or Set.
+func (c *ManualClock) AfterFunc(d time.Duration, f Handler) (TimerTask, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.seq++
+	t := &manualTimer{
+		c:   c,
+		at:  c.now.Add(d),
+		seq: c.seq,
+		f:   f,
+	}
+	c.timers = append(c.timers, t)
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		if !c.timers[i].at.Equal(c.timers[j].at) {
+			return c.timers[i].at.Before(c.timers[j].at)
+		}
+		return c.timers[i].seq < c.timers[j].seq
+	})
+	return t, nil
+}
+
+// Advance will move the clock forward by the duration, see Set.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set will move the clock to the time, and fire the expired timers in order, the clock
+// will not go backward. The clock's time is set to the timer's time when fired, so the
+// timer add by the Handler will be fired too if it's expired.
+func (c *ManualClock) Set(now time.Time) {
+	for {
+		t := c.expired(now)
+		if t == nil {
+			return
+		}
+		t.f(t.at)
+	}
+}
+
+// Pending return the count of timers waiting for fire
+func (c *ManualClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// expired will remove and return the first timer expired before now, or move the
+// clock to now if there is no expired timer.
+func (c *ManualClock) expired(now time.Time) *manualTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.timers) == 0 || c.timers[0].at.After(now) {
+		if now.After(c.now) {
+			c.now = now
+		}
+		return nil
+	}
+
+	t := c.timers[0]
+	c.timers = c.timers[1:]
+	if t.at.After(c.now) {
+		c.now = t.at
+	}
+	return t
+}
+
+// Stop the timer, return true if the timer is stopped success, or false if the timer
+// has already fired.
+func (t *manualTimer) Stop() (bool, error) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+
+	if t.stopped {
+		return true, nil
+	}
+	for i, v := range t.c.timers {
+		if v == t {
+			t.c.timers = append(t.c.timers[:i], t.c.timers[i+1:]...)
+			t.stopped = true
+			return true, nil
+		}
+	}
+	return false, nil
+}
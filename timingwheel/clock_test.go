@@ -0,0 +1,94 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestManualClock(t *testing.T) {
+	g := NewWithT(t)
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewManualClock(start)
+
+	fired := []time.Time{}
+	record := func(ct time.Time) {
+		fired = append(fired, ct)
+	}
+
+	_, err := c.AfterFunc(time.Second, record)
+	g.Expect(err).ToNot(HaveOccurred())
+	t3, err := c.AfterFunc(3*time.Second, record)
+	g.Expect(err).ToNot(HaveOccurred())
+	_, err = c.AfterFunc(2*time.Second, func(ct time.Time) {
+		record(ct)
+
+		// the timer add by Handler will be fired if expired
+		_, err := c.AfterFunc(500*time.Millisecond, record)
+		g.Expect(err).ToNot(HaveOccurred())
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(c.Pending()).To(Equal(3))
+
+	c.Advance(3 * time.Second)
+	g.Expect(c.Now()).To(Equal(start.Add(3 * time.Second)))
+	g.Expect(fired).To(Equal([]time.Time{
+		start.Add(time.Second),
+		start.Add(2 * time.Second),
+		start.Add(2500 * time.Millisecond),
+		start.Add(3 * time.Second),
+	}))
+	g.Expect(t3.Stop()).To(BeFalse())
+	g.Expect(c.Pending()).To(Equal(0))
+
+	t4, err := c.AfterFunc(time.Second, record)
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Expect(t4.Stop()).To(BeTrue())
+	g.Expect(t4.Stop()).To(BeTrue())
+	c.Advance(time.Hour)
+	g.Expect(fired).To(HaveLen(4))
+
+	// the clock will not go backward
+	c.Set(start)
+	g.Expect(c.Now()).To(Equal(start.Add(time.Hour + 3*time.Second)))
+}
+
+func TestWheelClock(t *testing.T) {
+	g := NewWithT(t)
+
+	tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20))
+	g.Expect(err).ToNot(HaveOccurred())
+	tw.Start()
+	defer tw.Stop()
+
+	c := NewWheelClock(tw)
+	now := time.Now()
+	g.Expect(c.Now()).To(BeTemporally("~", now, time.Second))
+
+	ch := make(chan time.Time, 1)
+	_, err = c.AfterFunc(5*time.Millisecond, func(ct time.Time) {
+		ch <- ct
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+	g.Eventually(ch).Should(Receive(BeTemporally(">=", now.Add(4*time.Millisecond))))
+}
@@ -30,6 +30,30 @@ var (
 
 	// ErrInvalidTickFuncDurationValue is representation error of invalid tickfunc duration
 	ErrInvalidTickFuncDurationValue = fmt.Errorf("tickfunc duration must greater than or equal to timingwheel tick")
+
+	// ErrStopped is representation error of the timingwheel has been stopped
+	ErrStopped = fmt.Errorf("timingwheel has been stopped")
+
+	// ErrInvalidCronSpec is representation error of invalid cron spec
+	ErrInvalidCronSpec = fmt.Errorf("invalid cron spec")
+
+	// ErrNoScheduleTime is representation error of the Schedule has no fire time
+	ErrNoScheduleTime = fmt.Errorf("schedule has no fire time")
+
+	// ErrInvalidScheduleJitter is representation error of invalid schedule jitter value
+	ErrInvalidScheduleJitter = fmt.Errorf("schedule jitter must greater than or equal to zero")
+
+	// ErrExecutorClosed is representation error of the Handler is dropped because the executor is closed
+	ErrExecutorClosed = fmt.Errorf("executor has been closed")
+
+	// ErrExecutorOverflow is representation error of the Handler is dropped because the executor queue is full
+	ErrExecutorOverflow = fmt.Errorf("executor queue is full")
+
+	// ErrInvalidPoolWorkers is representation error of invalid pool workers value
+	ErrInvalidPoolWorkers = fmt.Errorf("pool workers must greater than zero")
+
+	// ErrInvalidPoolQueueSize is representation error of invalid pool queue size value
+	ErrInvalidPoolQueueSize = fmt.Errorf("pool queue size must greater than or equal to zero")
 )
 
 // eventType is the representation of event, such as AddNew, RePost
@@ -41,6 +65,9 @@ var eventAddNew eventType = "AddNew"
 // eventDelete is the identify when timertask.Stop is called
 var eventDelete eventType = "Delete"
 
+// eventShutdown is the identify when timingwheel.Shutdown is called
+var eventShutdown eventType = "Shutdown"
+
 // timerTaskType is the representation of timertask
 type timerTaskType = string
 
@@ -0,0 +1,302 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// Schedule is the calendar to compute the fire time.
+type Schedule interface {
+	// Next will return the next fire time after the t, the zero time means there is no
+	// more fire time. The time is computed in the location of t.
+	Next(t time.Time) time.Time
+}
+
+// ScheduleFunc is an adapter to allow the use of function as Schedule.
+type ScheduleFunc func(t time.Time) time.Time
+
+// Next will call fn(t)
+func (fn ScheduleFunc) Next(t time.Time) time.Time {
+	return fn(t)
+}
+
+// cronBits is the bitset of allowed values in cron field
+type cronBits uint64
+
+func (b cronBits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+// cronField is the definition of field in cron spec
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	monthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	weekNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+
+	// cronFields is the fields of cron spec with seconds, the day of week 7 is Sunday too
+	cronFields = []cronField{
+		{name: "second", min: 0, max: 59},
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: monthNames},
+		{name: "day of week", min: 0, max: 7, names: weekNames},
+	}
+
+	// cronDescriptors is the predefined cron spec
+	cronDescriptors = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// cronSearchYears is the max years to search the next fire time
+const cronSearchYears = 5
+
+// cronSchedule is the implement of Schedule by cron spec
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow cronBits
+
+	// domStar and dowStar is true when the field is '*' or '?', if both of them is
+	// restricted, the day matches either of them.
+	domStar, dowStar bool
+}
+
+// ParseCron will parse the cron spec to Schedule, the spec is one of:
+//  1. 5 fields: minute hour day-of-month month day-of-week, such as '*/5 * * * *'
+//  2. 6 fields: second minute hour day-of-month month day-of-week, such as '30 */5 * * * *'
+//  3. descriptors: @yearly(@annually), @monthly, @weekly, @daily(@midnight), @hourly
+//
+// Every field support '*', '?', list 'a,b', range 'a-b' and step '*/n', 'a-b/n' or 'a/n',
+// the month and day of week support names such as 'JAN' and 'MON'.
+func ParseCron(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := cronDescriptors[strings.ToLower(spec)]; ok {
+		spec = d
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case len(cronFields) - 1:
+		fields = append([]string{"0"}, fields...)
+	case len(cronFields):
+	default:
+		return nil, xerrors.Wrapf(ErrInvalidCronSpec, "expect 5 or 6 fields in '%s', got %d", spec, len(fields))
+	}
+
+	bits := make([]cronBits, len(fields))
+	stars := make([]bool, len(fields))
+	for i, expr := range fields {
+		b, star, err := parseCronField(expr, cronFields[i])
+		if err != nil {
+			return nil, xerrors.Wrapf(err, "parse cron spec '%s'", spec)
+		}
+		bits[i], stars[i] = b, star
+	}
+
+	// the day of week 7 is Sunday
+	dow := bits[5]
+	if dow.has(7) {
+		dow = (dow | 1) &^ (1 << 7)
+	}
+
+	return &cronSchedule{
+		second:  bits[0],
+		minute:  bits[1],
+		hour:    bits[2],
+		dom:     bits[3],
+		month:   bits[4],
+		dow:     dow,
+		domStar: stars[3],
+		dowStar: stars[5],
+	}, nil
+}
+
+// parseCronField will parse the field expression to bitset, and return whether it is '*' or '?'.
+func parseCronField(expr string, f cronField) (cronBits, bool, error) {
+	var bits cronBits
+	star := false
+	for _, part := range strings.Split(expr, ",") {
+		rangeAndStep := strings.SplitN(part, "/", 2)
+		lo, hi, step := f.min, f.max, 1
+
+		switch r := rangeAndStep[0]; {
+		case r == "*" || r == "?":
+			star = star || len(rangeAndStep) == 1
+		case strings.Contains(r, "-"):
+			bounds := strings.SplitN(r, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], f); err != nil {
+				return 0, false, err
+			}
+			if hi, err = parseCronValue(bounds[1], f); err != nil {
+				return 0, false, err
+			}
+		default:
+			var err error
+			if lo, err = parseCronValue(r, f); err != nil {
+				return 0, false, err
+			}
+			if len(rangeAndStep) == 1 {
+				hi = lo
+			}
+		}
+
+		if len(rangeAndStep) == 2 {
+			var err error
+			if step, err = strconv.Atoi(rangeAndStep[1]); err != nil || step <= 0 {
+				return 0, false, xerrors.Wrapf(ErrInvalidCronSpec, "invalid step '%s' of %s", part, f.name)
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, false, xerrors.Wrapf(ErrInvalidCronSpec, "%s '%s' out of range [%d, %d]", f.name, part, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, star, nil
+}
+
+func parseCronValue(s string, f cronField) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, xerrors.Wrapf(ErrInvalidCronSpec, "invalid %s '%s'", f.name, s)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next will return the next fire time after t in the location of t. It search the time from
+// the month field to second field, and restart from the month field if any field wraps.
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// the fire time is at least the next second
+	t = t.Add(time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + cronSearchYears
+
+	// truncated is true when the lower fields has been set to zero value
+	truncated := false
+
+WRAP:
+	for t.Year() <= yearLimit {
+		for !s.month.has(int(t.Month())) {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 1, 0)
+			if t.Month() == time.January {
+				continue WRAP
+			}
+		}
+
+		for !s.dayMatches(t) {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+			}
+			t = t.AddDate(0, 0, 1)
+
+			// the midnight maybe not exist because of the daylight saving time, the
+			// AddDate will normalize it to the other hour.
+			if h := t.Hour(); h != 0 {
+				if h > 12 {
+					t = t.Add(time.Duration(24-h) * time.Hour)
+				} else {
+					t = t.Add(time.Duration(-h) * time.Hour)
+				}
+			}
+			if t.Day() == 1 {
+				continue WRAP
+			}
+		}
+
+		for !s.hour.has(t.Hour()) {
+			if !truncated {
+				truncated = true
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+			}
+			t = t.Add(time.Hour)
+			if t.Hour() == 0 {
+				continue WRAP
+			}
+		}
+
+		for !s.minute.has(t.Minute()) {
+			if !truncated {
+				truncated = true
+				t = t.Truncate(time.Minute)
+			}
+			t = t.Add(time.Minute)
+			if t.Minute() == 0 {
+				continue WRAP
+			}
+		}
+
+		for !s.second.has(t.Second()) {
+			if !truncated {
+				truncated = true
+				t = t.Truncate(time.Second)
+			}
+			t = t.Add(time.Second)
+			if t.Second() == 0 {
+				continue WRAP
+			}
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,241 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseCron(t *testing.T) {
+	type testCase struct {
+		desp     string
+		spec     string
+		expected string
+	}
+	testCases := []testCase{
+		{
+			desp:     "empty",
+			spec:     "",
+			expected: "expect 5 or 6 fields in '', got 0: invalid cron spec",
+		},
+		{
+			desp:     "too few fields",
+			spec:     "* * * *",
+			expected: "expect 5 or 6 fields in '* * * *', got 4: invalid cron spec",
+		},
+		{
+			desp:     "unknown descriptor",
+			spec:     "@secondly",
+			expected: "expect 5 or 6 fields in '@secondly', got 1: invalid cron spec",
+		},
+		{
+			desp:     "second out of range",
+			spec:     "60 * * * * *",
+			expected: "parse cron spec '60 * * * * *': second '60' out of range [0, 59]: invalid cron spec",
+		},
+		{
+			desp:     "hour out of range",
+			spec:     "* 24 * * *",
+			expected: "parse cron spec '* 24 * * *': hour '24' out of range [0, 23]: invalid cron spec",
+		},
+		{
+			desp:     "day of month out of range",
+			spec:     "* * 0 * *",
+			expected: "parse cron spec '* * 0 * *': day of month '0' out of range [1, 31]: invalid cron spec",
+		},
+		{
+			desp:     "reverse range",
+			spec:     "5-1 * * * *",
+			expected: "parse cron spec '5-1 * * * *': minute '5-1' out of range [0, 59]: invalid cron spec",
+		},
+		{
+			desp:     "zero step",
+			spec:     "*/0 * * * *",
+			expected: "parse cron spec '*/0 * * * *': invalid step '*/0' of minute: invalid cron spec",
+		},
+		{
+			desp:     "invalid value",
+			spec:     "* * * FOO *",
+			expected: "parse cron spec '* * * FOO *': invalid month 'FOO': invalid cron spec",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := ParseCron(tc.spec)
+			g.Expect(err).To(MatchError(ErrInvalidCronSpec))
+			g.Expect(err.Error()).To(Equal(tc.expected))
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		desp     string
+		spec     string
+		loc      *time.Location
+		from     string
+		expected string
+	}
+	testCases := []testCase{
+		{
+			desp:     "every 5 minutes",
+			spec:     "*/5 * * * *",
+			from:     "2024-01-01T10:02:30Z",
+			expected: "2024-01-01T10:05:00Z",
+		},
+		{
+			desp:     "strictly after",
+			spec:     "*/5 * * * *",
+			from:     "2024-01-01T10:05:00Z",
+			expected: "2024-01-01T10:10:00Z",
+		},
+		{
+			desp:     "nanosecond",
+			spec:     "*/5 * * * *",
+			from:     "2024-01-01T10:04:59.999Z",
+			expected: "2024-01-01T10:05:00Z",
+		},
+		{
+			desp:     "seconds field",
+			spec:     "30 */5 * * * *",
+			from:     "2024-01-01T10:05:30Z",
+			expected: "2024-01-01T10:10:30Z",
+		},
+		{
+			desp:     "start with step",
+			spec:     "10/20 * * * *",
+			from:     "2024-01-01T10:31:00Z",
+			expected: "2024-01-01T10:50:00Z",
+		},
+		{
+			desp:     "wrap hour",
+			spec:     "15,45 * * * *",
+			from:     "2024-01-01T23:50:00Z",
+			expected: "2024-01-02T00:15:00Z",
+		},
+		{
+			desp:     "week days",
+			spec:     "0 9 * * MON-FRI",
+			from:     "2024-01-05T10:00:00Z",
+			expected: "2024-01-08T09:00:00Z",
+		},
+		{
+			desp:     "list of day",
+			spec:     "0 0 1,15 * *",
+			from:     "2024-01-15T00:00:01Z",
+			expected: "2024-02-01T00:00:00Z",
+		},
+		{
+			desp:     "leap day",
+			spec:     "0 0 29 2 *",
+			from:     "2024-03-01T00:00:00Z",
+			expected: "2028-02-29T00:00:00Z",
+		},
+		{
+			desp:     "no fire time",
+			spec:     "0 0 30 2 *",
+			from:     "2024-01-01T00:00:00Z",
+			expected: "0001-01-01T00:00:00Z",
+		},
+		{
+			desp:     "day of month or day of week",
+			spec:     "0 0 13 * FRI",
+			from:     "2024-01-01T00:00:00Z",
+			expected: "2024-01-05T00:00:00Z",
+		},
+		{
+			desp:     "day of week 7 is sunday",
+			spec:     "0 0 * * 7",
+			from:     "2024-01-01T00:00:00Z",
+			expected: "2024-01-07T00:00:00Z",
+		},
+		{
+			desp:     "hourly",
+			spec:     "@hourly",
+			from:     "2024-01-01T10:59:59.5Z",
+			expected: "2024-01-01T11:00:00Z",
+		},
+		{
+			desp:     "yearly",
+			spec:     "@yearly",
+			from:     "2024-01-01T00:00:00Z",
+			expected: "2025-01-01T00:00:00Z",
+		},
+		{
+			desp:     "location",
+			spec:     "0 9 * * *",
+			loc:      newYork,
+			from:     "2024-01-01T15:00:00Z",
+			expected: "2024-01-02T14:00:00Z",
+		},
+		{
+			desp:     "daylight saving time skip",
+			spec:     "30 2 * * *",
+			loc:      newYork,
+			from:     "2024-03-09T12:00:00-05:00",
+			expected: "2024-03-11T02:30:00-04:00",
+		},
+		{
+			desp:     "daylight saving time offset",
+			spec:     "0 9 * * *",
+			loc:      newYork,
+			from:     "2024-03-09T12:00:00-05:00",
+			expected: "2024-03-10T09:00:00-04:00",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s, err := ParseCron(tc.spec)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			from, err := time.Parse(time.RFC3339Nano, tc.from)
+			g.Expect(err).ToNot(HaveOccurred())
+			if tc.loc != nil {
+				from = from.In(tc.loc)
+			} else {
+				from = from.UTC()
+			}
+
+			expected, err := time.Parse(time.RFC3339Nano, tc.expected)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			next := s.Next(from)
+			g.Expect(next.Equal(expected)).To(BeTrue(), "expect %v, got %v", expected, next)
+			if !next.IsZero() {
+				g.Expect(next.Location()).To(Equal(from.Location()))
+			}
+		})
+	}
+}
@@ -20,9 +20,34 @@
 package timingwheel
 
 import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/lsytj0413/ena"
 )
 
+// Executor will execute the fired Handler, the Execute is called in the
+// goroutine of timingwheel, so the timingwheel is paused while it block or
+// run the Handler in the caller goroutine, and the Handler which call the
+// timingwheel (such as AfterFunc or TimerTask.Stop) will deadlock.
+type Executor interface {
+	// Execute will run the Handler with the fired time, it return error if the
+	// Handler is dropped and will never been called.
+	Execute(f Handler, t time.Time) error
+}
+
+// ExecutorFunc is an adapter to allow the use of function as Executor.
+type ExecutorFunc func(f Handler, t time.Time)
+
+// Execute will call fn(f, t), the Handler is never dropped
+func (fn ExecutorFunc) Execute(f Handler, t time.Time) error {
+	fn(f, t)
+	return nil
+}
+
 // executor is an redefine for task execute
 type executor = func(Handler, time.Time)
 
@@ -45,3 +70,284 @@ func blockExecutor(f Handler, ct time.Time) {
 func init() {
 	defaultExecutor = taskExecutor
 }
+
+// trackExecutor will track the in-flight Handlers of the Executor, so that the
+// timingwheel can wait them finished when shutdown.
+type trackExecutor struct {
+	// e is the Executor to run Handler, nil means the defaultExecutor
+	e Executor
+
+	wg sync.WaitGroup
+}
+
+// Execute will run the Handler by the Executor and track it, the dropped Handler
+// is not tracked.
+func (e *trackExecutor) Execute(f Handler, ct time.Time) error {
+	e.wg.Add(1)
+	run := func(ct time.Time) {
+		defer e.wg.Done()
+		f(ct)
+	}
+
+	if e.e == nil {
+		defaultExecutor(run, ct)
+		return nil
+	}
+	if err := e.e.Execute(run, ct); err != nil {
+		e.wg.Done()
+		return err
+	}
+	return nil
+}
+
+// Wait will wait all the in-flight Handlers finished, or the ctx is done.
+func (e *trackExecutor) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OverflowPolicy is the behavior of PoolExecutor when the queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock will block the Execute until the queue has space, the
+	// timingwheel is paused while waiting, so the Handler must not call the
+	// timingwheel if the queue maybe full
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDrop will drop the Handler
+	OverflowDrop
+
+	// OverflowRunInline will run the Handler in the goroutine which call the
+	// Execute, it's the goroutine of timingwheel, so the Handler must not call
+	// the timingwheel if the queue maybe full
+	OverflowRunInline
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "Block"
+	case OverflowDrop:
+		return "Drop"
+	case OverflowRunInline:
+		return "RunInline"
+	}
+	return "Unknown"
+}
+
+type poolOption struct {
+	// Workers is the count of worker goroutines
+	// Default: runtime.NumCPU()
+	Workers int
+
+	// QueueSize is the max count of Handlers which is waiting for worker
+	// Default: 1024
+	QueueSize int
+
+	// Overflow is the policy when the queue is full
+	// Default: OverflowBlock
+	Overflow OverflowPolicy
+}
+
+func defaultPoolOption() *poolOption {
+	return &poolOption{
+		Workers:   runtime.NumCPU(),
+		QueueSize: 1024,
+		Overflow:  OverflowBlock,
+	}
+}
+
+// WithPoolWorkers will set the workers option
+func WithPoolWorkers(n int) ena.Option[poolOption] {
+	return ena.NewFnOption(func(opt *poolOption) {
+		opt.Workers = n
+	})
+}
+
+// WithPoolQueueSize will set the queue size option
+func WithPoolQueueSize(n int) ena.Option[poolOption] {
+	return ena.NewFnOption(func(opt *poolOption) {
+		opt.QueueSize = n
+	})
+}
+
+// WithPoolOverflow will set the overflow policy option
+func WithPoolOverflow(p OverflowPolicy) ena.Option[poolOption] {
+	return ena.NewFnOption(func(opt *poolOption) {
+		opt.Overflow = p
+	})
+}
+
+// ExecutorMetrics is the snapshot of PoolExecutor metrics.
+type ExecutorMetrics struct {
+	// Queued is the count of Handlers which is waiting for worker, it's never
+	// greater than the QueueSize
+	Queued int64
+
+	// Running is the count of Handlers which is running, include the
+	// Handlers run inline
+	Running int64
+
+	// Dropped is the total count of Handlers which is dropped by the
+	// OverflowDrop policy or after Close
+	Dropped uint64
+}
+
+// PoolExecutor is the Executor which run the Handlers by bounded workers.
+type PoolExecutor interface {
+	Executor
+
+	// Metrics return the current metrics
+	Metrics() ExecutorMetrics
+
+	// Close will stop accept new Handler, and wait the queued Handlers
+	// finished. The Handler executed after Close is dropped.
+	Close()
+}
+
+type poolTask struct {
+	f Handler
+	t time.Time
+}
+
+// poolExecutor is the implement of PoolExecutor
+type poolExecutor struct {
+	opt *poolOption
+
+	queue chan poolTask
+	wg    ena.WaitGroupWrapper
+
+	// mu protect the closed, the Execute is tracked by inflight before the
+	// Close, so that the Close will not miss any queued Handler
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup
+
+	// done is closed to stop the workers after all the Execute returned
+	done chan struct{}
+
+	running int64
+	dropped uint64
+}
+
+// NewPoolExecutor will return the PoolExecutor with bounded workers and
+// queue, the workers is started immediately.
+func NewPoolExecutor(opts ...ena.Option[poolOption]) (PoolExecutor, error) {
+	opt := defaultPoolOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+	if opt.Workers <= 0 {
+		return nil, ErrInvalidPoolWorkers
+	}
+	if opt.QueueSize < 0 {
+		return nil, ErrInvalidPoolQueueSize
+	}
+
+	p := &poolExecutor{
+		opt:   opt,
+		queue: make(chan poolTask, opt.QueueSize),
+		done:  make(chan struct{}),
+	}
+	for i := 0; i < opt.Workers; i++ {
+		p.wg.Wrap(p.work)
+	}
+	return p, nil
+}
+
+func (p *poolExecutor) work() {
+	for {
+		select {
+		case task := <-p.queue:
+			p.run(task)
+		case <-p.done:
+			// Drain the queued tasks before exit
+			for {
+				select {
+				case task := <-p.queue:
+					p.run(task)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (p *poolExecutor) run(task poolTask) {
+	atomic.AddInt64(&p.running, 1)
+	defer atomic.AddInt64(&p.running, -1)
+
+	task.f(task.t)
+}
+
+// Execute will implement Executor.Execute method, the Handler is queued
+// for the workers, and the overflow policy is applied if the queue is full.
+// It return ErrExecutorClosed or ErrExecutorOverflow if the Handler is dropped.
+func (p *poolExecutor) Execute(f Handler, t time.Time) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		atomic.AddUint64(&p.dropped, 1)
+		return ErrExecutorClosed
+	}
+	p.inflight.Add(1)
+	p.mu.Unlock()
+	defer p.inflight.Done()
+
+	task := poolTask{f: f, t: t}
+	select {
+	case p.queue <- task:
+		return nil
+	default:
+	}
+
+	switch p.opt.Overflow {
+	case OverflowDrop:
+		atomic.AddUint64(&p.dropped, 1)
+		return ErrExecutorOverflow
+	case OverflowRunInline:
+		p.run(task)
+		return nil
+	}
+
+	// the workers is running until all the Execute returned, so the queue
+	// will have space after the running Handler finished
+	p.queue <- task
+	return nil
+}
+
+func (p *poolExecutor) Metrics() ExecutorMetrics {
+	return ExecutorMetrics{
+		Queued:  int64(len(p.queue)),
+		Running: atomic.LoadInt64(&p.running),
+		Dropped: atomic.LoadUint64(&p.dropped),
+	}
+}
+
+func (p *poolExecutor) Close() {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	// wait the blocked or inline Execute returned, and then the workers drain
+	// the queue.
+	p.inflight.Wait()
+	close(p.done)
+	p.wg.Wait()
+}
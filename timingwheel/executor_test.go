@@ -0,0 +1,309 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena"
+)
+
+func TestNewPoolExecutor(t *testing.T) {
+	g := NewWithT(t)
+
+	_, err := NewPoolExecutor(WithPoolWorkers(0))
+	g.Expect(err).To(Equal(ErrInvalidPoolWorkers))
+	_, err = NewPoolExecutor(WithPoolQueueSize(-1))
+	g.Expect(err).To(Equal(ErrInvalidPoolQueueSize))
+
+	p, err := NewPoolExecutor()
+	g.Expect(err).ToNot(HaveOccurred())
+	p.Close()
+	p.Close()
+}
+
+func TestPoolExecutor(t *testing.T) {
+	type testCase struct {
+		desp     string
+		overflow OverflowPolicy
+		dropped  uint64
+		inline   int32
+		expected error
+	}
+	testCases := []testCase{
+		{
+			desp:     "block",
+			overflow: OverflowBlock,
+		},
+		{
+			desp:     "drop",
+			overflow: OverflowDrop,
+			dropped:  1,
+			expected: ErrExecutorOverflow,
+		},
+		{
+			desp:     "run inline",
+			overflow: OverflowRunInline,
+			inline:   1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p, err := NewPoolExecutor(WithPoolWorkers(1), WithPoolQueueSize(1), WithPoolOverflow(tc.overflow))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			release := make(chan struct{})
+			started := make(chan struct{}, 3)
+			var executed, inline int32
+			var mu sync.Mutex
+			fired := []time.Time{}
+			handler := func(inlineCall bool) Handler {
+				return func(ct time.Time) {
+					if inlineCall {
+						atomic.AddInt32(&inline, 1)
+					}
+					started <- struct{}{}
+					<-release
+
+					mu.Lock()
+					fired = append(fired, ct)
+					mu.Unlock()
+					atomic.AddInt32(&executed, 1)
+				}
+			}
+
+			now := time.Now()
+			// The first one is running, and the second one is queued
+			g.Expect(p.Execute(handler(false), now)).To(Succeed())
+			<-started
+			g.Expect(p.Execute(handler(false), now.Add(time.Millisecond))).To(Succeed())
+			g.Expect(p.Metrics()).To(Equal(ExecutorMetrics{Queued: 1, Running: 1}))
+
+			// The third one overflow
+			errCh := make(chan error, 1)
+			go func() {
+				errCh <- p.Execute(handler(tc.overflow == OverflowRunInline), now.Add(2*time.Millisecond))
+			}()
+			switch tc.overflow {
+			case OverflowBlock:
+				// The Execute is blocked until the queue has space
+				g.Consistently(errCh, 50*time.Millisecond).ShouldNot(Receive())
+				g.Expect(started).ToNot(Receive())
+				g.Expect(p.Metrics()).To(Equal(ExecutorMetrics{Queued: 1, Running: 1}))
+			case OverflowDrop:
+				g.Eventually(errCh).Should(Receive(MatchError(tc.expected)))
+				g.Expect(p.Metrics()).To(Equal(ExecutorMetrics{Queued: 1, Running: 1, Dropped: 1}))
+			case OverflowRunInline:
+				// The Handler is running in the goroutine which call the Execute
+				<-started
+				g.Consistently(errCh, 50*time.Millisecond).ShouldNot(Receive())
+				g.Expect(p.Metrics()).To(Equal(ExecutorMetrics{Queued: 1, Running: 2}))
+			}
+
+			close(release)
+			if tc.expected == nil {
+				g.Eventually(errCh).Should(Receive(BeNil()))
+			}
+			p.Close()
+
+			expect := int32(3) - int32(tc.dropped)
+			g.Expect(atomic.LoadInt32(&executed)).To(Equal(expect))
+			g.Expect(atomic.LoadInt32(&inline)).To(Equal(tc.inline))
+			g.Expect(p.Metrics()).To(Equal(ExecutorMetrics{Dropped: tc.dropped}))
+			g.Expect(fired).To(HaveLen(int(expect)))
+		})
+	}
+}
+
+func TestPoolExecutorFlood(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowBlock, OverflowDrop, OverflowRunInline} {
+		t.Run(overflow.String(), func(t *testing.T) {
+			g := NewWithT(t)
+
+			queueSize := 4
+			p, err := NewPoolExecutor(WithPoolWorkers(2), WithPoolQueueSize(queueSize), WithPoolOverflow(overflow))
+			g.Expect(err).ToNot(HaveOccurred())
+
+			// the metrics is sampled while flooding the executor
+			stop := make(chan struct{})
+			var maxQueued int64
+			var swg ena.WaitGroupWrapper
+			swg.Wrap(func() {
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					if q := p.Metrics().Queued; q > atomic.LoadInt64(&maxQueued) {
+						atomic.StoreInt64(&maxQueued, q)
+					}
+				}
+			})
+
+			n := 200
+			var executed int32
+			var wg ena.WaitGroupWrapper
+			for i := 0; i < 8; i++ {
+				wg.Wrap(func() {
+					for j := 0; j < n/8; j++ {
+						_ = p.Execute(func(time.Time) {
+							time.Sleep(100 * time.Microsecond)
+							atomic.AddInt32(&executed, 1)
+						}, time.Now())
+					}
+				})
+			}
+			wg.Wait()
+			p.Close()
+			close(stop)
+			swg.Wait()
+
+			g.Expect(atomic.LoadInt64(&maxQueued)).To(BeNumerically("<=", queueSize))
+			g.Expect(int(atomic.LoadInt32(&executed)) + int(p.Metrics().Dropped)).To(Equal(n))
+			if overflow != OverflowDrop {
+				g.Expect(p.Metrics().Dropped).To(BeZero())
+			}
+		})
+	}
+}
+
+func TestPoolExecutorClose(t *testing.T) {
+	g := NewWithT(t)
+
+	p, err := NewPoolExecutor(WithPoolWorkers(2), WithPoolQueueSize(10))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var executed int32
+	for i := 0; i < 10; i++ {
+		p.Execute(func(time.Time) {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&executed, 1)
+		}, time.Now())
+	}
+
+	// The queued Handlers is finished before Close return
+	p.Close()
+	g.Expect(atomic.LoadInt32(&executed)).To(Equal(int32(10)))
+
+	err = p.Execute(func(time.Time) {
+		atomic.AddInt32(&executed, 1)
+	}, time.Now())
+	g.Expect(err).To(MatchError(ErrExecutorClosed))
+	g.Expect(atomic.LoadInt32(&executed)).To(Equal(int32(10)))
+	g.Expect(p.Metrics().Dropped).To(Equal(uint64(1)))
+}
+
+func TestTimingWheelWithExecutor(t *testing.T) {
+	g := NewWithT(t)
+
+	var calls int32
+	e := ExecutorFunc(func(f Handler, ct time.Time) {
+		atomic.AddInt32(&calls, 1)
+		go f(ct)
+	})
+
+	tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(e))
+	g.Expect(err).ToNot(HaveOccurred())
+	tw.Start()
+	defer tw.Stop()
+
+	ch := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		_, err = tw.AfterFunc(5*time.Millisecond, func(time.Time) {
+			ch <- struct{}{}
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+	}
+
+	g.Eventually(ch, time.Second).Should(Receive())
+	g.Eventually(ch, time.Second).Should(Receive())
+	g.Expect(atomic.LoadInt32(&calls)).To(Equal(int32(2)))
+}
+
+func TestTimingWheelWithPoolExecutorReentrant(t *testing.T) {
+	type testCase struct {
+		desp      string
+		overflow  OverflowPolicy
+		queueSize int
+	}
+	testCases := []testCase{
+		{
+			// the queue has space, the timingwheel is never paused
+			desp:      "block",
+			overflow:  OverflowBlock,
+			queueSize: 5,
+		},
+		{
+			desp:      "drop",
+			overflow:  OverflowDrop,
+			queueSize: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			p, err := NewPoolExecutor(WithPoolWorkers(1), WithPoolQueueSize(tc.queueSize), WithPoolOverflow(tc.overflow))
+			g.Expect(err).ToNot(HaveOccurred())
+			defer p.Close()
+
+			tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(p))
+			g.Expect(err).ToNot(HaveOccurred())
+			tw.Start()
+			defer tw.Stop()
+
+			// every Handler call the timingwheel, and the dropped one is never finished
+			n := 5
+			finished := make(chan struct{}, n)
+			for i := 0; i < n; i++ {
+				_, err = tw.AfterFunc(time.Millisecond, func(time.Time) {
+					task, err := tw.AfterFunc(time.Hour, func(time.Time) {})
+					if err == nil {
+						_, _ = task.Stop()
+					}
+					time.Sleep(5 * time.Millisecond)
+					finished <- struct{}{}
+				})
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			g.Eventually(func() int {
+				return len(finished) + int(p.Metrics().Dropped)
+			}, 2*time.Second).Should(Equal(n))
+		})
+	}
+}
+
+func TestOverflowPolicyString(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(OverflowBlock.String()).To(Equal("Block"))
+	g.Expect(OverflowDrop.String()).To(Equal("Drop"))
+	g.Expect(OverflowRunInline.String()).To(Equal("RunInline"))
+	g.Expect(OverflowPolicy(10).String()).To(Equal("Unknown"))
+}
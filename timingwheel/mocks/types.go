@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	reflect "reflect"
 	time "time"
 
@@ -50,6 +51,36 @@ func (mr *MockTimingWheelMockRecorder) AfterFunc(d, f interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AfterFunc", reflect.TypeOf((*MockTimingWheel)(nil).AfterFunc), d, f)
 }
 
+// AfterFuncCtx mocks base method.
+func (m *MockTimingWheel) AfterFuncCtx(ctx context.Context, d time.Duration, f timingwheel.ContextHandler) (timingwheel.TimerTask, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AfterFuncCtx", ctx, d, f)
+	ret0, _ := ret[0].(timingwheel.TimerTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AfterFuncCtx indicates an expected call of AfterFuncCtx.
+func (mr *MockTimingWheelMockRecorder) AfterFuncCtx(ctx, d, f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AfterFuncCtx", reflect.TypeOf((*MockTimingWheel)(nil).AfterFuncCtx), ctx, d, f)
+}
+
+// Shutdown mocks base method.
+func (m *MockTimingWheel) Shutdown(ctx context.Context, mode timingwheel.ShutdownMode) ([]timingwheel.TimerTask, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Shutdown", ctx, mode)
+	ret0, _ := ret[0].([]timingwheel.TimerTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Shutdown indicates an expected call of Shutdown.
+func (mr *MockTimingWheelMockRecorder) Shutdown(ctx, mode interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Shutdown", reflect.TypeOf((*MockTimingWheel)(nil).Shutdown), ctx, mode)
+}
+
 // Start mocks base method.
 func (m *MockTimingWheel) Start() {
 	m.ctrl.T.Helper()
@@ -89,6 +120,21 @@ func (mr *MockTimingWheelMockRecorder) TickFunc(d, f interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TickFunc", reflect.TypeOf((*MockTimingWheel)(nil).TickFunc), d, f)
 }
 
+// TickFuncCtx mocks base method.
+func (m *MockTimingWheel) TickFuncCtx(ctx context.Context, d time.Duration, f timingwheel.ContextHandler) (timingwheel.TimerTask, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TickFuncCtx", ctx, d, f)
+	ret0, _ := ret[0].(timingwheel.TimerTask)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// TickFuncCtx indicates an expected call of TickFuncCtx.
+func (mr *MockTimingWheelMockRecorder) TickFuncCtx(ctx, d, f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TickFuncCtx", reflect.TypeOf((*MockTimingWheel)(nil).TickFuncCtx), ctx, d, f)
+}
+
 // MockTimerTask is a mock of TimerTask interface.
 type MockTimerTask struct {
 	ctrl     *gomock.Controller
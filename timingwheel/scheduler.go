@@ -0,0 +1,235 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/lsytj0413/ena"
+	"github.com/lsytj0413/ena/xerrors"
+)
+
+// randInt63n is the random function for jitter, testable
+var randInt63n = rand.Int63n
+
+// Scheduler will call the Handler at the fire times computed by Schedule, it compute the next
+// fire time and re-arm the timer by the Clock after each fire.
+// NOTE: the Clock's timer is re-armed in the fired Handler, it's safe with the default executor
+// and the PoolExecutor with OverflowDrop, the Executor of TimingWheel must not block or run the
+// Handler in the goroutine of timingwheel, see Executor and OverflowPolicy.
+type Scheduler interface {
+	// Schedule will call the Handler at every fire time of the Schedule until the TimerTask
+	// is stopped or there is no more fire time.
+	Schedule(s Schedule, f Handler, opts ...ena.Option[scheduleOption]) (TimerTask, error)
+
+	// ScheduleCron is same as Schedule with the cron spec, see ParseCron.
+	ScheduleCron(spec string, f Handler, opts ...ena.Option[scheduleOption]) (TimerTask, error)
+}
+
+type scheduleOption struct {
+	// Location is the time zone to compute the fire time
+	// Default: time.Local
+	Location *time.Location
+
+	// Jitter is the max random delay add to every fire time
+	// Default: 0
+	Jitter time.Duration
+}
+
+func defaultScheduleOption() *scheduleOption {
+	return &scheduleOption{
+		Location: time.Local,
+	}
+}
+
+// WithScheduleLocation will set the location option
+func WithScheduleLocation(loc *time.Location) ena.Option[scheduleOption] {
+	return ena.NewFnOption(func(opt *scheduleOption) {
+		opt.Location = loc
+	})
+}
+
+// WithScheduleJitter will set the jitter option
+func WithScheduleJitter(d time.Duration) ena.Option[scheduleOption] {
+	return ena.NewFnOption(func(opt *scheduleOption) {
+		opt.Jitter = d
+	})
+}
+
+// scheduler is the implement of Scheduler
+type scheduler struct {
+	c Clock
+}
+
+// NewScheduler will return the Scheduler which timers is run by the Clock, use
+// NewWheelClock for TimingWheel.
+func NewScheduler(c Clock) Scheduler {
+	return &scheduler{
+		c: c,
+	}
+}
+
+func (s *scheduler) Schedule(sc Schedule, f Handler, opts ...ena.Option[scheduleOption]) (TimerTask, error) {
+	opt := defaultScheduleOption()
+	for _, o := range opts {
+		o.Apply(opt)
+	}
+	if opt.Jitter < 0 {
+		return nil, ErrInvalidScheduleJitter
+	}
+	if opt.Location == nil {
+		opt.Location = time.Local
+	}
+
+	t := &scheduledTask{
+		c:   s.c,
+		s:   sc,
+		f:   f,
+		opt: opt,
+	}
+	if err := t.arm(s.c.Now()); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *scheduler) ScheduleCron(spec string, f Handler, opts ...ena.Option[scheduleOption]) (TimerTask, error) {
+	sc, err := ParseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	return s.Schedule(sc, f, opts...)
+}
+
+// scheduledTask is the TimerTask of Scheduler, it hold the current timer of Clock
+type scheduledTask struct {
+	c   Clock
+	s   Schedule
+	f   Handler
+	opt *scheduleOption
+
+	// mu protect the stopped, done and t
+	mu      sync.Mutex
+	stopped bool
+	t       TimerTask
+
+	// done is true when there is no more fire time or the Clock failed to arm
+	done bool
+}
+
+// arm will compute the next fire time after from, and arm the timer by the Clock.
+func (t *scheduledTask) arm(from time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return nil
+	}
+
+	next := t.s.Next(from.In(t.opt.Location))
+	if next.IsZero() {
+		t.done = true
+		return xerrors.Wrapf(ErrNoScheduleTime, "after %s", from.In(t.opt.Location))
+	}
+
+	d := next.Sub(t.c.Now())
+	if t.opt.Jitter > 0 {
+		d += time.Duration(randInt63n(int64(t.opt.Jitter)))
+	}
+	return t.armAt(next, d)
+}
+
+// rearm will arm the timer for the remaining delay of the fire time next.
+func (t *scheduledTask) rearm(next time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return nil
+	}
+
+	return t.armAt(next, next.Sub(t.c.Now()))
+}
+
+// armAt will arm the timer which fire after d for the fire time next, the t.mu must be held.
+func (t *scheduledTask) armAt(next time.Time, d time.Duration) error {
+	if d < 0 {
+		d = 0
+	}
+
+	timer, err := t.c.AfterFunc(d, func(ct time.Time) {
+		t.fire(next, ct)
+	})
+	if err != nil {
+		t.done = true
+		return err
+	}
+	t.t = timer
+	return nil
+}
+
+// fire will re-arm the next timer and call the Handler. The timer maybe fired before the
+// fire time, such as the Clock with coarse tick, then it's re-armed for the remaining delay
+// and the Handler is not called.
+func (t *scheduledTask) fire(next time.Time, ct time.Time) {
+	now := t.c.Now()
+	if now.Before(next) {
+		_ = t.rearm(next)
+		return
+	}
+
+	// re-arm before call the Handler, so the long Handler will not delay the next fire time,
+	// the error means there is no more fire time or the Clock is stopped.
+	_ = t.arm(now)
+
+	t.mu.Lock()
+	stopped := t.stopped
+	t.mu.Unlock()
+	if stopped {
+		return
+	}
+
+	t.f(ct)
+}
+
+// Stop the timertask, the Handler will not be execute after this. It return the result
+// of the current timer, false if the last timer has already fired and there is no more
+// fire time.
+func (t *scheduledTask) Stop() (bool, error) {
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return true, nil
+	}
+
+	// the timer is stopped without lock, because the Clock maybe wait the fired Handler
+	// which re-arm the timer with lock. The following arm is skipped after stopped.
+	t.stopped = true
+	timer, done := t.t, t.done
+	t.mu.Unlock()
+
+	stopped, err := timer.Stop()
+	if err != nil {
+		return false, err
+	}
+
+	// the current timer maybe fired and waiting for re-arm, the following fire is stopped
+	return stopped || !done, nil
+}
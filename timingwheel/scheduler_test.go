@@ -0,0 +1,345 @@
+// Copyright (c) 2023 The Songlin Yang Authors
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies of
+// the Software, and to permit persons to whom the Software is furnished to do so,
+// subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY, FITNESS
+// FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR
+// COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY, WHETHER
+// IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN
+// CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+
+package timingwheel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	"github.com/lsytj0413/ena"
+)
+
+func TestSchedulerSchedule(t *testing.T) {
+	start := time.Date(2024, 1, 1, 10, 2, 30, 0, time.UTC)
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type testCase struct {
+		desp     string
+		schedule Schedule
+		spec     string
+		opts     []ena.Option[scheduleOption]
+		advance  time.Duration
+
+		fired   []time.Time
+		pending int
+		stopped bool
+	}
+	testCases := []testCase{
+		{
+			desp:    "cron",
+			spec:    "*/5 * * * *",
+			advance: 20 * time.Minute,
+			fired: []time.Time{
+				time.Date(2024, 1, 1, 10, 5, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 20, 0, 0, time.UTC),
+			},
+			pending: 1,
+			stopped: true,
+		},
+		{
+			desp:    "location",
+			spec:    "0 9 * * *",
+			opts:    []ena.Option[scheduleOption]{WithScheduleLocation(newYork)},
+			advance: 48 * time.Hour,
+			fired: []time.Time{
+				time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC),
+				time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC),
+			},
+			pending: 1,
+			stopped: true,
+		},
+		{
+			desp:    "jitter",
+			spec:    "*/5 * * * *",
+			opts:    []ena.Option[scheduleOption]{WithScheduleJitter(10 * time.Second)},
+			advance: 10 * time.Minute,
+			fired: []time.Time{
+				time.Date(2024, 1, 1, 10, 5, 5, 0, time.UTC),
+				time.Date(2024, 1, 1, 10, 10, 5, 0, time.UTC),
+			},
+			pending: 1,
+			stopped: true,
+		},
+		{
+			desp: "finite schedule",
+			schedule: ScheduleFunc(func(t time.Time) time.Time {
+				if t.Before(start.Add(2 * time.Minute)) {
+					return t.Add(time.Minute)
+				}
+				return time.Time{}
+			}),
+			advance: time.Hour,
+			fired: []time.Time{
+				start.Add(time.Minute),
+				start.Add(2 * time.Minute),
+			},
+			pending: 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			origin := randInt63n
+			defer func() {
+				randInt63n = origin
+			}()
+			randInt63n = func(n int64) int64 {
+				g.Expect(n).To(Equal(int64(10 * time.Second)))
+				return n / 2
+			}
+
+			c := NewManualClock(start)
+			s := NewScheduler(c)
+
+			fired := []time.Time{}
+			f := func(ct time.Time) {
+				fired = append(fired, ct)
+			}
+
+			var task TimerTask
+			var err error
+			if tc.schedule != nil {
+				task, err = s.Schedule(tc.schedule, f, tc.opts...)
+			} else {
+				task, err = s.ScheduleCron(tc.spec, f, tc.opts...)
+			}
+			g.Expect(err).ToNot(HaveOccurred())
+
+			c.Advance(tc.advance)
+			g.Expect(fired).To(HaveLen(len(tc.fired)))
+			for i := range fired {
+				g.Expect(fired[i].Equal(tc.fired[i])).To(BeTrue(), "expect %v, got %v", tc.fired[i], fired[i])
+			}
+			g.Expect(c.Pending()).To(Equal(tc.pending))
+
+			g.Expect(task.Stop()).To(Equal(tc.stopped))
+			g.Expect(task.Stop()).To(BeTrue())
+			g.Expect(c.Pending()).To(Equal(0))
+			c.Advance(tc.advance)
+			g.Expect(fired).To(HaveLen(len(tc.fired)))
+		})
+	}
+}
+
+func TestSchedulerScheduleFailed(t *testing.T) {
+	type testCase struct {
+		desp     string
+		spec     string
+		opts     []ena.Option[scheduleOption]
+		expected error
+	}
+	testCases := []testCase{
+		{
+			desp:     "invalid spec",
+			spec:     "* * *",
+			expected: ErrInvalidCronSpec,
+		},
+		{
+			desp:     "invalid jitter",
+			spec:     "* * * * *",
+			opts:     []ena.Option[scheduleOption]{WithScheduleJitter(-time.Second)},
+			expected: ErrInvalidScheduleJitter,
+		},
+		{
+			desp:     "no fire time",
+			spec:     "0 0 30 2 *",
+			expected: ErrNoScheduleTime,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			s := NewScheduler(NewManualClock(time.Now()))
+			_, err := s.ScheduleCron(tc.spec, func(time.Time) {}, tc.opts...)
+			g.Expect(err).To(MatchError(tc.expected))
+		})
+	}
+}
+
+func TestSchedulerStopInHandler(t *testing.T) {
+	g := NewWithT(t)
+
+	c := NewManualClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := NewScheduler(c)
+
+	var task TimerTask
+	count := 0
+	task, err := s.ScheduleCron("* * * * *", func(time.Time) {
+		count++
+		if count == 2 {
+			g.Expect(task.Stop()).To(BeTrue())
+		}
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	c.Advance(time.Hour)
+	g.Expect(count).To(Equal(2))
+	g.Expect(c.Pending()).To(Equal(0))
+}
+
+// earlyClock is the Clock which fire the timer early, like the TimingWheel with coarse tick.
+type earlyClock struct {
+	*ManualClock
+	early time.Duration
+
+	// onStop is called when the timer is stopped
+	onStop func()
+}
+
+func (c *earlyClock) AfterFunc(d time.Duration, f Handler) (TimerTask, error) {
+	if d > c.early {
+		d -= c.early
+	}
+	t, err := c.ManualClock.AfterFunc(d, f)
+	if err != nil {
+		return nil, err
+	}
+	return &earlyTimer{TimerTask: t, c: c}, nil
+}
+
+type earlyTimer struct {
+	TimerTask
+	c *earlyClock
+}
+
+func (t *earlyTimer) Stop() (bool, error) {
+	if t.c.onStop != nil {
+		t.c.onStop()
+	}
+	return t.TimerTask.Stop()
+}
+
+func TestSchedulerFireEarly(t *testing.T) {
+	g := NewWithT(t)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &earlyClock{
+		ManualClock: NewManualClock(start),
+		early:       10 * time.Second,
+	}
+	s := NewScheduler(c)
+
+	fired := []time.Time{}
+	task, err := s.ScheduleCron("* * * * *", func(ct time.Time) {
+		fired = append(fired, ct)
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	// The timer is fired early, and re-armed for the remaining delay
+	c.Advance(50 * time.Second)
+	g.Expect(fired).To(BeEmpty())
+	g.Expect(c.Pending()).To(Equal(1))
+
+	c.Advance(10 * time.Second)
+	g.Expect(fired).To(Equal([]time.Time{start.Add(time.Minute)}))
+
+	c.Advance(time.Minute)
+	g.Expect(fired).To(Equal([]time.Time{start.Add(time.Minute), start.Add(2 * time.Minute)}))
+
+	// The timer is stopped without lock, so the fire during stop will not deadlock
+	c.onStop = func() {
+		c.Advance(time.Minute)
+	}
+	g.Expect(task.Stop()).To(BeTrue())
+	g.Expect(fired).To(HaveLen(2))
+	g.Expect(c.Pending()).To(Equal(0))
+}
+
+func TestSchedulerWithTimingWheel(t *testing.T) {
+	g := NewWithT(t)
+
+	tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(ExecutorFunc(taskExecutor)))
+	g.Expect(err).ToNot(HaveOccurred())
+	tw.Start()
+
+	var count int32
+	s := NewScheduler(NewWheelClock(tw))
+	task, err := s.Schedule(ScheduleFunc(func(t time.Time) time.Time {
+		return t.Add(5 * time.Millisecond)
+	}), func(time.Time) {
+		atomic.AddInt32(&count, 1)
+	})
+	g.Expect(err).ToNot(HaveOccurred())
+
+	g.Eventually(func() int32 {
+		return atomic.LoadInt32(&count)
+	}).Should(BeNumerically(">=", 3))
+	g.Expect(task.Stop()).To(BeTrue())
+
+	// the pending timer is dropped after the timingwheel stopped
+	task, err = s.ScheduleCron("0 0 1 1 *", func(time.Time) {})
+	g.Expect(err).ToNot(HaveOccurred())
+	tw.Stop()
+	g.Expect(task.Stop()).To(BeTrue())
+
+	_, err = s.ScheduleCron("* * * * * *", func(time.Time) {})
+	g.Expect(err).To(MatchError(ErrStopped))
+}
+
+func TestSchedulerWithPoolExecutor(t *testing.T) {
+	for _, overflow := range []OverflowPolicy{OverflowBlock, OverflowRunInline} {
+		t.Run(overflow.String(), func(t *testing.T) {
+			g := NewWithT(t)
+
+			// every Schedule has at most one Handler waiting for the worker, so the
+			// queue is never full and the timingwheel is never paused
+			p, err := NewPoolExecutor(WithPoolWorkers(1), WithPoolQueueSize(8), WithPoolOverflow(overflow))
+			g.Expect(err).ToNot(HaveOccurred())
+			defer p.Close()
+
+			tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(p))
+			g.Expect(err).ToNot(HaveOccurred())
+			tw.Start()
+			defer tw.Stop()
+
+			// the worker is busy with the slow Handlers, and every Handler re-arm the timer
+			s := NewScheduler(NewWheelClock(tw))
+			counts := make([]int32, 4)
+			for i := range counts {
+				i := i
+				_, err = s.Schedule(ScheduleFunc(func(t time.Time) time.Time {
+					return t.Add(2 * time.Millisecond)
+				}), func(time.Time) {
+					time.Sleep(2 * time.Millisecond)
+					atomic.AddInt32(&counts[i], 1)
+				})
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+
+			for i := range counts {
+				g.Eventually(func() int32 {
+					return atomic.LoadInt32(&counts[i])
+				}, 2*time.Second).Should(BeNumerically(">=", 3))
+			}
+		})
+	}
+}
@@ -57,11 +57,19 @@ type timerTask struct {
 	w stopWheel
 
 	e *list.Element
+
+	// cancel will cancel the ctx of ContextHandler, nil if the task is not created by
+	// AfterFuncCtx/TickFuncCtx
+	cancel func()
 }
 
 // Stop the timer task from fire, return true if the timer is stopped success,
 // or false if the timer has already expired or been stopped.
 func (t *timerTask) Stop() (bool, error) {
+	if t.cancel != nil {
+		defer t.cancel()
+	}
+
 	if atomic.LoadUint32(&t.stopped) == 1 {
 		return true, nil
 	}
@@ -23,6 +23,7 @@ package timingwheel
 import (
 	"context"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -37,6 +38,10 @@ type option struct {
 
 	// WheelSize is the size of buckets
 	WheelSize int64
+
+	// Executor is the executor to run the fired Handler, nil means run
+	// each Handler in it's own goroutine
+	Executor Executor
 }
 
 // Validate check the option
@@ -65,6 +70,22 @@ func (w WithSize) Apply(opt *option) {
 	opt.WheelSize = int64(w)
 }
 
+// withExecutor set the Executor field
+type withExecutor struct {
+	e Executor
+}
+
+// Apply applies this configuration to the given option
+func (w withExecutor) Apply(opt *option) {
+	opt.Executor = w.e
+}
+
+// WithExecutor set the Executor field, such as the PoolExecutor. The
+// Executor is not closed by the timingwheel.
+func WithExecutor(e Executor) Option {
+	return withExecutor{e: e}
+}
+
 // NewTimingWheel creates an instance of TimingWheel with the given tick and wheelSize.
 func NewTimingWheel(opts ...Option) (TimingWheel, error) {
 	options := &option{
@@ -85,15 +106,20 @@ func NewTimingWheel(opts ...Option) (TimingWheel, error) {
 
 	startMs := timeToMs(time.Now())
 	t := newWheel(tickMs, options.WheelSize, startMs)
+	exec := &trackExecutor{e: options.Executor}
+	t.executor = exec
 
 	tw := &timingWheel{
-		dq:  delayqueue.New[*bucket](int(options.WheelSize)),
-		w:   t,
-		wt:  wait.New(),
-		wch: make(chan event, int(options.WheelSize)*100), // the channel is bufferd, could change to unbufferd?
+		dq:   delayqueue.New[*bucket](int(options.WheelSize)),
+		w:    t,
+		wt:   wait.New(),
+		wch:  make(chan event, int(options.WheelSize)*100), // the channel is bufferd, could change to unbufferd?
+		exec: exec,
+		done: make(chan struct{}),
 	}
 
 	tw.ctx, tw.cancel = context.WithCancel(context.Background())
+	tw.hctx, tw.hcancel = context.WithCancel(context.Background())
 	return tw, nil
 }
 
@@ -121,6 +147,22 @@ type timingWheel struct {
 	// ctx to cancel sub goroutine
 	ctx    context.Context
 	cancel func()
+
+	// hctx is the parent of all ContextHandler's ctx, it's cancelled when shutdown
+	hctx    context.Context
+	hcancel func()
+
+	// exec is the Executor of the first layer wheel, track the in-flight Handlers
+	exec *trackExecutor
+
+	// mu protect the started and stopped, it's never hold when send event, the
+	// event enqueued after the shutdown event will get ErrStopped.
+	mu      sync.RWMutex
+	started bool
+	stopped bool
+
+	// done is closed when the timingwheel is stopped
+	done chan struct{}
 }
 
 // event is the representation of value in the wch
@@ -129,11 +171,21 @@ type event struct {
 	Type eventType
 
 	t *timerTask
+
+	// the mode of eventShutdown
+	mode ShutdownMode
 }
 
 // Start will start the timingwheel, and process the tasks
 // nolint
 func (tw *timingWheel) Start() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.started || tw.stopped {
+		return
+	}
+	tw.started = true
+
 	tw.wg.Wrap(func() {
 		tw.dq.Poll(tw.ctx)
 	})
@@ -169,6 +221,9 @@ func (tw *timingWheel) Start() {
 						}
 					}
 					_ = tw.wt.Trigger(strconv.FormatUint(e.t.id, 10), stopped)
+				case eventShutdown:
+					_ = tw.wt.Trigger(strconv.FormatUint(e.t.id, 10), tw.drain(e.mode))
+					return
 				}
 			case <-tw.ctx.Done():
 				return
@@ -177,10 +232,87 @@ func (tw *timingWheel) Start() {
 	})
 }
 
-// TODO(lsytj0413): clear all timer after stop?
 func (tw *timingWheel) Stop() {
+	_, _ = tw.Shutdown(context.Background(), ShutdownDrop)
+}
+
+func (tw *timingWheel) Shutdown(ctx context.Context, mode ShutdownMode) ([]TimerTask, error) {
+	tw.mu.Lock()
+	if tw.stopped {
+		tw.mu.Unlock()
+		return nil, ErrStopped
+	}
+	tw.stopped = true
+	started := tw.started
+	tw.mu.Unlock()
+
+	// the ContextHandler will been cancelled after shutdown, so the long Handler can abort
+	defer tw.hcancel()
+
+	if !started {
+		tw.cancel()
+		close(tw.done)
+		return nil, nil
+	}
+
+	// the AfterFunc/TickFunc/StopFunc events enqueued before the shutdown event will been
+	// processed, and the others will get ErrStopped after the loop exit.
+	t := &timerTask{
+		id: atomic.AddUint64(&tw.wid, 1),
+	}
+	outch, err := tw.wt.Register(strconv.FormatUint(t.id, 10))
+	if err != nil {
+		return nil, err
+	}
+
+	var v interface{}
+	select {
+	case tw.wch <- event{Type: eventShutdown, t: t, mode: mode}:
+		select {
+		case v = <-outch:
+		case <-ctx.Done():
+		}
+	case <-ctx.Done():
+	}
+
 	tw.cancel()
 	tw.wg.Wait()
+	close(tw.done)
+
+	if v == nil {
+		// the ctx is done, but the shutdown event maybe processed before the loop exit
+		select {
+		case v = <-outch:
+		default:
+			return nil, ctx.Err()
+		}
+	}
+
+	tasks := v.([]TimerTask)
+	if mode == ShutdownDrop {
+		return tasks, nil
+	}
+	return tasks, tw.exec.Wait(ctx)
+}
+
+// drain will remove all the pending timertasks, and fire or drop them by the mode. It
+// return the dropped timertasks.
+func (tw *timingWheel) drain(mode ShutdownMode) []TimerTask {
+	tasks := tw.w.drain()
+	if mode == ShutdownFire {
+		now := time.Now()
+		for _, t := range tasks {
+			_ = tw.exec.Execute(t.f, now)
+		}
+		return []TimerTask{}
+	}
+
+	ret := make([]TimerTask, 0, len(tasks))
+	for _, t := range tasks {
+		atomic.StoreUint32(&t.stopped, 1)
+		ret = append(ret, t)
+	}
+	return ret
 }
 
 func (tw *timingWheel) AfterFunc(d time.Duration, f Handler) (TimerTask, error) {
@@ -196,13 +328,64 @@ func (tw *timingWheel) TickFunc(d time.Duration, f Handler) (TimerTask, error) {
 	return tw.addFunc(d, f, taskTick)
 }
 
+func (tw *timingWheel) AfterFuncCtx(ctx context.Context, d time.Duration, f ContextHandler) (TimerTask, error) {
+	return tw.addFuncCtx(ctx, f, taskAfter, func(h Handler) (TimerTask, error) {
+		return tw.AfterFunc(d, h)
+	})
+}
+
+func (tw *timingWheel) TickFuncCtx(ctx context.Context, d time.Duration, f ContextHandler) (TimerTask, error) {
+	return tw.addFuncCtx(ctx, f, taskTick, func(h Handler) (TimerTask, error) {
+		return tw.TickFunc(d, h)
+	})
+}
+
+// addFuncCtx will add the ContextHandler by the add function, the ctx of ContextHandler
+// is derived from ctx, and cancelled when shutdown.
+func (tw *timingWheel) addFuncCtx(ctx context.Context, f ContextHandler, eType timerTaskType, add func(Handler) (TimerTask, error)) (TimerTask, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	hctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(tw.hctx, cancel)
+	release := func() {
+		stop()
+		cancel()
+	}
+
+	task, err := add(func(ct time.Time) {
+		if eType == taskAfter {
+			defer release()
+		}
+		f(hctx, ct)
+	})
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	t := task.(*timerTask)
+	t.cancel = release
+	context.AfterFunc(hctx, func() {
+		if ctx.Err() != nil {
+			// the ctx is done, stop the timertask
+			_, _ = t.Stop()
+		}
+	})
+	return t, nil
+}
+
 func (tw *timingWheel) StopFunc(t *timerTask) (bool, error) {
 	outch, err := tw.enquenTask(t, eventDelete)
 	if err != nil {
 		return false, err
 	}
 
-	v := <-outch
+	v, err := tw.wait(outch)
+	if err != nil {
+		return false, err
+	}
 	return v.(bool), nil
 }
 
@@ -221,20 +404,50 @@ func (tw *timingWheel) addFunc(d time.Duration, f Handler, eType timerTaskType)
 		return nil, err
 	}
 
-	v := <-outch
+	v, err := tw.wait(outch)
+	if err != nil {
+		return nil, err
+	}
 	return v.(*timerTask), nil
 }
 
 func (tw *timingWheel) enquenTask(t *timerTask, eType eventType) (<-chan interface{}, error) {
-	outch, err := tw.wt.Register(strconv.FormatUint(t.id, 10))
+	tw.mu.RLock()
+	stopped := tw.stopped
+	tw.mu.RUnlock()
+	if stopped {
+		return nil, ErrStopped
+	}
+
+	id := strconv.FormatUint(t.id, 10)
+	outch, err := tw.wt.Register(id)
 	if err != nil {
 		return nil, err
 	}
 
-	tw.wch <- event{
-		Type: eType,
-		t:    t,
+	select {
+	case tw.wch <- event{Type: eType, t: t}:
+	case <-tw.ctx.Done():
+		// the loop is exited, remove the registered id
+		_ = tw.wt.Trigger(id, nil)
+		return nil, ErrStopped
 	}
 
 	return outch, nil
 }
+
+// wait will wait the response of the event, it return ErrStopped if the timingwheel
+// is stopped before the event is processed.
+func (tw *timingWheel) wait(outch <-chan interface{}) (interface{}, error) {
+	select {
+	case v := <-outch:
+		return v, nil
+	case <-tw.done:
+		select {
+		case v := <-outch:
+			return v, nil
+		default:
+			return nil, ErrStopped
+		}
+	}
+}
@@ -420,3 +420,338 @@ func TestTimingWheelTickFunc(t *testing.T) {
 		}
 	})
 }
+
+func TestTimingWheelShutdown(t *testing.T) {
+	type testCase struct {
+		desp    string
+		mode    ShutdownMode
+		timeout time.Duration
+
+		dropped  int
+		fired    int32
+		waited   bool
+		expected error
+	}
+	testCases := []testCase{
+		{
+			desp:    "drop",
+			mode:    ShutdownDrop,
+			dropped: 2,
+			waited:  false,
+		},
+		{
+			desp:   "fire",
+			mode:   ShutdownFire,
+			fired:  2,
+			waited: true,
+		},
+		{
+			desp:    "wait",
+			mode:    ShutdownWait,
+			dropped: 2,
+			waited:  true,
+		},
+		{
+			desp:     "wait timeout",
+			mode:     ShutdownWait,
+			timeout:  10 * time.Millisecond,
+			dropped:  2,
+			waited:   false,
+			expected: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.desp, func(t *testing.T) {
+			g := NewWithT(t)
+
+			tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(ExecutorFunc(taskExecutor)))
+			g.Expect(err).ToNot(HaveOccurred())
+			tw.Start()
+
+			started, release := make(chan struct{}), make(chan struct{})
+			var finished int32
+			_, err = tw.AfterFunc(0, func(time.Time) {
+				close(started)
+				<-release
+				atomic.StoreInt32(&finished, 1)
+			})
+			g.Expect(err).ToNot(HaveOccurred())
+			<-started
+
+			var fired int32
+			fire := func(time.Time) {
+				atomic.AddInt32(&fired, 1)
+			}
+			t1, err := tw.TickFunc(time.Hour, fire)
+			g.Expect(err).ToNot(HaveOccurred())
+			t2, err := tw.AfterFunc(time.Minute, fire)
+			g.Expect(err).ToNot(HaveOccurred())
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel func()
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			if tc.waited {
+				time.AfterFunc(10*time.Millisecond, func() {
+					close(release)
+				})
+			} else {
+				defer close(release)
+			}
+
+			tasks, err := tw.Shutdown(ctx, tc.mode)
+			if tc.expected != nil {
+				g.Expect(err).To(MatchError(tc.expected))
+			} else {
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+			g.Expect(tasks).To(HaveLen(tc.dropped))
+			if tc.dropped > 0 {
+				g.Expect(tasks).To(Equal([]TimerTask{t2, t1}))
+				for _, task := range tasks {
+					g.Expect(task.Stop()).To(BeTrue())
+				}
+			}
+			g.Expect(atomic.LoadInt32(&fired)).To(Equal(tc.fired))
+			if tc.waited {
+				g.Expect(atomic.LoadInt32(&finished)).To(Equal(int32(1)))
+			} else {
+				g.Expect(atomic.LoadInt32(&finished)).To(Equal(int32(0)))
+			}
+		})
+	}
+}
+
+func TestTimingWheelShutdownWithDropExecutor(t *testing.T) {
+	for _, mode := range []ShutdownMode{ShutdownFire, ShutdownWait} {
+		t.Run(mode.String(), func(t *testing.T) {
+			g := NewWithT(t)
+
+			p, err := NewPoolExecutor(WithPoolWorkers(1), WithPoolQueueSize(1), WithPoolOverflow(OverflowDrop))
+			g.Expect(err).ToNot(HaveOccurred())
+			defer p.Close()
+
+			tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(p))
+			g.Expect(err).ToNot(HaveOccurred())
+			tw.Start()
+
+			// the worker is blocked, so the most of the Handlers is dropped
+			release := make(chan struct{})
+			n := 5
+			for i := 0; i < n; i++ {
+				_, err = tw.AfterFunc(0, func(time.Time) {
+					<-release
+				})
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+			for i := 0; i < n; i++ {
+				_, err = tw.AfterFunc(time.Hour, func(time.Time) {})
+				g.Expect(err).ToNot(HaveOccurred())
+			}
+			g.Eventually(func() uint64 {
+				return p.Metrics().Dropped
+			}).Should(BeNumerically(">=", n-2))
+			close(release)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			_, err = tw.Shutdown(ctx, mode)
+			g.Expect(err).ToNot(HaveOccurred())
+		})
+	}
+}
+
+func TestTimingWheelShutdownWithBlockedEvents(t *testing.T) {
+	g := NewWithT(t)
+
+	// the timingwheel is not started, and the events is blocked
+	tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(1))
+	g.Expect(err).ToNot(HaveOccurred())
+
+	var wg ena.WaitGroupWrapper
+	for i := 0; i < 200; i++ {
+		wg.Wrap(func() {
+			_, err := tw.AfterFunc(time.Second, func(time.Time) {})
+			g.Expect(err).To(MatchError(ErrStopped))
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = tw.Shutdown(context.Background(), ShutdownDrop)
+	}()
+	g.Eventually(done, time.Second).Should(BeClosed())
+	wg.Wait()
+}
+
+func TestTimingWheelStopped(t *testing.T) {
+	t.Run("started", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20))
+		g.Expect(err).ToNot(HaveOccurred())
+		tw.Start()
+
+		task, err := tw.AfterFunc(time.Hour, func(time.Time) {})
+		g.Expect(err).ToNot(HaveOccurred())
+		done := make(chan struct{})
+		fired, err := tw.AfterFunc(0, func(time.Time) {
+			close(done)
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		<-done
+
+		tw.Stop()
+		g.Expect(task.Stop()).To(BeTrue())
+
+		_, err = fired.Stop()
+		g.Expect(err).To(MatchError(ErrStopped))
+		_, err = tw.AfterFunc(time.Second, func(time.Time) {})
+		g.Expect(err).To(MatchError(ErrStopped))
+		_, err = tw.TickFunc(time.Second, func(time.Time) {})
+		g.Expect(err).To(MatchError(ErrStopped))
+		_, err = tw.Shutdown(context.Background(), ShutdownDrop)
+		g.Expect(err).To(MatchError(ErrStopped))
+
+		// stop again will not block
+		tw.Stop()
+	})
+
+	t.Run("not started", func(t *testing.T) {
+		g := NewWithT(t)
+
+		tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20))
+		g.Expect(err).ToNot(HaveOccurred())
+
+		tasks, err := tw.Shutdown(context.Background(), ShutdownWait)
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(tasks).To(BeEmpty())
+
+		_, err = tw.AfterFunc(time.Second, func(time.Time) {})
+		g.Expect(err).To(MatchError(ErrStopped))
+	})
+}
+
+func TestShutdownModeString(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(ShutdownDrop.String()).To(Equal("Drop"))
+	g.Expect(ShutdownFire.String()).To(Equal("Fire"))
+	g.Expect(ShutdownWait.String()).To(Equal("Wait"))
+	g.Expect(ShutdownMode(100).String()).To(Equal("Unknown"))
+}
+
+func TestTimingWheelFuncCtx(t *testing.T) {
+	newTimingWheel := func(g *WithT) TimingWheel {
+		tw, err := NewTimingWheel(WithTickDuration(time.Millisecond), WithSize(20), WithExecutor(ExecutorFunc(taskExecutor)))
+		g.Expect(err).ToNot(HaveOccurred())
+		tw.Start()
+		return tw
+	}
+
+	t.Run("ctx done before add", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+		defer tw.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := tw.AfterFuncCtx(ctx, time.Millisecond, func(context.Context, time.Time) {})
+		g.Expect(err).To(MatchError(context.Canceled))
+		_, err = tw.TickFuncCtx(ctx, time.Millisecond, func(context.Context, time.Time) {})
+		g.Expect(err).To(MatchError(context.Canceled))
+	})
+
+	t.Run("invalid tick duration", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+		defer tw.Stop()
+
+		_, err := tw.TickFuncCtx(context.Background(), time.Microsecond, func(context.Context, time.Time) {})
+		g.Expect(err).To(MatchError(ErrInvalidTickFuncDurationValue))
+	})
+
+	t.Run("ctx done stop the task", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+		defer tw.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		task, err := tw.AfterFuncCtx(ctx, time.Hour, func(context.Context, time.Time) {})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		cancel()
+		g.Eventually(func() uint32 {
+			return atomic.LoadUint32(&task.(*timerTask).stopped)
+		}).Should(Equal(uint32(1)))
+	})
+
+	t.Run("handler returned", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+		defer tw.Stop()
+
+		ch := make(chan context.Context, 1)
+		_, err := tw.AfterFuncCtx(context.Background(), time.Millisecond, func(ctx context.Context, _ time.Time) {
+			g.Expect(ctx.Err()).ToNot(HaveOccurred())
+			ch <- ctx
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+
+		var ctx context.Context
+		g.Eventually(ch).Should(Receive(&ctx))
+		g.Eventually(ctx.Done()).Should(BeClosed())
+	})
+
+	t.Run("task stopped", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+		defer tw.Stop()
+
+		started, done := make(chan struct{}, 1), make(chan error, 1)
+		task, err := tw.TickFuncCtx(context.Background(), time.Hour, func(ctx context.Context, _ time.Time) {})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Expect(task.Stop()).To(BeTrue())
+
+		task, err = tw.TickFuncCtx(context.Background(), 2*time.Millisecond, func(ctx context.Context, _ time.Time) {
+			select {
+			case started <- struct{}{}:
+			default:
+				return
+			}
+			<-ctx.Done()
+			done <- ctx.Err()
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Eventually(started).Should(Receive())
+
+		_, err = task.Stop()
+		g.Expect(err).ToNot(HaveOccurred())
+		g.Eventually(done).Should(Receive(MatchError(context.Canceled)))
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		g := NewWithT(t)
+		tw := newTimingWheel(g)
+
+		started, done := make(chan struct{}), make(chan error, 1)
+		_, err := tw.AfterFuncCtx(context.Background(), 0, func(ctx context.Context, _ time.Time) {
+			close(started)
+			<-ctx.Done()
+			done <- ctx.Err()
+		})
+		g.Expect(err).ToNot(HaveOccurred())
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = tw.Shutdown(ctx, ShutdownWait)
+		g.Expect(err).To(MatchError(context.DeadlineExceeded))
+		g.Eventually(done).Should(Receive(MatchError(context.Canceled)))
+	})
+}
@@ -20,34 +20,83 @@
 package timingwheel
 
 import (
+	"context"
 	"time"
 )
 
 // Handler for function execution
 type Handler func(time.Time)
 
+// ContextHandler for function execution with context, the context is cancelled when the
+// TimerTask is stopped or the timingwheel is shutdown.
+type ContextHandler func(context.Context, time.Time)
+
 // TimingWheel is an interface for implementation.
 type TimingWheel interface {
 	// Start starts the current timing wheel
 	Start()
 
-	// Stop stops the current timing wheel. If there is any timer's task being running, the stop
-	// will not wait for complete.
-	// TODO(lsytj0413): should pass ctx from Start?
+	// Stop stops the current timing wheel, it's the same as Shutdown with ShutdownDrop mode. If there
+	// is any timer's task being running, the stop will not wait for complete.
 	Stop()
 
-	// AfterFunc will call the Handler in its own goroutine after the duration elapse.
+	// Shutdown stops the current timing wheel with the mode, the pending timer's tasks will been
+	// fired or dropped, and the unfired tasks will been returned. After shutdown, the AfterFunc and
+	// TickFunc will return ErrStopped. If the ctx is done before complete, the ctx.Err() will been returned.
+	// The ctx of ContextHandler is cancelled when the Shutdown returned.
+	Shutdown(ctx context.Context, mode ShutdownMode) ([]TimerTask, error)
+
+	// AfterFunc will call the Handler by the Executor (in its own goroutine by default) after the duration elapse.
 	// It return an Timer that can use to cancel the Handler.
 	AfterFunc(d time.Duration, f Handler) (TimerTask, error)
 
-	// TickFunc will call the Handler in its own goroutine after the duration elapse tick.
+	// TickFunc will call the Handler by the Executor (in its own goroutine by default) after the duration elapse tick.
 	// It reutrn an Timer that can use to cancel the Handler.
 	TickFunc(d time.Duration, f Handler) (TimerTask, error)
+
+	// AfterFuncCtx is same as AfterFunc, and the TimerTask will been stopped when the ctx is done.
+	// The ctx of ContextHandler is derived from the ctx, and will been cancelled when the TimerTask
+	// is stopped, the timingwheel is shutdown or the ContextHandler returned.
+	AfterFuncCtx(ctx context.Context, d time.Duration, f ContextHandler) (TimerTask, error)
+
+	// TickFuncCtx is same as TickFunc, and the TimerTask will been stopped when the ctx is done.
+	// The ctx of ContextHandler is derived from the ctx, and will been cancelled when the TimerTask
+	// is stopped or the timingwheel is shutdown.
+	TickFuncCtx(ctx context.Context, d time.Duration, f ContextHandler) (TimerTask, error)
 }
 
 // TimerTask is an interface for task implementation.
 type TimerTask interface {
-	// Stop the timertask, the Handler will not be execute after this.
+	// Stop the timertask, the Handler will not be execute after this. The ctx of ContextHandler
+	// will been cancelled.
 	// NOTE: there is not promise the pre Hander call will been executed before stop.
 	Stop() (bool, error)
 }
+
+// ShutdownMode is the behavior of pending timer's tasks when shutdown.
+type ShutdownMode int
+
+const (
+	// ShutdownDrop will drop all the pending timer's tasks and return them, it will not wait
+	// the running Handlers.
+	ShutdownDrop ShutdownMode = iota
+
+	// ShutdownFire will fire all the pending timer's tasks now, and wait for all the running Handlers.
+	ShutdownFire
+
+	// ShutdownWait will drop all the pending timer's tasks and return them, and wait for all
+	// the running Handlers.
+	ShutdownWait
+)
+
+func (m ShutdownMode) String() string {
+	switch m {
+	case ShutdownDrop:
+		return "Drop"
+	case ShutdownFire:
+		return "Fire"
+	case ShutdownWait:
+		return "Wait"
+	}
+	return "Unknown"
+}
@@ -20,6 +20,7 @@
 package timingwheel
 
 import (
+	"sort"
 	"time"
 
 	"github.com/lsytj0413/ena/delayqueue"
@@ -62,14 +63,23 @@ type wheel struct {
 
 	// overflowWheel is the high-layer timing wheel
 	overflowWheel *wheel
+
+	// executor is the Executor to run the expired timertask, nil means
+	// the defaultExecutor. Only the first layer wheel will run timertask.
+	executor Executor
 }
 
 func (w *wheel) addOrRun(t *timerTask, dq delayqueue.DelayQueue[*bucket]) {
 	if !w.add(t, dq) {
 		now := time.Now()
 
-		// the timertask already expired, wo we run execute the timer's task in its own goroutine.
-		defaultExecutor(t.f, now)
+		// the timertask already expired, wo we run execute the timer's task by the executor.
+		if w.executor != nil {
+			// the dropped Handler is counted by the executor
+			_ = w.executor.Execute(t.f, now)
+		} else {
+			defaultExecutor(t.f, now)
+		}
 
 		if t.t == taskTick && t.stopped == 0 {
 			// the timertask is tick func, and haven't been stopped, reinsert it
@@ -132,3 +142,24 @@ func (w *wheel) advanceClock(expiration int64) {
 		}
 	}
 }
+
+// drain will remove all the timertasks from the wheel and the overflow wheels, the
+// timertasks is sorted by expiration.
+func (w *wheel) drain() []*timerTask {
+	tasks := []*timerTask{}
+	for cw := w; cw != nil; cw = cw.overflowWheel {
+		for _, b := range cw.buckets {
+			b.Flush(func(t *timerTask) {
+				tasks = append(tasks, t)
+			})
+		}
+	}
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[i].expiration != tasks[j].expiration {
+			return tasks[i].expiration < tasks[j].expiration
+		}
+		return tasks[i].id < tasks[j].id
+	})
+	return tasks
+}
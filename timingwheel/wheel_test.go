@@ -255,3 +255,30 @@ func TestWheelAdvanceClock(t *testing.T) {
 	g.Expect(w.currentTime).To(Equal(exp))
 	g.Expect(w.overflowWheel.currentTime).To(Equal(exp))
 }
+
+func TestWheelDrain(t *testing.T) {
+	g := NewWithT(t)
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dq := delayqueuemocks.NewMockDelayQueue[*bucket](ctrl)
+	dq.EXPECT().Offer(gomock.Any(), gomock.Any()).AnyTimes()
+
+	w := newWheel(3, 20, 4)
+	tasks := []*timerTask{
+		{id: 1, expiration: 200},
+		{id: 2, expiration: 10},
+		{id: 3, expiration: 50},
+		{id: 4, expiration: 10},
+	}
+	for _, task := range tasks {
+		g.Expect(w.add(task, dq)).To(BeTrue())
+	}
+	g.Expect(w.overflowWheel).ToNot(BeNil())
+
+	g.Expect(w.drain()).To(Equal([]*timerTask{tasks[1], tasks[3], tasks[2], tasks[0]}))
+	for _, task := range tasks {
+		g.Expect(task.b).To(BeNil())
+	}
+	g.Expect(w.drain()).To(BeEmpty())
+}